@@ -61,6 +61,18 @@ type FilerOptions struct {
 	showUIDirectoryDelete   *bool
 	downloadMaxMBps         *int
 	diskType                *string
+	chunkChecksum           *string
+	manifestChecksum        *string
+	manifestAntiAffinity    *bool
+	compressManifest        *bool
+	encryptManifest         *bool
+	manifestBatch           *int
+	manifestizeConcurrency  *int
+	coalesceManifests       *bool
+	warmManifestsOnWrite    *bool
+	manifestCacheMB         *int
+	rejectGappedManifests   *bool
+	retryableHttpStatuses   *string
 }
 
 func init() {
@@ -91,6 +103,18 @@ func init() {
 	f.showUIDirectoryDelete = cmdFiler.Flag.Bool("ui.deleteDir", true, "enable filer UI show delete directory button")
 	f.downloadMaxMBps = cmdFiler.Flag.Int("downloadMaxMBps", 0, "download max speed for each download request, in MB per second")
 	f.diskType = cmdFiler.Flag.String("disk", "", "[hdd|ssd|<tag>] hard drive or solid state drive or any tag")
+	f.chunkChecksum = cmdFiler.Flag.String("chunkChecksum", "", "[crc32c|md5|sha256] record this checksum on new chunks, verified when whole chunks are read")
+	f.manifestChecksum = cmdFiler.Flag.String("manifestChecksum", "", "[crc32c|md5|sha256] record this checksum on new chunk manifests, verified when they are resolved, instead of -chunkChecksum")
+	f.manifestAntiAffinity = cmdFiler.Flag.Bool("manifestAntiAffinity", false, "place chunk manifests on other volumes than their data chunks when possible")
+	f.compressManifest = cmdFiler.Flag.Bool("compressManifest", false, "compress the chunk manifests of large files with gzip")
+	f.encryptManifest = cmdFiler.Flag.Bool("encryptManifest", false, "encrypt the chunk manifests with a key of their own")
+	f.manifestBatch = cmdFiler.Flag.Int("manifestBatch", filer.ManifestBatch, "number of data chunks merged into each chunk manifest, at least 2")
+	f.manifestizeConcurrency = cmdFiler.Flag.Int("manifestizeConcurrency", 1, "number of chunk manifests of a file saved at the same time")
+	f.coalesceManifests = cmdFiler.Flag.Bool("coalesceManifests", false, "resolve each chunk manifest on the filer owning it, so the filers reading a file fetch its manifests once")
+	f.warmManifestsOnWrite = cmdFiler.Flag.Bool("warmManifestsOnWrite", false, "cache new chunk manifests when written, and push them to the filer owning them with -coalesceManifests")
+	f.manifestCacheMB = cmdFiler.Flag.Int("manifestCacheMB", 0, "memory in MB kept for the chunks of resolved chunk manifests, 0 to disable")
+	f.rejectGappedManifests = cmdFiler.Flag.Bool("manifestRejectGaps", false, "leave chunks with gaps or overlaps unmerged instead of merging them into a chunk manifest")
+	f.retryableHttpStatuses = cmdFiler.Flag.String("retryableHttpStatuses", "502,503,504", "comma separated http status codes of volume server reads worth retrying")
 
 	// start s3 on filer
 	filerStartS3 = cmdFiler.Flag.Bool("s3", false, "whether to start S3 gateway")
@@ -234,6 +258,37 @@ func (fo *FilerOptions) startFiler() {
 
 	filerAddress := pb.NewServerAddress(*fo.ip, *fo.port, *fo.portGrpc)
 
+	if *fo.chunkChecksum != "" {
+		if _, err := filer.ComputeChunkChecksum(*fo.chunkChecksum, nil); err != nil {
+			glog.Fatalf("Filer startup error: %v", err)
+		}
+		filer.ChunkChecksumAlgorithm = *fo.chunkChecksum
+	}
+	if *fo.manifestChecksum != "" {
+		if _, err := filer.ComputeChunkChecksum(*fo.manifestChecksum, nil); err != nil {
+			glog.Fatalf("Filer startup error: %v", err)
+		}
+		filer.ManifestChecksumAlgorithm = *fo.manifestChecksum
+	}
+	filer.ManifestAntiAffinity = *fo.manifestAntiAffinity
+	filer.CompressManifest = *fo.compressManifest
+	// with encryptVolumeData, the manifests are encrypted when saved like the data
+	filer.EncryptManifest = *fo.encryptManifest && !*fo.cipher
+	if err := filer.SetManifestBatch(*fo.manifestBatch); err != nil {
+		glog.Fatalf("Filer startup error: %v", err)
+	}
+	glog.V(0).Infof("manifestizing with batch=%d", filer.EffectiveManifestBatch())
+	filer.ManifestizeConcurrency = *fo.manifestizeConcurrency
+	filer.CoalesceManifestsAcrossFilers = *fo.coalesceManifests
+	filer.WarmManifestsOnWrite = *fo.warmManifestsOnWrite
+	filer.SetResolvedManifestCacheBytes(int64(*fo.manifestCacheMB) * 1024 * 1024)
+	filer.RejectNonContiguousManifests = *fo.rejectGappedManifests
+	retryableHttpStatusCodes, err := util.ParseHttpStatusCodes(*fo.retryableHttpStatuses)
+	if err != nil {
+		glog.Fatalf("Filer startup error: %v", err)
+	}
+	util.SetRetryableHttpStatusCodes(retryableHttpStatusCodes)
+
 	fs, nfs_err := weed_server.NewFilerServer(defaultMux, publicVolumeMux, &weed_server.FilerOption{
 		Masters:               fo.masters,
 		FilerGroup:            *fo.filerGroup,
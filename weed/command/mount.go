@@ -19,6 +19,8 @@ type MountOptions struct {
 	concurrentWriters  *int
 	cacheDir           *string
 	cacheSizeMB        *int64
+	persistentCacheDir *string
+	persistentCacheMB  *int64
 	dataCenter         *string
 	allowOthers        *bool
 	umaskString        *string
@@ -56,6 +58,8 @@ func init() {
 	mountOptions.concurrentWriters = cmdMount.Flag.Int("concurrentWriters", 32, "limit concurrent goroutine writers")
 	mountOptions.cacheDir = cmdMount.Flag.String("cacheDir", os.TempDir(), "local cache directory for file chunks and meta data")
 	mountOptions.cacheSizeMB = cmdMount.Flag.Int64("cacheCapacityMB", 0, "file chunk read cache capacity in MB")
+	mountOptions.persistentCacheDir = cmdMount.Flag.String("persistentCacheDir", "", "local directory to cache whole file chunks across mounts, with integrity checks")
+	mountOptions.persistentCacheMB = cmdMount.Flag.Int64("persistentCacheCapacityMB", 10*1024, "persistent file chunk cache capacity in MB")
 	mountOptions.dataCenter = cmdMount.Flag.String("dataCenter", "", "prefer to write to the data center")
 	mountOptions.allowOthers = cmdMount.Flag.Bool("allowOthers", true, "allows other users to access the file system")
 	mountOptions.umaskString = cmdMount.Flag.String("umask", "022", "octal umask, e.g., 022, 0111")
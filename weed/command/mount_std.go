@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/seaweedfs/seaweedfs/weed/filer"
 	"github.com/seaweedfs/seaweedfs/weed/glog"
 	"github.com/seaweedfs/seaweedfs/weed/mount"
 	"github.com/seaweedfs/seaweedfs/weed/mount/meta_cache"
@@ -27,6 +28,7 @@ import (
 	"time"
 
 	"github.com/seaweedfs/seaweedfs/weed/util"
+	"github.com/seaweedfs/seaweedfs/weed/util/chunk_cache"
 	"github.com/seaweedfs/seaweedfs/weed/util/grace"
 )
 
@@ -214,6 +216,18 @@ func RunMount(option *MountOptions, umask os.FileMode) bool {
 		mountRoot = mountRoot[0 : len(mountRoot)-1]
 	}
 
+	if *option.persistentCacheDir != "" {
+		persistentCache, cacheErr := chunk_cache.NewPersistentChunkCache(util.ResolvePath(*option.persistentCacheDir), *option.persistentCacheMB*1024*1024)
+		if cacheErr != nil {
+			fmt.Printf("failed to open persistent chunk cache %s: %v\n", *option.persistentCacheDir, cacheErr)
+			return false
+		}
+		filer.LocalChunkCache = persistentCache
+	}
+	// keep the manifests resolved again as readers seek around files
+	filer.FetchedChunkCache = filer.NewMemoryWholeChunkCache(64)
+	filer.SetResolvedManifestCacheBytes(64 * 1024 * 1024)
+
 	seaweedFileSystem := mount.NewSeaweedFileSystem(&mount.Option{
 		MountDirectory:     dir,
 		FilerAddresses:     filerAddresses,
@@ -9,6 +9,7 @@ import (
 
 	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
 
+	"github.com/seaweedfs/seaweedfs/weed/filer"
 	"github.com/seaweedfs/seaweedfs/weed/glog"
 	"github.com/seaweedfs/seaweedfs/weed/pb"
 	"github.com/seaweedfs/seaweedfs/weed/util"
@@ -117,6 +118,18 @@ func init() {
 	filerOptions.showUIDirectoryDelete = cmdServer.Flag.Bool("filer.ui.deleteDir", true, "enable filer UI show delete directory button")
 	filerOptions.downloadMaxMBps = cmdServer.Flag.Int("filer.downloadMaxMBps", 0, "download max speed for each download request, in MB per second")
 	filerOptions.diskType = cmdServer.Flag.String("filer.disk", "", "[hdd|ssd|<tag>] hard drive or solid state drive or any tag")
+	filerOptions.chunkChecksum = cmdServer.Flag.String("filer.chunkChecksum", "", "[crc32c|md5|sha256] record this checksum on new chunks, verified when whole chunks are read")
+	filerOptions.manifestChecksum = cmdServer.Flag.String("filer.manifestChecksum", "", "[crc32c|md5|sha256] record this checksum on new chunk manifests, verified when they are resolved, instead of -chunkChecksum")
+	filerOptions.manifestAntiAffinity = cmdServer.Flag.Bool("filer.manifestAntiAffinity", false, "place chunk manifests on other volumes than their data chunks when possible")
+	filerOptions.compressManifest = cmdServer.Flag.Bool("filer.compressManifest", false, "compress the chunk manifests of large files with gzip")
+	filerOptions.encryptManifest = cmdServer.Flag.Bool("filer.encryptManifest", false, "encrypt the chunk manifests with a key of their own")
+	filerOptions.manifestBatch = cmdServer.Flag.Int("filer.manifestBatch", filer.ManifestBatch, "number of data chunks merged into each chunk manifest, at least 2")
+	filerOptions.manifestizeConcurrency = cmdServer.Flag.Int("filer.manifestizeConcurrency", 1, "number of chunk manifests of a file saved at the same time")
+	filerOptions.coalesceManifests = cmdServer.Flag.Bool("filer.coalesceManifests", false, "resolve each chunk manifest on the filer owning it, so the filers reading a file fetch its manifests once")
+	filerOptions.warmManifestsOnWrite = cmdServer.Flag.Bool("filer.warmManifestsOnWrite", false, "cache new chunk manifests when written, and push them to the filer owning them with -filer.coalesceManifests")
+	filerOptions.manifestCacheMB = cmdServer.Flag.Int("filer.manifestCacheMB", 0, "memory in MB kept for the chunks of resolved chunk manifests, 0 to disable")
+	filerOptions.rejectGappedManifests = cmdServer.Flag.Bool("filer.manifestRejectGaps", false, "leave chunks with gaps or overlaps unmerged instead of merging them into a chunk manifest")
+	filerOptions.retryableHttpStatuses = cmdServer.Flag.String("filer.retryableHttpStatuses", "502,503,504", "comma separated http status codes of volume server reads worth retrying")
 
 	serverOptions.v.port = cmdServer.Flag.Int("volume.port", 8080, "volume server http listen port")
 	serverOptions.v.portGrpc = cmdServer.Flag.Int("volume.port.grpc", 0, "volume server grpc listen port")
@@ -0,0 +1,81 @@
+package filer
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// BlockReader serves a file as fixed size blocks, regardless of the layout of its chunks.
+// Each block is stitched from the parts of the chunks overlapping it, and holes read as zeros.
+type BlockReader struct {
+	lookupFileIdFn wdclient.LookupFileIdFunctionType
+	chunks         []*filer_pb.FileChunk
+	blockSize      int64
+	fileSize       int64
+	visibles       *IntervalList[*VisibleInterval]
+	readFlow       *ReadFlow
+}
+
+func NewBlockReader(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, blockSize int64) (*BlockReader, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size %d", blockSize)
+	}
+	return &BlockReader{
+		lookupFileIdFn: lookupFileIdFn,
+		chunks:         chunks,
+		blockSize:      blockSize,
+		fileSize:       int64(TotalSize(chunks)),
+		readFlow:       NewReadFlow(ReadSourceStream),
+	}, nil
+}
+
+func (r *BlockReader) BlockSize() int64 {
+	return r.blockSize
+}
+
+// BlockCount is the number of blocks covering the file, the last one may extend beyond the end of the file.
+func (r *BlockReader) BlockCount() int64 {
+	return (r.fileSize + r.blockSize - 1) / r.blockSize
+}
+
+// ReadBlock fills the buffer, of at least the block size, with the block. The part of the last block
+// beyond the end of the file reads as zeros.
+func (r *BlockReader) ReadBlock(buffer []byte, blockIndex int64) error {
+	if int64(len(buffer)) < r.blockSize {
+		return fmt.Errorf("buffer size %d is less than block size %d", len(buffer), r.blockSize)
+	}
+	if blockIndex < 0 || blockIndex >= r.BlockCount() {
+		return io.EOF
+	}
+	if r.visibles == nil {
+		visibles, err := NonOverlappingVisibleIntervals(r.lookupFileIdFn, r.chunks, 0, math.MaxInt64)
+		if err != nil {
+			return err
+		}
+		r.visibles = visibles
+	}
+
+	block := buffer[:r.blockSize]
+	for i := range block {
+		block[i] = 0
+	}
+	blockOffset := blockIndex * r.blockSize
+	chunkViews := ViewFromVisibleIntervals(r.visibles, blockOffset, r.blockSize)
+	for x := chunkViews.Front(); x != nil; x = x.Next {
+		chunkView := x.Value
+		start := chunkView.ViewOffset - blockOffset
+		data := block[start : start+int64(chunkView.ViewSize)]
+		n, err := fetchChunkViewRange(data, r.lookupFileIdFn, chunkView, chunkView.OffsetInChunk, r.readFlow)
+		if err != nil {
+			return fmt.Errorf("read block %d from chunk %s: %v", blockIndex, chunkView.FileId, err)
+		}
+		if n != len(data) {
+			return fmt.Errorf("read block %d from chunk %s: %d of %d bytes", blockIndex, chunkView.FileId, n, len(data))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package filer
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestBlockReader(t *testing.T) {
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": "aaaaaa",
+		"1,02": "bbbb",
+		"1,03": "cc",
+	})
+	defer closeFn()
+
+	// chunks of 6, 4 and 2 bytes, with a hole of 2 bytes, read as blocks of 4 bytes
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 6, ModifiedTsNs: 1},
+		{FileId: "1,02", Offset: 6, Size: 4, ModifiedTsNs: 2},
+		{FileId: "1,03", Offset: 12, Size: 2, ModifiedTsNs: 3},
+	}
+	r, err := NewBlockReader(lookup, chunks, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), r.BlockCount())
+
+	var blocks []string
+	buffer := make([]byte, 4)
+	for i := int64(0); i < r.BlockCount(); i++ {
+		assert.NoError(t, r.ReadBlock(buffer, i))
+		blocks = append(blocks, string(buffer))
+	}
+	assert.Equal(t, []string{"aaaa", "aabb", "bb\x00\x00", "cc\x00\x00"}, blocks)
+
+	assert.Equal(t, io.EOF, r.ReadBlock(buffer, 4))
+	assert.Error(t, r.ReadBlock(buffer[:2], 0))
+}
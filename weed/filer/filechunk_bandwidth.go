@@ -0,0 +1,170 @@
+package filer
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxReadBytesPerSecond caps the total bytes per second read from volume servers by this process,
+// shared fairly across all active read streams. 0 means no limit.
+var MaxReadBytesPerSecond int64
+
+// ReadSourceWeights gives read streams from some sources a larger share of MaxReadBytesPerSecond.
+// Sources not listed have weight 1.
+var ReadSourceWeights = map[string]float64{}
+
+const (
+	ReadSourceStream   = "stream"
+	ReadSourceCache    = "cache"
+	ReadSourceManifest = "manifest"
+)
+
+var readScheduler = newFairScheduler()
+
+// ReadFlow is one read stream competing for the read bandwidth.
+// Its chunk reads are identified by the source, and optionally a request id, in volume server access logs.
+type ReadFlow struct {
+	weight    float64
+	finish    float64 // virtual time when the last granted read of this flow finishes
+	source    string
+	requestId string
+	retry     *RetryPolicy // nil derives the policy from the size of each chunk read
+	events    chan<- *ReadEvent
+	deadline  time.Time // zero for no deadline
+	// reads needles already deleted on the volume servers, only for the internal manifest resolution
+	readDeleted       bool
+	replicaPreference ReplicaPreference // nil for DefaultReplicaPreference
+	limiter           *ReadRateLimiter
+	// asks the volume servers for the stored bytes, without gzip encoding
+	identityEncoding bool
+}
+
+func NewReadFlow(source string) *ReadFlow {
+	weight := ReadSourceWeights[source]
+	if weight <= 0 {
+		weight = 1
+	}
+	flow := &ReadFlow{weight: weight, source: source, readDeleted: source == ReadSourceManifest, limiter: readSourceRateLimiter(source)}
+	if ReadRequestIds {
+		flow.requestId = uuid.New().String()
+	}
+	return flow
+}
+
+// reads without their own flow share this one
+var defaultReadFlow = NewReadFlow("")
+
+// chargeRead waits until the flow may read n more bytes.
+func chargeRead(flow *ReadFlow, n int64) {
+	readScheduler.acquire(flow, n, MaxReadBytesPerSecond)
+}
+
+// fairScheduler is a token bucket whose waiting reads are granted in start-time fair queueing order:
+// each read is tagged with the virtual time its flow may start, and a flow's tags advance by size/weight,
+// so backlogged flows get bandwidth in proportion to their weights.
+type fairScheduler struct {
+	sync.Mutex
+	cond        *sync.Cond
+	tokens      float64
+	lastRefill  time.Time
+	virtualTime float64
+	seq         uint64
+	queue       fairQueue
+	now         func() time.Time
+	sleep       func(time.Duration)
+}
+
+type fairRequest struct {
+	start float64
+	seq   uint64
+	size  int64
+}
+
+func newFairScheduler() *fairScheduler {
+	s := &fairScheduler{
+		now:   time.Now,
+		sleep: time.Sleep,
+	}
+	s.cond = sync.NewCond(&s.Mutex)
+	return s
+}
+
+func (s *fairScheduler) acquire(flow *ReadFlow, n int64, rate int64) {
+	if rate <= 0 || n <= 0 {
+		return
+	}
+	if flow == nil {
+		flow = defaultReadFlow
+	}
+	s.Lock()
+	defer s.Unlock()
+	req := s.enqueue(flow, n)
+	for {
+		if s.queue[0] != req {
+			s.cond.Wait()
+			continue
+		}
+		s.refill(rate)
+		if s.tokens > 0 {
+			// a read larger than the remaining tokens goes into debt, which later reads wait out
+			heap.Pop(&s.queue)
+			s.tokens -= float64(n)
+			s.virtualTime = req.start
+			s.cond.Broadcast()
+			return
+		}
+		wait := time.Duration(-s.tokens/float64(rate)*float64(time.Second)) + time.Millisecond
+		s.Unlock()
+		s.sleep(wait)
+		s.Lock()
+	}
+}
+
+// enqueue tags the read and queues it, must be called with the lock held
+func (s *fairScheduler) enqueue(flow *ReadFlow, n int64) *fairRequest {
+	start := s.virtualTime
+	if start < flow.finish {
+		start = flow.finish
+	}
+	flow.finish = start + float64(n)/flow.weight
+	req := &fairRequest{start: start, seq: s.seq, size: n}
+	s.seq++
+	heap.Push(&s.queue, req)
+	return req
+}
+
+// refill adds the tokens accumulated since the last refill, with at most one second of burst
+func (s *fairScheduler) refill(rate int64) {
+	now := s.now()
+	if s.lastRefill.IsZero() {
+		s.lastRefill = now
+		return
+	}
+	s.tokens += now.Sub(s.lastRefill).Seconds() * float64(rate)
+	if s.tokens > float64(rate) {
+		s.tokens = float64(rate)
+	}
+	s.lastRefill = now
+}
+
+type fairQueue []*fairRequest
+
+func (q fairQueue) Len() int { return len(q) }
+func (q fairQueue) Less(i, j int) bool {
+	if q[i].start != q[j].start {
+		return q[i].start < q[j].start
+	}
+	return q[i].seq < q[j].seq
+}
+func (q fairQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *fairQueue) Push(x interface{}) { *q = append(*q, x.(*fairRequest)) }
+func (q *fairQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	x := old[n-1]
+	*q = old[:n-1]
+	return x
+}
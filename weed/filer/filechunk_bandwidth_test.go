@@ -0,0 +1,50 @@
+package filer
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFairSchedulerWeights(t *testing.T) {
+	s := newFairScheduler()
+	heavy := &ReadFlow{weight: 2}
+	light := &ReadFlow{weight: 1}
+
+	flows := make(map[*fairRequest]string)
+	for i := 0; i < 10; i++ {
+		flows[s.enqueue(heavy, 100)] = "heavy"
+		flows[s.enqueue(light, 100)] = "light"
+	}
+
+	// in the first 9 grants, the heavy flow gets twice the share of the light flow
+	granted := make(map[string]int)
+	for i := 0; i < 9; i++ {
+		req := heap.Pop(&s.queue).(*fairRequest)
+		granted[flows[req]]++
+	}
+	assert.Equal(t, 6, granted["heavy"])
+	assert.Equal(t, 3, granted["light"])
+}
+
+func TestFairSchedulerRate(t *testing.T) {
+	s := newFairScheduler()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	s.sleep = func(d time.Duration) { now = now.Add(d) }
+	start := now
+
+	flow := NewReadFlow("")
+	for i := 0; i < 4; i++ {
+		s.acquire(flow, 1000, 1000)
+	}
+	// the last read starts once the first three have been paid for
+	elapsed := now.Sub(start)
+	assert.True(t, elapsed >= 3*time.Second && elapsed < 4*time.Second, "elapsed %v", elapsed)
+
+	// no limit
+	s.acquire(flow, 1000, 0)
+	assert.Equal(t, elapsed, now.Sub(start))
+}
@@ -0,0 +1,137 @@
+package filer
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+const (
+	ChecksumCrc32c = "crc32c"
+	ChecksumMd5    = "md5"
+	ChecksumSha256 = "sha256"
+)
+
+// ChunkChecksumAlgorithm is recorded on newly written chunks. Empty means no checksum is recorded.
+var ChunkChecksumAlgorithm = ""
+
+// ManifestChecksumAlgorithm is recorded on newly written manifest chunks instead of ChunkChecksumAlgorithm,
+// so the manifests are verified when resolved even if the data chunks carry no checksum.
+// Empty means manifests follow ChunkChecksumAlgorithm.
+var ManifestChecksumAlgorithm = ""
+
+func manifestChecksumAlgorithm() string {
+	if ManifestChecksumAlgorithm != "" {
+		return ManifestChecksumAlgorithm
+	}
+	return ChunkChecksumAlgorithm
+}
+
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case ChecksumCrc32c:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	case ChecksumMd5:
+		return md5.New(), nil
+	case ChecksumSha256:
+		return sha256.New(), nil
+	}
+	return nil, fmt.Errorf("unknown checksum algorithm %q", algorithm)
+}
+
+func ComputeChunkChecksum(algorithm string, data []byte) ([]byte, error) {
+	h, err := newChecksumHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// SetChunkChecksum records the checksum of the chunk's uncompressed and decrypted data.
+// An empty algorithm leaves the chunk unchanged.
+func SetChunkChecksum(chunk *filer_pb.FileChunk, algorithm string, data []byte) error {
+	if algorithm == "" {
+		return nil
+	}
+	checksum, err := ComputeChunkChecksum(algorithm, data)
+	if err != nil {
+		return err
+	}
+	chunk.ChecksumAlgorithm, chunk.Checksum = algorithm, checksum
+	return nil
+}
+
+// VerifyChunkChecksum checks the whole chunk data against the recorded checksum.
+// Chunks without a recorded checksum always pass.
+func VerifyChunkChecksum(fileId string, algorithm string, expected []byte, data []byte) error {
+	if algorithm == "" {
+		return nil
+	}
+	actual, err := ComputeChunkChecksum(algorithm, data)
+	if err != nil {
+		return fmt.Errorf("verify chunk %s: %v", fileId, err)
+	}
+	if !bytes.Equal(actual, expected) {
+		return fmt.Errorf("chunk %s %s checksum mismatch: expected %s, actual %s",
+			fileId, algorithm, hex.EncodeToString(expected), hex.EncodeToString(actual))
+	}
+	return nil
+}
+
+// verifyFullChunk checks the data read for the chunk view when it covers the whole chunk
+func (cv *ChunkView) verifyFullChunk(data []byte) error {
+	if !cv.IsFullChunk() {
+		return nil
+	}
+	return VerifyChunkChecksum(cv.FileId, cv.ChecksumAlgorithm, cv.Checksum, data)
+}
+
+// checksumWriter hashes the data of a whole chunk as it is streamed to the writer
+type checksumWriter struct {
+	io.Writer
+	hash hash.Hash
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.hash.Write(p[:n])
+	return n, err
+}
+
+// newFullChunkWriter wraps the writer, when the chunk view covers a whole chunk with a recorded checksum, so the
+// returned verify checks the data once streamed. The data is already written by then, so a mismatch fails the read
+// instead of keeping bad data from the writer.
+func newFullChunkWriter(writer io.Writer, cv *ChunkView) (w io.Writer, verify func() error) {
+	if !cv.IsFullChunk() || cv.ChecksumAlgorithm == "" {
+		return writer, func() error { return nil }
+	}
+	h, err := newChecksumHash(cv.ChecksumAlgorithm)
+	if err != nil {
+		return writer, func() error { return fmt.Errorf("verify chunk %s: %v", cv.FileId, err) }
+	}
+	return &checksumWriter{Writer: writer, hash: h}, func() error {
+		if actual := h.Sum(nil); !bytes.Equal(actual, cv.Checksum) {
+			return fmt.Errorf("chunk %s %s checksum mismatch: expected %s, actual %s",
+				cv.FileId, cv.ChecksumAlgorithm, hex.EncodeToString(cv.Checksum), hex.EncodeToString(actual))
+		}
+		return nil
+	}
+}
+
+// fetchChunkViewRange is fetchChunkRange for the chunk view, verifying the checksum when the whole chunk is read
+func fetchChunkViewRange(buffer []byte, lookupFileIdFn wdclient.LookupFileIdFunctionType, chunkView *ChunkView, offset int64, flow *ReadFlow) (int, error) {
+	n, err := fetchChunkRange(buffer, lookupFileIdFn, chunkView.FileId, chunkView.CipherKey, chunkView.IsGzipped, offset, flow)
+	if err == nil && offset == 0 && uint64(n) == chunkView.ChunkSize {
+		err = VerifyChunkChecksum(chunkView.FileId, chunkView.ChecksumAlgorithm, chunkView.Checksum, buffer[:n])
+	}
+	return n, err
+}
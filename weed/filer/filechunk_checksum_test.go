@@ -0,0 +1,138 @@
+package filer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestChunkChecksum(t *testing.T) {
+	data := []byte("some chunk data")
+	for _, algorithm := range []string{ChecksumCrc32c, ChecksumMd5, ChecksumSha256} {
+		chunk := &filer_pb.FileChunk{FileId: "1,01"}
+		assert.NoError(t, SetChunkChecksum(chunk, algorithm, data))
+		assert.Equal(t, algorithm, chunk.ChecksumAlgorithm)
+		assert.NoError(t, VerifyChunkChecksum(chunk.FileId, chunk.ChecksumAlgorithm, chunk.Checksum, data), algorithm)
+		assert.ErrorContains(t, VerifyChunkChecksum(chunk.FileId, chunk.ChecksumAlgorithm, chunk.Checksum, []byte("other data")), "checksum mismatch", algorithm)
+	}
+
+	chunk := &filer_pb.FileChunk{FileId: "1,01"}
+	assert.NoError(t, SetChunkChecksum(chunk, "", data))
+	assert.Equal(t, "", chunk.ChecksumAlgorithm)
+	assert.Nil(t, chunk.Checksum)
+	assert.NoError(t, VerifyChunkChecksum(chunk.FileId, chunk.ChecksumAlgorithm, chunk.Checksum, []byte("anything")))
+
+	assert.Error(t, SetChunkChecksum(chunk, "crc64", data))
+	assert.Error(t, VerifyChunkChecksum(chunk.FileId, "crc64", nil, data))
+}
+
+func TestResolveOneChunkManifestChecksum(t *testing.T) {
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{{FileId: "1,09", Offset: 0, Size: 10}},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": string(data),
+	})
+	defer closeFn()
+
+	manifestChunk := &filer_pb.FileChunk{FileId: "1,01", Size: 10, IsChunkManifest: true}
+	assert.NoError(t, SetChunkChecksum(manifestChunk, ChecksumSha256, data))
+	chunks, err := ResolveOneChunkManifest(lookup, manifestChunk)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(chunks))
+
+	manifestChunk.Checksum[0] ^= 0xff
+	_, err = ResolveOneChunkManifest(lookup, manifestChunk)
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestManifestChecksumAlgorithm(t *testing.T) {
+	defer func() {
+		ManifestChecksumAlgorithm = ""
+	}()
+	ManifestChecksumAlgorithm = ChecksumCrc32c
+
+	contents := make(map[string]string)
+	lookup, closeFn := newTestVolumeServer(t, contents)
+	defer closeFn()
+	saveFunc := func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		contents["1,01"] = string(data)
+		return &filer_pb.FileChunk{FileId: "1,01"}, nil
+	}
+	var dataChunks []*filer_pb.FileChunk
+	for i := 0; i < 4; i++ {
+		dataChunks = append(dataChunks, &filer_pb.FileChunk{FileId: fmt.Sprintf("2,%02x", i+1), Offset: int64(i) * 10, Size: 10})
+	}
+	manifestChunk, err := mergeIntoManifest(saveFunc, dataChunks)
+	assert.NoError(t, err)
+	assert.Equal(t, ChecksumCrc32c, manifestChunk.ChecksumAlgorithm)
+
+	chunks, err := ResolveOneChunkManifest(lookup, manifestChunk)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(chunks))
+
+	// a flipped bit of the stored body, keeping its size
+	corrupted := []byte(contents["1,01"])
+	corrupted[len(corrupted)-1] ^= 0x01
+	contents["1,01"] = string(corrupted)
+	_, err = ResolveOneChunkManifest(lookup, manifestChunk)
+	assert.ErrorContains(t, err, "checksum mismatch")
+
+	// without an algorithm, the manifests follow the data chunks and carry no checksum
+	ManifestChecksumAlgorithm = ""
+	manifestChunk, err = mergeIntoManifest(saveFunc, dataChunks)
+	assert.NoError(t, err)
+	assert.Empty(t, manifestChunk.ChecksumAlgorithm)
+}
+
+func TestFullChunkReadsVerifyChecksum(t *testing.T) {
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": "0123456789",
+	})
+	defer closeFn()
+	chunk := &filer_pb.FileChunk{FileId: "1,01", Offset: 0, Size: 10}
+	assert.NoError(t, SetChunkChecksum(chunk, ChecksumCrc32c, []byte("0123456789")))
+	corrupted := proto.Clone(chunk).(*filer_pb.FileChunk)
+	corrupted.Checksum[0] ^= 0xff
+	chunkView := func(chunk *filer_pb.FileChunk, offset, size int64) *ChunkView {
+		return ViewFromChunks(lookup, []*filer_pb.FileChunk{chunk}, offset, size).Front().Value
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, StreamContent(testLookup(lookup), &buf, []*filer_pb.FileChunk{chunk}, 0, 10))
+	assert.Equal(t, "0123456789", buf.String())
+	assert.ErrorContains(t, StreamContent(testLookup(lookup), &buf, []*filer_pb.FileChunk{corrupted}, 0, 10), "checksum mismatch")
+	assert.ErrorContains(t, StreamContentWithQuorum(context.Background(), testLookup(lookup), &buf, []*filer_pb.FileChunk{corrupted}, 0, 10, 0, 1), "checksum mismatch")
+	// a part of the chunk is not verified
+	buf.Reset()
+	assert.NoError(t, StreamContent(testLookup(lookup), &buf, []*filer_pb.FileChunk{corrupted}, 2, 4))
+	assert.Equal(t, "2345", buf.String())
+
+	buffer := make([]byte, 10)
+	n, err := NewReaderCache(8, nil, lookup).ReadChunkAt(buffer, chunkView(chunk, 0, 10), 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n)
+	_, err = NewReaderCache(8, nil, lookup).ReadChunkAt(buffer, chunkView(corrupted, 0, 10), 0, false)
+	assert.ErrorContains(t, err, "checksum mismatch")
+
+	n, err = fetchChunkViewRange(buffer, lookup, chunkView(chunk, 0, 10), 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n)
+	_, err = fetchChunkViewRange(buffer, lookup, chunkView(corrupted, 0, 10), 0, nil)
+	assert.ErrorContains(t, err, "checksum mismatch")
+	n, err = fetchChunkViewRange(buffer[:4], lookup, chunkView(corrupted, 2, 4), 2, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2345", string(buffer[:n]))
+}
@@ -0,0 +1,39 @@
+package filer
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the time source of the retry backoff of chunk reads and lookups
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// retryClock is replaced by a fake clock in tests
+var retryClock Clock = realClock{}
+
+// sleepContext sleeps on the retry clock, but returns the error of the context as soon as it is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if ctx.Done() == nil {
+		retryClock.Sleep(d)
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-retryClock.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,50 @@
+package filer
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeClock advances only when slept on, and records the sleeps
+type fakeClock struct {
+	sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+	c.sleeps = append(c.sleeps, d)
+}
+
+// advance moves the time without sleeping, like a slow read
+func (c *fakeClock) advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// After sleeps right away, so the channel is ready
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Sleep(d)
+	ready := make(chan time.Time, 1)
+	ready <- c.Now()
+	return ready
+}
+
+// useFakeClock replaces the retry clock until the returned function is called
+func useFakeClock() (*fakeClock, func()) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	retryClock = clock
+	return clock, func() {
+		retryClock = realClock{}
+	}
+}
@@ -0,0 +1,87 @@
+package filer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/util"
+)
+
+// CompressionCodec is how the content of a chunk is compressed on the volume servers
+type CompressionCodec string
+
+const (
+	CompressionNone CompressionCodec = ""
+	CompressionGzip CompressionCodec = "gzip"
+	CompressionZstd CompressionCodec = "zstd"
+)
+
+// ChunkCompressionCodec is the codec recorded on the chunk. Chunks written before the codec was recorded
+// are gzip when compressed.
+func ChunkCompressionCodec(chunk *filer_pb.FileChunk) CompressionCodec {
+	if chunk.CompressionCodec != "" {
+		return CompressionCodec(chunk.CompressionCodec)
+	}
+	return gzipCodec(chunk.IsCompressed)
+}
+
+func gzipCodec(isGzipped bool) CompressionCodec {
+	if isGzipped {
+		return CompressionGzip
+	}
+	return CompressionNone
+}
+
+// decodedOnTheWire tells whether the content is decompressed while reading it from the volume server.
+// Other codecs are decompressed after fetching the whole compressed chunk.
+func (codec CompressionCodec) decodedOnTheWire() bool {
+	return codec == CompressionNone || codec == CompressionGzip
+}
+
+// fetchDecompressed fetches the whole compressed chunk and decompresses it
+func fetchDecompressed(ctx context.Context, urlStrings []string, cipherKey []byte, codec CompressionCodec, flow *ReadFlow) ([]byte, error) {
+	if codec != CompressionZstd {
+		return nil, fmt.Errorf("unsupported compression codec %q", codec)
+	}
+	var compressed bytes.Buffer
+	if _, err := retriedStreamFetchChunkDataWithContext(ctx, &compressed, urlStrings, cipherKey, CompressionNone, true, 0, 0, flow); err != nil {
+		return nil, err
+	}
+	if !util.IsZstdContent(compressed.Bytes()) {
+		return nil, fmt.Errorf("chunk of %d bytes is not %s compressed", compressed.Len(), codec)
+	}
+	data, err := util.DecompressData(compressed.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("decompress %s: %v", codec, err)
+	}
+	return data, nil
+}
+
+// sliceDecompressed is the part of the decompressed chunk to read, size <= 0 reading up to the end
+func sliceDecompressed(data []byte, isFullChunk bool, offset int64, size int) ([]byte, error) {
+	if isFullChunk {
+		return data, nil
+	}
+	if offset < 0 || offset > int64(len(data)) {
+		return nil, fmt.Errorf("offset %d beyond the %d decompressed bytes", offset, len(data))
+	}
+	data = data[offset:]
+	if size > 0 && size < len(data) {
+		data = data[:size]
+	}
+	return data, nil
+}
+
+func writeDecompressed(ctx context.Context, writer io.Writer, urlStrings []string, cipherKey []byte, codec CompressionCodec, isFullChunk bool, offset int64, size int, flow *ReadFlow) (int, error) {
+	data, err := fetchDecompressed(ctx, urlStrings, cipherKey, codec, flow)
+	if err != nil {
+		return 0, err
+	}
+	if data, err = sliceDecompressed(data, isFullChunk, offset, size); err != nil {
+		return 0, err
+	}
+	return writer.Write(data)
+}
@@ -0,0 +1,95 @@
+package filer
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// PreferFastestDataCenter orders the replicas of each chunk read by the measured read latency of their
+// data centers, so reads move to the fastest data center as network conditions change.
+// Data centers not measured yet are tried first, to measure them.
+var PreferFastestDataCenter bool
+
+// ReadFailureLatency is the latency recorded for a failed read, so a data center whose reads fail
+// sorts after the data centers reading successfully instead of staying unmeasured.
+var ReadFailureLatency = 10 * time.Second
+
+// DataCenterOf tells the data center of a volume server, e.g. "10.0.0.1:8080", such as MasterClient.GetDataCenter.
+var DataCenterOf func(volumeServer string) string
+
+var dataCenterLatencies = newLatencyTracker(0.2)
+
+// latencyTracker keeps an exponentially weighted moving average of the read latency per data center
+type latencyTracker struct {
+	sync.Mutex
+	alpha   float64
+	average map[string]time.Duration
+}
+
+func newLatencyTracker(alpha float64) *latencyTracker {
+	return &latencyTracker{
+		alpha:   alpha,
+		average: make(map[string]time.Duration),
+	}
+}
+
+func (t *latencyTracker) observe(dataCenter string, latency time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	average, found := t.average[dataCenter]
+	if !found {
+		t.average[dataCenter] = latency
+		return
+	}
+	t.average[dataCenter] = time.Duration(t.alpha*float64(latency) + (1-t.alpha)*float64(average))
+}
+
+// order sorts the urls by the latency of their data centers, keeping the lookup order within a data center
+func (t *latencyTracker) order(urlStrings []string, dataCenterOf func(string) string) []string {
+	t.Lock()
+	latencies := make([]time.Duration, len(urlStrings))
+	for i, urlString := range urlStrings {
+		latencies[i] = t.average[dataCenterOf(volumeServerOf(urlString))]
+	}
+	t.Unlock()
+
+	index := make([]int, len(urlStrings))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		return latencies[index[i]] < latencies[index[j]]
+	})
+	ordered := make([]string, len(urlStrings))
+	for i, k := range index {
+		ordered[i] = urlStrings[k]
+	}
+	return ordered
+}
+
+// orderByDataCenterLatency applies PreferFastestDataCenter to the replicas of a chunk
+func orderByDataCenterLatency(urlStrings []string) []string {
+	dataCenterOf := DataCenterOf
+	if !PreferFastestDataCenter || dataCenterOf == nil || len(urlStrings) <= 1 {
+		return urlStrings
+	}
+	return dataCenterLatencies.order(urlStrings, dataCenterOf)
+}
+
+// observeReadLatency records the latency of a read from the volume server
+func observeReadLatency(volumeServer string, latency time.Duration) {
+	dataCenterOf := DataCenterOf
+	if !PreferFastestDataCenter || dataCenterOf == nil {
+		return
+	}
+	dataCenterLatencies.observe(dataCenterOf(volumeServer), latency)
+}
+
+// observeReadFailure records a failed read from the volume server as a read taking at least ReadFailureLatency
+func observeReadFailure(volumeServer string, elapsed time.Duration) {
+	if elapsed < ReadFailureLatency {
+		elapsed = ReadFailureLatency
+	}
+	observeReadLatency(volumeServer, elapsed)
+}
@@ -0,0 +1,54 @@
+package filer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyTrackerOrder(t *testing.T) {
+	tracker := newLatencyTracker(0.5)
+	dataCenterOf := func(server string) string {
+		return map[string]string{
+			"a1:8080": "dc1",
+			"a2:8080": "dc1",
+			"b1:8080": "dc2",
+			"c1:8080": "dc3",
+		}[server]
+	}
+	urls := []string{"http://a1:8080/1,01", "http://b1:8080/1,01", "http://a2:8080/1,01", "http://c1:8080/1,01"}
+
+	tracker.observe("dc1", 100*time.Millisecond)
+	tracker.observe("dc2", 10*time.Millisecond)
+	// the data center not measured yet goes first, then the fastest, keeping the order within a data center
+	assert.Equal(t, []string{"http://c1:8080/1,01", "http://b1:8080/1,01", "http://a1:8080/1,01", "http://a2:8080/1,01"}, tracker.order(urls, dataCenterOf))
+
+	// dc2 becomes slow
+	tracker.observe("dc3", 50*time.Millisecond)
+	tracker.observe("dc2", 390*time.Millisecond)
+	assert.Equal(t, 200*time.Millisecond, tracker.average["dc2"])
+	assert.Equal(t, []string{"http://c1:8080/1,01", "http://a1:8080/1,01", "http://a2:8080/1,01", "http://b1:8080/1,01"}, tracker.order(urls, dataCenterOf))
+}
+
+func TestObserveReadFailure(t *testing.T) {
+	defer func(prefer bool, dataCenterOf func(string) string, latencies *latencyTracker) {
+		PreferFastestDataCenter, DataCenterOf, dataCenterLatencies = prefer, dataCenterOf, latencies
+	}(PreferFastestDataCenter, DataCenterOf, dataCenterLatencies)
+	PreferFastestDataCenter = true
+	DataCenterOf = func(server string) string {
+		return map[string]string{
+			"a1:8080": "dc1",
+			"b1:8080": "dc2",
+		}[server]
+	}
+	dataCenterLatencies = newLatencyTracker(0.5)
+	urls := []string{"http://a1:8080/1,01", "http://b1:8080/1,01"}
+
+	// dc1 is tried first while not measured, then sorts last once its reads fail
+	assert.Equal(t, urls, orderByDataCenterLatency(urls))
+	observeReadFailure("a1:8080", time.Millisecond)
+	observeReadLatency("b1:8080", 100*time.Millisecond)
+	assert.Equal(t, ReadFailureLatency, dataCenterLatencies.average["dc1"])
+	assert.Equal(t, []string{"http://b1:8080/1,01", "http://a1:8080/1,01"}, orderByDataCenterLatency(urls))
+}
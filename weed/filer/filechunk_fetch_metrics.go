@@ -0,0 +1,61 @@
+package filer
+
+import (
+	"net/url"
+	"path"
+
+	"github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// ChunkFetchedHook, when set, is called after each chunk fetch succeeds, with the replica url that served it,
+// the bytes read from it and the number of requests made, e.g. to collect per data center hit statistics.
+// It is called on the read path, so it should return quickly.
+var ChunkFetchedHook func(fileId, urlString string, bytes int64, attempts int)
+
+// chunkFetchMetrics counts the attempts of one retried chunk fetch
+type chunkFetchMetrics struct {
+	operation string
+	attempts  int
+}
+
+func newChunkFetchMetrics(isFullChunk bool) *chunkFetchMetrics {
+	if isFullChunk {
+		return &chunkFetchMetrics{operation: stats.ChunkFetchFull}
+	}
+	return &chunkFetchMetrics{operation: stats.ChunkFetchRange}
+}
+
+// attempt is called before each request, every request after the first one is a retry
+func (m *chunkFetchMetrics) attempt() {
+	stats.FilerChunkFetchCounter.WithLabelValues(m.operation, stats.ChunkFetchAttempt).Inc()
+	if m.attempts > 0 {
+		stats.FilerChunkFetchCounter.WithLabelValues(m.operation, stats.ChunkFetchRetry).Inc()
+	}
+	m.attempts++
+}
+
+func (m *chunkFetchMetrics) urlFailed(volumeServer string) {
+	stats.FilerChunkFetchUrlFailureCounter.WithLabelValues(m.operation, volumeServer).Inc()
+}
+
+// exhausted is called when the fetch gives up with an error that was still retryable
+func (m *chunkFetchMetrics) exhausted() {
+	stats.FilerChunkFetchCounter.WithLabelValues(m.operation, stats.ChunkFetchExhausted).Inc()
+}
+
+// succeeded reports the replica that served the fetch to ChunkFetchedHook
+func (m *chunkFetchMetrics) succeeded(urlString string, bytes int64) {
+	hook := ChunkFetchedHook
+	if hook == nil {
+		return
+	}
+	hook(fileIdOf(urlString), urlString, bytes, m.attempts)
+}
+
+// fileIdOf is the file id read from the volume server url, e.g. "3,01637037d6" of "http://10.0.0.1:8080/3,01637037d6"
+func fileIdOf(urlString string) string {
+	if u, err := url.Parse(urlString); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(urlString)
+}
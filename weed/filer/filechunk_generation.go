@@ -0,0 +1,65 @@
+package filer
+
+import (
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"golang.org/x/exp/slices"
+)
+
+// MaxChunkGeneration returns the highest generation of the chunks, 0 if none has one.
+// A manifest chunk carries the highest generation of the chunks it contains.
+func MaxChunkGeneration(chunks []*filer_pb.FileChunk) (generation uint64) {
+	for _, chunk := range chunks {
+		if generation < chunk.Generation {
+			generation = chunk.Generation
+		}
+	}
+	return
+}
+
+// AssignChunkGenerations gives the chunks not in the existing chunks the next generation of the file.
+func AssignChunkGenerations(existingChunks, chunks []*filer_pb.FileChunk) {
+	existing := make(map[string]struct{}, len(existingChunks))
+	for _, chunk := range existingChunks {
+		existing[chunk.GetFileIdString()] = struct{}{}
+	}
+	next := MaxChunkGeneration(existingChunks) + 1
+	for _, chunk := range chunks {
+		if _, found := existing[chunk.GetFileIdString()]; !found && chunk.Generation == 0 {
+			chunk.Generation = next
+		}
+	}
+}
+
+// isOlderChunk tells whether a is overwritten by b where they overlap. It is a total order, by generation,
+// then modification time, then file id. Chunks without a generation were written before every write path assigned
+// one, so they are older than the chunks with one, even if their modification times are skewed ahead.
+func isOlderChunk(a, b *filer_pb.FileChunk) bool {
+	if a.Generation != b.Generation {
+		return a.Generation < b.Generation
+	}
+	if a.ModifiedTsNs != b.ModifiedTsNs {
+		return a.ModifiedTsNs < b.ModifiedTsNs
+	}
+	return a.GetFileIdString() < b.GetFileIdString()
+}
+
+// isNewestChunk tells whether the chunk overwrites every one of the chunks it overlaps
+func isNewestChunk(chunk *filer_pb.FileChunk, chunks []*filer_pb.FileChunk) bool {
+	for _, c := range chunks {
+		if c != chunk && c.Offset < chunk.Offset+int64(chunk.Size) && chunk.Offset < c.Offset+int64(c.Size) && !isOlderChunk(c, chunk) {
+			return false
+		}
+	}
+	return true
+}
+
+// chunkOrders returns the rank of each chunk by isOlderChunk for overlap resolution, higher wins.
+func chunkOrders(chunks []*filer_pb.FileChunk) map[*filer_pb.FileChunk]int64 {
+	orders := make(map[*filer_pb.FileChunk]int64, len(chunks))
+	sorted := slices.Clone(chunks)
+	slices.SortStableFunc(sorted, isOlderChunk)
+	for i, chunk := range sorted {
+		orders[chunk] = int64(i + 1)
+	}
+	return orders
+}
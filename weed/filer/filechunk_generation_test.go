@@ -0,0 +1,117 @@
+package filer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestReadResolvedChunksByGeneration(t *testing.T) {
+	visibleFileIds := func(chunks []*filer_pb.FileChunk) (fileIds []string) {
+		visibles := readResolvedChunks(chunks, 0, math.MaxInt64)
+		for x := visibles.Front(); x != nil; x = x.Next {
+			fileIds = append(fileIds, fmt.Sprintf("%s@%d", x.Value.fileId, x.Value.start))
+		}
+		return
+	}
+
+	// the second write comes from a writer whose clock is behind
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 100, ModifiedTsNs: 200, Generation: 1},
+		{FileId: "1,02", Offset: 50, Size: 100, ModifiedTsNs: 100, Generation: 2},
+	}
+	assert.Equal(t, []string{"1,01@0", "1,02@50"}, visibleFileIds(chunks))
+
+	// without generations, the modification time decides
+	chunks[0].Generation, chunks[1].Generation = 0, 0
+	assert.Equal(t, []string{"1,01@0", "1,02@100"}, visibleFileIds(chunks))
+
+	// a chunk without a generation predates the chunks with one, whatever the modification times
+	chunks[1].Generation = 2
+	assert.Equal(t, []string{"1,01@0", "1,02@50"}, visibleFileIds(chunks))
+}
+
+func TestIsOlderChunkTotalOrder(t *testing.T) {
+	// without generations on some, these used to be ordered in a cycle
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", ModifiedTsNs: 100, Generation: 2},
+		{FileId: "1,02", ModifiedTsNs: 200},
+		{FileId: "1,03", ModifiedTsNs: 300, Generation: 1},
+		{FileId: "1,04", ModifiedTsNs: 300, Generation: 1},
+		{FileId: "1,05", ModifiedTsNs: 50},
+	}
+	for _, a := range chunks {
+		assert.False(t, isOlderChunk(a, a))
+		for _, b := range chunks {
+			if a != b {
+				assert.NotEqual(t, isOlderChunk(a, b), isOlderChunk(b, a), "%s %s", a.FileId, b.FileId)
+			}
+			for _, c := range chunks {
+				if isOlderChunk(a, b) && isOlderChunk(b, c) {
+					assert.True(t, isOlderChunk(a, c), "%s %s %s", a.FileId, b.FileId, c.FileId)
+				}
+			}
+		}
+	}
+	orders := chunkOrders(chunks)
+	assert.Equal(t, []int64{5, 2, 3, 4, 1}, []int64{orders[chunks[0]], orders[chunks[1]], orders[chunks[2]], orders[chunks[3]], orders[chunks[4]]})
+}
+
+func TestChunkGroupOrdersByGeneration(t *testing.T) {
+	// the second write comes from a writer whose clock is behind
+	older := &filer_pb.FileChunk{FileId: "1,01", Offset: 0, Size: 100, ModifiedTsNs: 200, Generation: 1}
+	newer := &filer_pb.FileChunk{FileId: "1,02", Offset: 50, Size: 100, ModifiedTsNs: 100, Generation: 2}
+	section := NewFileChunkSection(0)
+	visibleFileIds := func() (fileIds []string) {
+		for x := section.visibleIntervals.Front(); x != nil; x = x.Next {
+			fileIds = append(fileIds, fmt.Sprintf("%s@%d", x.Value.fileId, x.Value.start))
+		}
+		return
+	}
+
+	assert.NoError(t, section.addChunk(older))
+	assert.NoError(t, section.addChunk(newer))
+	assert.Equal(t, []string{"1,01@0", "1,02@50"}, visibleFileIds())
+
+	// added out of order, the older chunk stays hidden
+	section = NewFileChunkSection(0)
+	assert.NoError(t, section.addChunk(newer))
+	assert.NoError(t, section.addChunk(older))
+	assert.Equal(t, []string{"1,01@0", "1,02@50"}, visibleFileIds())
+
+	// the chunk views seen by the reader follow
+	section.chunkViews = ViewFromVisibleIntervals(section.visibleIntervals, 0, SectionSize)
+	section.reader = NewChunkReaderAtFromClient(nil, section.chunkViews, SectionSize)
+	newest := &filer_pb.FileChunk{FileId: "1,03", Offset: 25, Size: 50, ModifiedTsNs: 50, Generation: 3}
+	oldest := &filer_pb.FileChunk{FileId: "1,04", Offset: 0, Size: 150, ModifiedTsNs: 300}
+	assert.NoError(t, section.addChunk(newest))
+	assert.NoError(t, section.addChunk(oldest))
+	assert.Equal(t, []string{"1,01@0", "1,03@25", "1,02@75"}, visibleFileIds())
+	assert.Same(t, section.chunkViews, section.reader.chunkViews)
+	var viewFileIds []string
+	for x := section.reader.chunkViews.Front(); x != nil; x = x.Next {
+		viewFileIds = append(viewFileIds, fmt.Sprintf("%s@%d", x.Value.FileId, x.Value.ViewOffset))
+	}
+	assert.Equal(t, []string{"1,01@0", "1,03@25", "1,02@75"}, viewFileIds)
+}
+
+func TestAssignChunkGenerations(t *testing.T) {
+	existing := []*filer_pb.FileChunk{
+		{FileId: "1,01", Generation: 3},
+		{FileId: "1,02"},
+	}
+	updated := []*filer_pb.FileChunk{
+		{FileId: "1,01", Generation: 3},
+		{FileId: "1,02"},
+		{FileId: "1,03"},
+	}
+	AssignChunkGenerations(existing, updated)
+	assert.Equal(t, uint64(3), updated[0].Generation)
+	assert.Equal(t, uint64(0), updated[1].Generation)
+	assert.Equal(t, uint64(4), updated[2].Generation)
+	assert.Equal(t, uint64(4), MaxChunkGeneration(updated))
+}
@@ -0,0 +1,85 @@
+package filer
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+// MaxInFlightBytesPerVolumeServer caps the bytes being read from one volume server at the same time,
+// so many concurrent large reads over a few connections do not buffer unbounded data. 0 means no limit.
+// Reads of unknown size, such as whole manifest chunks, are not counted.
+var MaxInFlightBytesPerVolumeServer int64
+
+var volumeServerInFlight = newInFlightLimiter()
+
+type inFlightLimiter struct {
+	sync.Mutex
+	cond     *sync.Cond
+	inFlight map[string]int64
+}
+
+func newInFlightLimiter() *inFlightLimiter {
+	l := &inFlightLimiter{
+		inFlight: make(map[string]int64),
+	}
+	l.cond = sync.NewCond(&l.Mutex)
+	return l
+}
+
+// acquire waits until size bytes can be read from the server. A read larger than the limit
+// is let through once the server has nothing else in flight. It returns the context error
+// if the context ends first.
+func (l *inFlightLimiter) acquire(ctx context.Context, server string, size int64, limit int64) error {
+	if limit <= 0 || size <= 0 {
+		return nil
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.mustWait(server, size, limit) && ctx.Done() != nil {
+		// sync.Cond does not watch the context, wake the waiters when it ends
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				l.Lock()
+				l.cond.Broadcast()
+				l.Unlock()
+			case <-stop:
+			}
+		}()
+	}
+	for l.mustWait(server, size, limit) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.cond.Wait()
+	}
+	l.inFlight[server] += size
+	return nil
+}
+
+func (l *inFlightLimiter) mustWait(server string, size int64, limit int64) bool {
+	return l.inFlight[server] > 0 && l.inFlight[server]+size > limit
+}
+
+func (l *inFlightLimiter) release(server string, size int64, limit int64) {
+	if limit <= 0 || size <= 0 {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.inFlight[server] -= size
+	if l.inFlight[server] <= 0 {
+		delete(l.inFlight, server)
+	}
+	l.cond.Broadcast()
+}
+
+func volumeServerOf(urlString string) string {
+	if u, err := url.Parse(urlString); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return urlString
+}
@@ -0,0 +1,59 @@
+package filer
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInFlightLimiter(t *testing.T) {
+	l := newInFlightLimiter()
+	l.acquire(context.Background(), "a:8080", 60, 100)
+	l.acquire(context.Background(), "b:8080", 60, 100)
+
+	var acquired int32
+	go func() {
+		l.acquire(context.Background(), "a:8080", 60, 100)
+		atomic.StoreInt32(&acquired, 1)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&acquired), "should wait for bytes in flight to drain")
+
+	l.release("a:8080", 60, 100)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&acquired))
+
+	// larger than the limit, but nothing else in flight
+	l.release("a:8080", 60, 100)
+	l.acquire(context.Background(), "a:8080", 200, 100)
+	l.release("a:8080", 200, 100)
+
+	assert.Equal(t, "127.0.0.1:8080", volumeServerOf("http://127.0.0.1:8080/3,01637037d6"))
+}
+
+func TestInFlightLimiterCanceled(t *testing.T) {
+	l := newInFlightLimiter()
+	assert.Nil(t, l.acquire(context.Background(), "a:8080", 60, 100))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- l.acquire(ctx, "a:8080", 60, 100)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-acquired:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("acquire should return once the context is canceled")
+	}
+
+	// the canceled wait took no bytes
+	l.release("a:8080", 60, 100)
+	assert.Nil(t, l.acquire(context.Background(), "a:8080", 100, 100))
+	l.release("a:8080", 100, 100)
+}
@@ -0,0 +1,9 @@
+package filer
+
+import (
+	"github.com/seaweedfs/seaweedfs/weed/util/chunk_cache"
+)
+
+// LocalChunkCache, when set, keeps the whole chunks fetched by fetchWholeChunk and by ReaderCache on local disk,
+// and is consulted before the volume servers by fetchWholeChunk, fetchChunkRange and ReaderCache.
+var LocalChunkCache *chunk_cache.PersistentChunkCache
@@ -0,0 +1,37 @@
+package filer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/util/chunk_cache"
+)
+
+func TestLocalChunkCache(t *testing.T) {
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": "0123456789",
+	})
+	defer closeFn()
+
+	cache, err := chunk_cache.NewPersistentChunkCache(t.TempDir(), 1024)
+	assert.NoError(t, err)
+	LocalChunkCache = cache
+	defer func() {
+		LocalChunkCache = nil
+	}()
+
+	var buf bytes.Buffer
+	assert.NoError(t, fetchWholeChunk(&buf, lookup, "1,01", nil, false, nil))
+	assert.Equal(t, "0123456789", buf.String())
+
+	// served from the local cache without any volume server
+	noLookup := func(fileId string) ([]string, error) {
+		return nil, nil
+	}
+	data := make([]byte, 4)
+	n, err := fetchChunkRange(data, noLookup, "1,01", nil, false, 3, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "3456", string(data[:n]))
+}
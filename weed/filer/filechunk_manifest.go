@@ -2,16 +2,23 @@ package filer
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"math"
-	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/seaweedfs/seaweedfs/weed/wdclient"
 
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 
 	"github.com/seaweedfs/seaweedfs/weed/glog"
@@ -20,15 +27,69 @@ import (
 )
 
 const (
+	// the default number of data chunks merged into each manifest chunk, see SetManifestBatch
 	ManifestBatch = 10000
+	// the manifest format written by mergeIntoManifest, manifests without a version are version 1
+	ManifestVersion = 1
 )
 
+var manifestBatch atomic.Int32
+
+func init() {
+	manifestBatch.Store(ManifestBatch)
+}
+
+// SetManifestBatch changes the number of data chunks MaybeManifestize merges into each manifest chunk.
+// A batch below 2 is rejected, keeping the current one.
+func SetManifestBatch(batch int) error {
+	if err := checkManifestBatch(batch); err != nil {
+		return err
+	}
+	if batch > math.MaxInt32 {
+		return fmt.Errorf("invalid manifest batch %d, must be at most %d", batch, math.MaxInt32)
+	}
+	manifestBatch.Store(int32(batch))
+	return nil
+}
+
+// EffectiveManifestBatch is the number of data chunks MaybeManifestize merges into each manifest chunk
+func EffectiveManifestBatch() int {
+	return int(manifestBatch.Load())
+}
+
+// DeduplicateManifestChunks drops repeated chunks with the same file id, offset and size
+// from resolved manifests. Such duplicates are logged either way.
+var DeduplicateManifestChunks = false
+
+// VerifyManifestETag checks fetched manifests against the md5 of their ETag, in addition to their size and checksum.
+// Compressed or encrypted manifests are not checked, since the ETag is the md5 of the body as stored.
+var VerifyManifestETag = false
+
+// ManifestResolveConcurrency is the number of manifest chunks fetched at the same time when resolving the chunks of a file
+var ManifestResolveConcurrency = 8
+
+// ManifestizeConcurrency is the number of manifest chunks saved at the same time when merging the chunks of a file.
+// Above 1, the save functions are called concurrently, so they must be safe for concurrent use, as must
+// ManifestCreatedHook and the other hooks called while merging. 1, the default, saves them one by one.
+var ManifestizeConcurrency = 1
+
+// MaxPooledBufferCapacity is the largest capacity of a buffer put back into bytesBufferPool.
+// Larger buffers, e.g. after fetching a big manifest, are dropped so the pool does not keep them alive.
+var MaxPooledBufferCapacity = 4 * 1024 * 1024
+
 var bytesBufferPool = sync.Pool{
 	New: func() interface{} {
 		return new(bytes.Buffer)
 	},
 }
 
+func putBytesBuffer(bytesBuffer *bytes.Buffer) {
+	if bytesBuffer.Cap() > MaxPooledBufferCapacity {
+		return
+	}
+	bytesBufferPool.Put(bytesBuffer)
+}
+
 func HasChunkManifest(chunks []*filer_pb.FileChunk) bool {
 	for _, chunk := range chunks {
 		if chunk.IsChunkManifest {
@@ -49,212 +110,1236 @@ func SeparateManifestChunks(chunks []*filer_pb.FileChunk) (manifestChunks, nonMa
 	return
 }
 
-func ResolveChunkManifest(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, startOffset, stopOffset int64) (dataChunks, manifestChunks []*filer_pb.FileChunk, manifestResolveErr error) {
-	// TODO maybe parallel this
+// HasChunkManifestInEntry is HasChunkManifest of the chunks of the entry, false for a nil entry
+func HasChunkManifestInEntry(entry *filer_pb.Entry) bool {
+	return HasChunkManifest(entry.GetChunks())
+}
+
+// SeparateEntryChunks is SeparateManifestChunks of the chunks of the entry, empty for a nil entry
+func SeparateEntryChunks(entry *filer_pb.Entry) (manifestChunks, nonManifestChunks []*filer_pb.FileChunk) {
+	return SeparateManifestChunks(entry.GetChunks())
+}
+
+// SummarizeChunks counts the manifest and data chunks, and sizes the file from the ranges they cover,
+// without fetching any manifest. totalLogicalSize is the bytes covered by the chunks, counting overlaps once
+// and skipping holes. maxOffsetEnd is the end of the furthest chunk, as TotalSize.
+func SummarizeChunks(chunks []*filer_pb.FileChunk) (manifestCount, dataCount int, totalLogicalSize uint64, maxOffsetEnd int64) {
+	sorted := make([]*filer_pb.FileChunk, 0, len(chunks))
+	for _, c := range chunks {
+		if c.IsChunkManifest {
+			manifestCount++
+		} else {
+			dataCount++
+		}
+		if c.Size > 0 {
+			sorted = append(sorted, c)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+	for _, c := range sorted {
+		start, stop := c.Offset, c.Offset+int64(c.Size)
+		if start < maxOffsetEnd {
+			start = maxOffsetEnd
+		}
+		if stop > start {
+			totalLogicalSize += uint64(stop - start)
+		}
+		if stop > maxOffsetEnd {
+			maxOffsetEnd = stop
+		}
+	}
+	return
+}
+
+// MaxModifiedTsNs returns the latest modification time of the chunks, which is the
+// last-modified time of the file. Manifest chunks carry the latest modification time
+// of their content, so no manifest needs to be fetched.
+// Manifests written before this was recorded have ModifiedTsNs 0;
+// use ResolveMaxModifiedTsNs to also cover them.
+func MaxModifiedTsNs(chunks []*filer_pb.FileChunk) (tsNs int64) {
 	for _, chunk := range chunks {
+		if tsNs < chunk.ModifiedTsNs {
+			tsNs = chunk.ModifiedTsNs
+		}
+	}
+	return
+}
 
-		if max(chunk.Offset, startOffset) >= min(chunk.Offset+int64(chunk.Size), stopOffset) {
+// ResolveMaxModifiedTsNs is like MaxModifiedTsNs, but resolves the manifest chunks
+// that do not carry a modification time.
+func ResolveMaxModifiedTsNs(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk) (tsNs int64, err error) {
+	for _, chunk := range chunks {
+		if chunk.IsChunkManifest && chunk.ModifiedTsNs == 0 {
+			resolvedChunks, resolveErr := ResolveOneChunkManifest(lookupFileIdFn, chunk)
+			if resolveErr != nil {
+				return 0, resolveErr
+			}
+			subTsNs, subErr := ResolveMaxModifiedTsNs(lookupFileIdFn, resolvedChunks)
+			if subErr != nil {
+				return 0, subErr
+			}
+			tsNs = max(tsNs, subTsNs)
 			continue
 		}
+		tsNs = max(tsNs, chunk.ModifiedTsNs)
+	}
+	return
+}
 
-		if !chunk.IsChunkManifest {
+// ChunksExtent is the file range covered by a list of chunks, and its latest modification time
+type ChunksExtent struct {
+	StartOffset  int64
+	StopOffset   int64
+	ModifiedTsNs int64
+}
+
+// UnverifiedChunksExtent computes the extent from the top-level chunks only, trusting the offset,
+// size and modification time recorded on manifest chunks. No manifest is fetched, so this is
+// cheap enough for stat and listing. Use VerifiedChunksExtent when the answer must match the data chunks.
+func UnverifiedChunksExtent(chunks []*filer_pb.FileChunk) (extent ChunksExtent) {
+	for i, chunk := range chunks {
+		if i == 0 || chunk.Offset < extent.StartOffset {
+			extent.StartOffset = chunk.Offset
+		}
+		extent.StopOffset = max(extent.StopOffset, chunk.Offset+int64(chunk.Size))
+		extent.ModifiedTsNs = max(extent.ModifiedTsNs, chunk.ModifiedTsNs)
+	}
+	return
+}
+
+// VerifiedChunksExtent resolves all manifests and computes the extent from the data chunks.
+func VerifiedChunksExtent(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk) (extent ChunksExtent, err error) {
+	dataChunks, _, err := ResolveChunkManifestAll(lookupFileIdFn, chunks)
+	if err != nil {
+		return
+	}
+	return UnverifiedChunksExtent(dataChunks), nil
+}
+
+// ResolveChunkManifest resolves the manifest chunks overlapping [startOffset, stopOffset) into data chunks,
+// keeping the chunk order. The manifests, including nested ones, are fetched in parallel,
+// with at most ManifestResolveConcurrency fetches in flight.
+// Chunks of size 0 overlap no range, so they are left out, see ResolveChunkManifestIncludingEmpty.
+// The resolved data chunks are passed to DataChunkResolvedHook.
+func ResolveChunkManifest(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, startOffset, stopOffset int64) (dataChunks, manifestChunks []*filer_pb.FileChunk, manifestResolveErr error) {
+	dataChunks, manifestChunks, manifestResolveErr = resolveChunkManifest(lookupFileIdFn, chunks, startOffset, stopOffset)
+	if manifestResolveErr == nil {
+		notifyDataChunksResolved(dataChunks)
+	}
+	return
+}
+
+// DataChunkResolvedHook, when set, is called for each data chunk resolved by ResolveChunkManifest, in offset order,
+// which is the order a sequential read fetches them, e.g. for a cache to prefetch the chunks.
+// It is called on the read path, so it should return quickly.
+var DataChunkResolvedHook func(fileId string, offset int64, size uint64)
+
+func notifyDataChunksResolved(dataChunks []*filer_pb.FileChunk) {
+	hook := DataChunkResolvedHook
+	if hook == nil {
+		return
+	}
+	sorted := make([]*filer_pb.FileChunk, len(dataChunks))
+	copy(sorted, dataChunks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+	for _, chunk := range sorted {
+		hook(chunk.GetFileIdString(), chunk.Offset, chunk.Size)
+	}
+}
+
+func resolveChunkManifest(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, startOffset, stopOffset int64) (dataChunks, manifestChunks []*filer_pb.FileChunk, manifestResolveErr error) {
+	if !HasChunkManifest(chunks) {
+		// most files, without the setup of the walk
+		return overlappingChunks(chunks, startOffset, stopOffset), nil, nil
+	}
+	err := walkChunkManifest(lookupFileIdFn, chunks, startOffset, stopOffset, func(chunk *filer_pb.FileChunk) bool {
+		if chunk.IsChunkManifest {
+			manifestChunks = append(manifestChunks, chunk)
+		} else {
 			dataChunks = append(dataChunks, chunk)
-			continue
 		}
+		return true
+	})
+	if err != nil {
+		return dataChunks, nil, err
+	}
+	return
+}
 
-		resolvedChunks, err := ResolveOneChunkManifest(lookupFileIdFn, chunk)
-		if err != nil {
-			return dataChunks, nil, err
+func overlappingChunks(chunks []*filer_pb.FileChunk, startOffset, stopOffset int64) (overlapping []*filer_pb.FileChunk) {
+	for _, chunk := range chunks {
+		if max(chunk.Offset, startOffset) < min(chunk.Offset+int64(chunk.Size), stopOffset) {
+			overlapping = append(overlapping, chunk)
 		}
+	}
+	return
+}
 
-		manifestChunks = append(manifestChunks, chunk)
-		// recursive
-		subDataChunks, subManifestChunks, subErr := ResolveChunkManifest(lookupFileIdFn, resolvedChunks, startOffset, stopOffset)
-		if subErr != nil {
-			return dataChunks, nil, subErr
+// ResolveChunkManifestIncludingEmpty resolves the chunks like ResolveChunkManifest, but also returns the chunks
+// of size 0 at offsets within [startOffset, stopOffset), e.g. to verify the metadata of a file.
+// The manifest chunks of size 0 are returned among the manifest chunks, without being resolved.
+func ResolveChunkManifestIncludingEmpty(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, startOffset, stopOffset int64) (dataChunks, manifestChunks []*filer_pb.FileChunk, manifestResolveErr error) {
+	walker := newManifestWalker(lookupFileIdFn, startOffset, stopOffset, func(chunk *filer_pb.FileChunk) bool {
+		if chunk.IsChunkManifest {
+			manifestChunks = append(manifestChunks, chunk)
+		} else {
+			dataChunks = append(dataChunks, chunk)
 		}
-		dataChunks = append(dataChunks, subDataChunks...)
-		manifestChunks = append(manifestChunks, subManifestChunks...)
+		return true
+	})
+	walker.includeEmpty = true
+	if _, err := walker.walk(chunks, nil); err != nil {
+		return dataChunks, nil, err
 	}
 	return
 }
 
+// ResolveChunkManifestAll resolves all the manifest chunks of the file, like ResolveChunkManifest over the whole file
+// range, without checking each chunk against the range. Use it when the complete chunk list is needed.
+func ResolveChunkManifestAll(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk) (dataChunks, manifestChunks []*filer_pb.FileChunk, manifestResolveErr error) {
+	walker := newManifestWalker(lookupFileIdFn, 0, math.MaxInt64, func(chunk *filer_pb.FileChunk) bool {
+		if chunk.IsChunkManifest {
+			manifestChunks = append(manifestChunks, chunk)
+		} else {
+			dataChunks = append(dataChunks, chunk)
+		}
+		return true
+	})
+	walker.all = true
+	if _, err := walker.walk(chunks, nil); err != nil {
+		return dataChunks, nil, err
+	}
+	return
+}
+
+// ManifestResolveError reports a manifest chunk that could not be resolved, and the file range it covers
+type ManifestResolveError struct {
+	FileId string
+	Offset int64
+	Size   uint64
+	Err    error
+}
+
+func (e *ManifestResolveError) Error() string {
+	return fmt.Sprintf("manifest %s for [%d,%d): %v", e.FileId, e.Offset, e.Offset+int64(e.Size), e.Err)
+}
+
+func (e *ManifestResolveError) Unwrap() error {
+	return e.Err
+}
+
+// ResolveChunkManifestBestEffort resolves the chunks like ResolveChunkManifest, but skips the manifests
+// failing to resolve, and returns a *ManifestResolveError for each of them,
+// so the readable parts of a file with partly lost metadata can be salvaged.
+func ResolveChunkManifestBestEffort(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, startOffset, stopOffset int64) (dataChunks, manifestChunks []*filer_pb.FileChunk, errs []error) {
+	w := newManifestWalker(lookupFileIdFn, startOffset, stopOffset, func(chunk *filer_pb.FileChunk) bool {
+		if chunk.IsChunkManifest {
+			manifestChunks = append(manifestChunks, chunk)
+		} else {
+			dataChunks = append(dataChunks, chunk)
+		}
+		return true
+	})
+	w.onError = func(chunk *filer_pb.FileChunk, err error) {
+		glog.Warningf("skip manifest %s: %v", chunk.GetFileIdString(), err)
+		errs = append(errs, &ManifestResolveError{
+			FileId: chunk.GetFileIdString(),
+			Offset: chunk.Offset,
+			Size:   chunk.Size,
+			Err:    err,
+		})
+	}
+	w.walk(chunks, nil)
+	return
+}
+
+// ExportResolvedManifest resolves the whole manifest tree into a flat list of data chunks.
+// The list can be persisted, e.g. as a FileChunkManifest, and read later with StreamResolvedContent,
+// which skips all manifest fetches.
+func ExportResolvedManifest(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk) ([]*filer_pb.FileChunk, error) {
+	dataChunks, _, err := ResolveChunkManifestAll(lookupFileIdFn, chunks)
+	if err != nil {
+		return nil, err
+	}
+	return cloneChunks(dataChunks), nil
+}
+
+// ExpandChunkManifests replaces the manifest chunks with the data chunks they contain, nested manifests included,
+// e.g. to migrate a file to a filer that does not read manifests. Chunks without any manifest are returned as is.
+func ExpandChunkManifests(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk) ([]*filer_pb.FileChunk, error) {
+	if !HasChunkManifest(chunks) {
+		return chunks, nil
+	}
+	return ExportResolvedManifest(lookupFileIdFn, chunks)
+}
+
+// ChunkWithLocations is a resolved data chunk with the urls to read it from.
+type ChunkWithLocations struct {
+	Chunk *filer_pb.FileChunk
+	Urls  []string
+}
+
+// ResolveChunkManifestWithLocations resolves the data chunks like ResolveChunkManifest and looks up
+// each chunk once, so callers can fetch the chunks their own way without calling lookupFileIdFn again.
+func ResolveChunkManifestWithLocations(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, startOffset, stopOffset int64) ([]*ChunkWithLocations, error) {
+	dataChunks, _, err := ResolveChunkManifest(lookupFileIdFn, chunks, startOffset, stopOffset)
+	if err != nil {
+		return nil, err
+	}
+	fileId2Urls := make(map[string][]string)
+	var located []*ChunkWithLocations
+	for _, chunk := range dataChunks {
+		fileId := chunk.GetFileIdString()
+		urls, found := fileId2Urls[fileId]
+		if !found {
+			urls, err = lookupFileIdFn(fileId)
+			if err != nil {
+				return nil, fmt.Errorf("lookup %s: %v", fileId, err)
+			}
+			fileId2Urls[fileId] = urls
+		}
+		located = append(located, &ChunkWithLocations{
+			Chunk: chunk,
+			Urls:  urls,
+		})
+	}
+	return located, nil
+}
+
+// concurrent resolutions of the same manifest share one fetch
+var manifestResolveGroup singleflight.Group
+
+// ErrEmptyManifest tells a manifest chunk of size 0, or with an empty body, which means the entry is suspect:
+// the data chunks of the manifest may have been lost.
+var ErrEmptyManifest = errors.New("empty manifest")
+
+// MaxManifestChunks is the most chunks one manifest may list. Larger manifests are refused with
+// ErrManifestTooLarge before being unmarshalled, instead of taking the memory of millions of chunks.
+var MaxManifestChunks = 1000000
+
+// ErrManifestTooLarge tells a manifest listing more than MaxManifestChunks chunks
+var ErrManifestTooLarge = errors.New("manifest too large")
+
+// RejectNonContiguousManifests makes merging chunks with gaps or overlaps into a manifest fail with
+// ErrNonContiguousManifest, leaving them unmerged, instead of only logging them. Off by default.
+var RejectNonContiguousManifests = false
+
+// ErrNonContiguousManifest tells chunks with gaps or overlaps refused by RejectNonContiguousManifests
+var ErrNonContiguousManifest = errors.New("non contiguous manifest")
+
+// the gaps and overlaps logged as a warning, all of them are logged at verbosity 1
+const maxLoggedContiguityIssues = 3
+
+// countManifestChunks counts the chunks listed by a serialized manifest, without unmarshalling them
+func countManifestChunks(data []byte) (count int, err error) {
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return count, protowire.ParseError(n)
+		}
+		data = data[n:]
+		if number == 1 && wireType == protowire.BytesType {
+			count++
+		}
+		n = protowire.ConsumeFieldValue(number, wireType, data)
+		if n < 0 {
+			return count, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return count, nil
+}
+
 func ResolveOneChunkManifest(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunk *filer_pb.FileChunk) (dataChunks []*filer_pb.FileChunk, manifestResolveErr error) {
 	if !chunk.IsChunkManifest {
 		return
 	}
+	return resolveOneChunkManifest(lookupFileIdFn, chunk, chunk.GetFileIdString(), fetchOneChunkManifestFromOwner)
+}
+
+// resolveOneChunkManifest resolves the manifest from the cache, or with fetch shared by the callers of the same key
+func resolveOneChunkManifest(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunk *filer_pb.FileChunk, key string, fetch func(wdclient.LookupFileIdFunctionType, *filer_pb.FileChunk) ([]*filer_pb.FileChunk, error)) (dataChunks []*filer_pb.FileChunk, manifestResolveErr error) {
+	if chunk.Size == 0 {
+		glog.Warningf("manifest %s at offset %d has size 0", chunk.GetFileIdString(), chunk.Offset)
+		return nil, fmt.Errorf("%w: %s has size 0", ErrEmptyManifest, chunk.GetFileIdString())
+	}
+
+	cache := resolvedManifests.Load()
+	if cached, found := cache.get(chunk.GetFileIdString()); found {
+		return cached, nil
+	}
+
+	resolved, err, shared := manifestResolveGroup.Do(key, func() (interface{}, error) {
+		dataChunks, err := fetch(lookupFileIdFn, chunk)
+		if err == nil {
+			cache.set(chunk.GetFileIdString(), dataChunks)
+		}
+		return dataChunks, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	dataChunks = resolved.([]*filer_pb.FileChunk)
+	if shared {
+		// each caller owns its chunks
+		dataChunks = cloneChunks(dataChunks)
+	}
+	return dataChunks, nil
+}
+
+func cloneChunks(chunks []*filer_pb.FileChunk) (cloned []*filer_pb.FileChunk) {
+	cloned = make([]*filer_pb.FileChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		cloned = append(cloned, proto.Clone(chunk).(*filer_pb.FileChunk))
+	}
+	return
+}
+
+// ResolveOneChunkManifestWithBuffer resolves the manifest like ResolveOneChunkManifest, but reads it into bytesBuffer
+// and unmarshals it into manifest, so a loop resolving many manifests recycles both across calls.
+// The returned chunks share the backing array of manifest.Chunks, which the next call reusing manifest overwrites.
+// Concurrent resolutions of the same manifest are not shared.
+func ResolveOneChunkManifestWithBuffer(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunk *filer_pb.FileChunk, bytesBuffer *bytes.Buffer, manifest *filer_pb.FileChunkManifest) (dataChunks []*filer_pb.FileChunk, manifestResolveErr error) {
+	if !chunk.IsChunkManifest {
+		return
+	}
+	bytesBuffer.Reset()
+	return decodeOneChunkManifest(lookupFileIdFn, chunk, bytesBuffer, manifest)
+}
 
+// DumpRawManifest streams the protobuf of a manifest chunk to the writer, without unmarshalling it,
+// e.g. to save a manifest for debugging. The content is decrypted and decompressed like when resolving it.
+// Data already written is not rewritten when a read is retried on another replica.
+func DumpRawManifest(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunk *filer_pb.FileChunk, writer io.Writer) error {
+	if !chunk.IsChunkManifest {
+		return fmt.Errorf("%s is not a manifest chunk", chunk.GetFileIdString())
+	}
+	readFlow := NewReadFlow(ReadSourceManifest)
+	urlStrings, err := lookupChunkUrls(context.Background(), lookupFileIdFn, chunk.GetFileIdString(), 0, readFlow)
+	if err != nil {
+		return err
+	}
+	if ChunkCompressionCodec(chunk) != CompressionGzip || len(chunk.CipherKey) > 0 {
+		if _, err := retriedStreamFetchChunkDataWithContext(context.Background(), writer, urlStrings, chunk.CipherKey, ChunkCompressionCodec(chunk), true, 0, 0, readFlow); err != nil {
+			return fmt.Errorf("fail to read manifest %s: %v", chunk.GetFileIdString(), err)
+		}
+		return nil
+	}
+	// a body compressed by the filer is only known to be compressed once fetched
+	var body bytes.Buffer
+	if _, err := retriedStreamFetchChunkDataWithContext(context.Background(), &body, urlStrings, chunk.CipherKey, CompressionGzip, true, 0, 0, readFlow); err != nil {
+		return fmt.Errorf("fail to read manifest %s: %v", chunk.GetFileIdString(), err)
+	}
+	reader, _, err := manifestBodyReader(chunk, body.Bytes())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(writer, reader); err != nil {
+		return fmt.Errorf("manifest %s: %v", chunk.GetFileIdString(), err)
+	}
+	return nil
+}
+
+func fetchOneChunkManifest(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunk *filer_pb.FileChunk) (dataChunks []*filer_pb.FileChunk, manifestResolveErr error) {
 	// IsChunkManifest
 	bytesBuffer := bytesBufferPool.Get().(*bytes.Buffer)
 	bytesBuffer.Reset()
-	defer bytesBufferPool.Put(bytesBuffer)
-	err := fetchWholeChunk(bytesBuffer, lookupFileIdFn, chunk.GetFileIdString(), chunk.CipherKey, chunk.IsCompressed)
+	defer putBytesBuffer(bytesBuffer)
+	return decodeOneChunkManifest(lookupFileIdFn, chunk, bytesBuffer, &filer_pb.FileChunkManifest{})
+}
+
+func decodeOneChunkManifest(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunk *filer_pb.FileChunk, bytesBuffer *bytes.Buffer, m *filer_pb.FileChunkManifest) (dataChunks []*filer_pb.FileChunk, manifestResolveErr error) {
+	err := fetchWholeChunkWithContext(context.Background(), bytesBuffer, lookupFileIdFn, chunk.GetFileIdString(), chunk.CipherKey, ChunkCompressionCodec(chunk), NewReadFlow(ReadSourceManifest))
+	if err != nil {
+		return nil, fmt.Errorf("fail to read manifest %s: %w", chunk.GetFileIdString(), err)
+	}
+	body, err := gunzipManifestBody(chunk, bytesBuffer)
 	if err != nil {
-		return nil, fmt.Errorf("fail to read manifest %s: %v", chunk.GetFileIdString(), err)
+		return nil, err
+	}
+	if body != bytesBuffer {
+		defer putBytesBuffer(body)
 	}
+	if body.Len() == 0 {
+		glog.Warningf("manifest %s covering [%d,%d) has an empty body", chunk.GetFileIdString(), chunk.Offset, chunk.Offset+int64(chunk.Size))
+		return nil, fmt.Errorf("%w: %s has an empty body", ErrEmptyManifest, chunk.GetFileIdString())
+	}
+	if err := verifyManifestData(chunk, body.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := VerifyChunkChecksum(chunk.GetFileIdString(), chunk.ChecksumAlgorithm, chunk.Checksum, body.Bytes()); err != nil {
+		return nil, fmt.Errorf("fail to read manifest: %v", err)
+	}
+	if err := parseChunkManifest(body.Bytes(), m); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", chunk.GetFileIdString(), err)
+	}
+	assertManifestChunks("ResolveOneChunkManifest "+chunk.GetFileIdString(), m.Chunks)
+	return deduplicateManifestChunks(chunk.GetFileIdString(), m.Chunks), nil
+}
+
+// ParseChunkManifest unmarshals a manifest body already in memory, e.g. read from a backup, into the chunks it lists.
+// Nested manifest chunks are returned as they are, without being resolved.
+func ParseChunkManifest(data []byte) ([]*filer_pb.FileChunk, error) {
 	m := &filer_pb.FileChunkManifest{}
-	if err := proto.Unmarshal(bytesBuffer.Bytes(), m); err != nil {
-		return nil, fmt.Errorf("fail to unmarshal manifest %s: %v", chunk.GetFileIdString(), err)
+	if err := parseChunkManifest(data, m); err != nil {
+		return nil, err
 	}
+	return m.Chunks, nil
+}
 
-	// recursive
+// SerializeChunkManifest builds the body of a manifest listing the chunks, at the current ManifestVersion,
+// the reverse of ParseChunkManifest. Like for entries, the file ids of the chunks are first converted
+// in place to their compact form by filer_pb.BeforeEntrySerialization.
+func SerializeChunkManifest(chunks []*filer_pb.FileChunk) ([]byte, error) {
+	filer_pb.BeforeEntrySerialization(chunks)
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks:  chunks,
+		Version: ManifestVersion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("serializing manifest: %v", err)
+	}
+	return data, nil
+}
+
+// parseChunkManifest is ParseChunkManifest into m, reusing the backing array of its chunks
+func parseChunkManifest(data []byte, m *filer_pb.FileChunkManifest) error {
+	// a malformed manifest is reported by the unmarshalling
+	if count, err := countManifestChunks(data); err == nil && count > MaxManifestChunks {
+		return fmt.Errorf("%w: lists %d chunks, at most %d allowed", ErrManifestTooLarge, count, MaxManifestChunks)
+	}
+	// keep the backing array of the chunks, since merging appends to it
+	chunks := m.Chunks[:0]
+	proto.Reset(m)
+	m.Chunks = chunks
+	if err := (proto.UnmarshalOptions{Merge: true}).Unmarshal(data, m); err != nil {
+		return fmt.Errorf("fail to unmarshal manifest: %v", err)
+	}
+	if m.Version > ManifestVersion {
+		return fmt.Errorf("unsupported manifest version %d, supported up to %d", m.Version, ManifestVersion)
+	}
 	filer_pb.AfterEntryDeserialization(m.Chunks)
-	return m.Chunks, nil
+	return nil
+}
+
+// verifyManifestData checks the fetched manifest has the recorded size, and with VerifyManifestETag
+// the md5 of its ETag, so a truncated or corrupted manifest is reported as such instead of failing to unmarshal.
+func verifyManifestData(chunk *filer_pb.FileChunk, data []byte) error {
+	if chunk.ManifestSize > 0 && uint64(len(data)) != chunk.ManifestSize {
+		return fmt.Errorf("manifest %s: expected %d bytes got %d", chunk.GetFileIdString(), chunk.ManifestSize, len(data))
+	}
+	if !VerifyManifestETag || chunk.IsCompressed || len(chunk.CipherKey) > 0 {
+		// the ETag of a compressed or encrypted body is not the md5 of the decoded manifest
+		return nil
+	}
+	if expected := util.Base64Md5ToBytes(chunk.ETag); len(expected) == md5.Size {
+		if actual := md5.Sum(data); !bytes.Equal(expected, actual[:]) {
+			return fmt.Errorf("manifest %s: md5 %x does not match etag %x", chunk.GetFileIdString(), actual, expected)
+		}
+	}
+	return nil
 }
 
-// TODO fetch from cache for weed mount?
-func fetchWholeChunk(bytesBuffer *bytes.Buffer, lookupFileIdFn wdclient.LookupFileIdFunctionType, fileId string, cipherKey []byte, isGzipped bool) error {
-	urlStrings, err := lookupFileIdFn(fileId)
+// manifestBodyReader reads a manifest body fetched as stored, decompressing it on the fly when gzipped.
+// The volume servers send it as is, since only the filer compressed it, while an encrypted body is already
+// decompressed after decrypting it. A manifest never starts with the gzip magic, which is not a valid protobuf tag.
+func manifestBodyReader(chunk *filer_pb.FileChunk, data []byte) (reader io.Reader, isGzipped bool, err error) {
+	if ChunkCompressionCodec(chunk) != CompressionGzip || len(chunk.CipherKey) > 0 || !util.IsGzippedContent(data) {
+		return bytes.NewReader(data), false, nil
+	}
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
 	if err != nil {
-		glog.Errorf("operation LookupFileId %s failed, err: %v", fileId, err)
-		return err
+		return nil, true, fmt.Errorf("manifest %s: %v", chunk.GetFileIdString(), err)
+	}
+	return gzipReader, true, nil
+}
+
+// gunzipManifestBody decompresses a gzip manifest body fetched as stored straight into a pooled buffer, sized by
+// the manifest size when known, and returns it in place of bytesBuffer, so the body is held once compressed and
+// once decompressed, and never copied back. The caller puts the returned buffer back unless it is bytesBuffer.
+func gunzipManifestBody(chunk *filer_pb.FileChunk, bytesBuffer *bytes.Buffer) (*bytes.Buffer, error) {
+	reader, isGzipped, err := manifestBodyReader(chunk, bytesBuffer.Bytes())
+	if err != nil || !isGzipped {
+		return bytesBuffer, err
 	}
-	err = retriedStreamFetchChunkData(bytesBuffer, urlStrings, cipherKey, isGzipped, true, 0, 0)
+	body := bytesBufferPool.Get().(*bytes.Buffer)
+	body.Reset()
+	if chunk.ManifestSize > 0 && chunk.ManifestSize <= uint64(MaxPooledBufferCapacity) {
+		body.Grow(int(chunk.ManifestSize))
+	}
+	if _, err := io.Copy(body, reader); err != nil {
+		putBytesBuffer(body)
+		return bytesBuffer, fmt.Errorf("manifest %s: %v", chunk.GetFileIdString(), err)
+	}
+	return body, nil
+}
+
+func deduplicateManifestChunks(manifestFileId string, chunks []*filer_pb.FileChunk) []*filer_pb.FileChunk {
+	type chunkKey struct {
+		fileId string
+		offset int64
+		size   uint64
+	}
+	seen := make(map[chunkKey]struct{}, len(chunks))
+	deduplicated := make([]*filer_pb.FileChunk, 0, len(chunks))
+	var duplicates int
+	for _, c := range chunks {
+		key := chunkKey{c.GetFileIdString(), c.Offset, c.Size}
+		if _, found := seen[key]; found {
+			duplicates++
+			if DeduplicateManifestChunks {
+				continue
+			}
+		}
+		seen[key] = struct{}{}
+		deduplicated = append(deduplicated, c)
+	}
+	if duplicates == 0 {
+		return chunks
+	}
+	glog.Warningf("manifest %s lists %d duplicated chunks, deduplicate: %v", manifestFileId, duplicates, DeduplicateManifestChunks)
+	return deduplicated
+}
+
+// DeduplicateDataChunks post-processes the data chunks resolved from several manifests, so that no chunk is fetched
+// for nothing. It drops the repeated chunks with the same file id, offset and size, keeping the first one, and
+// the chunks whose whole range is overwritten by chunks modified later. Chunks partly overwritten are kept.
+func DeduplicateDataChunks(dataChunks []*filer_pb.FileChunk) ([]*filer_pb.FileChunk, error) {
+	if HasChunkManifest(dataChunks) {
+		return nil, fmt.Errorf("deduplicate unresolved manifest chunks")
+	}
+	type chunkKey struct {
+		fileId string
+		offset int64
+		size   uint64
+	}
+	seen := make(map[chunkKey]struct{}, len(dataChunks))
+	unique := make([]*filer_pb.FileChunk, 0, len(dataChunks))
+	for _, c := range dataChunks {
+		key := chunkKey{c.GetFileIdString(), c.Offset, c.Size}
+		if _, found := seen[key]; found {
+			continue
+		}
+		seen[key] = struct{}{}
+		unique = append(unique, c)
+	}
+	visibles, err := NonOverlappingVisibleIntervals(nil, unique, 0, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	deduplicated, _ := SeparateGarbageChunks(visibles, unique)
+	return deduplicated, nil
+}
+
+func fetchWholeChunk(bytesBuffer *bytes.Buffer, lookupFileIdFn wdclient.LookupFileIdFunctionType, fileId string, cipherKey []byte, isGzipped bool, flow *ReadFlow) error {
+	return fetchWholeChunkWithContext(context.Background(), bytesBuffer, lookupFileIdFn, fileId, cipherKey, gzipCodec(isGzipped), flow)
+}
+
+// fetchWholeChunkWithContext is fetchWholeChunk giving up, without waiting for the retries, once the context is done
+// The content is decompressed according to the codec.
+func fetchWholeChunkWithContext(ctx context.Context, bytesBuffer *bytes.Buffer, lookupFileIdFn wdclient.LookupFileIdFunctionType, fileId string, cipherKey []byte, codec CompressionCodec, flow *ReadFlow) error {
+	fetchedChunkCache := FetchedChunkCache
+	if fetchedChunkCache != nil {
+		if data, found := fetchedChunkCache.Get(fileId); found {
+			bytesBuffer.Write(data)
+			return nil
+		}
+	}
+	if data := LocalChunkCache.GetChunk(fileId); data != nil {
+		bytesBuffer.Write(data)
+		return nil
+	}
+	urlStrings, err := lookupChunkUrls(ctx, lookupFileIdFn, fileId, 0, flow)
 	if err != nil {
 		return err
 	}
+	start := bytesBuffer.Len()
+	_, err = retriedStreamFetchChunkDataWithContext(ctx, bytesBuffer, urlStrings, cipherKey, codec, true, 0, 0, flow)
+	if err != nil && errors.Is(err, gzip.ErrHeader) {
+		// flagged as gzip when written, e.g. by an older version, but stored as is
+		glog.Warningf("chunk %s is not gzip compressed as flagged, read it as is: %v", fileId, err)
+		bytesBuffer.Truncate(start)
+		_, err = retriedStreamFetchChunkDataWithContext(ctx, bytesBuffer, urlStrings, cipherKey, CompressionNone, true, 0, 0, flow.withIdentityEncoding())
+	}
+	if err != nil {
+		return fetchError(fileId, cipherKey, codec, err)
+	}
+	LocalChunkCache.SetChunk(fileId, bytesBuffer.Bytes()[start:])
+	if fetchedChunkCache != nil {
+		fetchedChunkCache.Set(fileId, bytesBuffer.Bytes()[start:])
+	}
 	return nil
 }
 
-func fetchChunkRange(buffer []byte, lookupFileIdFn wdclient.LookupFileIdFunctionType, fileId string, cipherKey []byte, isGzipped bool, offset int64) (int, error) {
-	urlStrings, err := lookupFileIdFn(fileId)
+func fetchChunkRange(buffer []byte, lookupFileIdFn wdclient.LookupFileIdFunctionType, fileId string, cipherKey []byte, isGzipped bool, offset int64, flow *ReadFlow) (int, error) {
+	return fetchChunkRangeWithContext(context.Background(), buffer, lookupFileIdFn, fileId, cipherKey, gzipCodec(isGzipped), offset, len(buffer), flow)
+}
+
+// fetchChunkRangeLength is fetchChunkRange reading only length bytes into the start of the buffer,
+// so a large scratch buffer does not make the volume server send more than needed
+func fetchChunkRangeLength(buffer []byte, lookupFileIdFn wdclient.LookupFileIdFunctionType, fileId string, cipherKey []byte, isGzipped bool, offset int64, length int, flow *ReadFlow) (int, error) {
+	return fetchChunkRangeWithContext(context.Background(), buffer, lookupFileIdFn, fileId, cipherKey, gzipCodec(isGzipped), offset, length, flow)
+}
+
+// fetchChunkRangeWithContext is fetchChunkRangeLength giving up, without waiting for the retries, once the context is done.
+// A length outside of (0, len(buffer)] reads len(buffer) bytes.
+// If the chunk ends before reading length bytes, the bytes read are returned with an error wrapping io.ErrUnexpectedEOF.
+func fetchChunkRangeWithContext(ctx context.Context, buffer []byte, lookupFileIdFn wdclient.LookupFileIdFunctionType, fileId string, cipherKey []byte, codec CompressionCodec, offset int64, length int, flow *ReadFlow) (int, error) {
+	if length > 0 && length < len(buffer) {
+		buffer = buffer[:length]
+	}
+	if n, _ := LocalChunkCache.ReadChunkAt(buffer, fileId, uint64(offset)); n == len(buffer) {
+		return n, nil
+	}
+	urlStrings, err := lookupChunkUrls(ctx, lookupFileIdFn, fileId, int64(len(buffer)), flow)
 	if err != nil {
-		glog.Errorf("operation LookupFileId %s failed, err: %v", fileId, err)
 		return 0, err
 	}
-	return retriedFetchChunkData(buffer, urlStrings, cipherKey, isGzipped, false, offset)
+	n, err := retriedFetchChunkDataWithContext(ctx, buffer, urlStrings, cipherKey, codec, false, offset, flow)
+	if err != nil {
+		return n, fetchError(fileId, cipherKey, codec, err)
+	}
+	if n < len(buffer) {
+		err = fmt.Errorf("chunk %s ends after %d of %d bytes at offset %d: %w", fileId, n, len(buffer), offset, io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
+
+// lookupChunkUrls looks up the locations of the chunk, and looks up again, with the backoff of the retry policy,
+// while there is none, e.g. when the volume is not registered with the master yet
+func lookupChunkUrls(ctx context.Context, lookupFileIdFn wdclient.LookupFileIdFunctionType, fileId string, size int64, flow *ReadFlow) ([]string, error) {
+	policy := flow.retryPolicy(ctx, size)
+	for rounds, waitTime := 1, policy.InitialWait; ; rounds, waitTime = rounds+1, policy.nextWait(waitTime) {
+		urlStrings, err := lookupFileIdFn(fileId)
+		if err != nil {
+			glog.Errorf("operation LookupFileId %s failed, err: %v", fileId, err)
+			return nil, err
+		}
+		if len(urlStrings) > 0 {
+			return urlStrings, nil
+		}
+		wait := policy.jittered(waitTime)
+		if waitTime >= policy.MaxWait || policy.exhausted(rounds) || flow.expired(wait) {
+			glog.Errorf("no locations for %s after %d lookups", fileId, rounds)
+			return nil, fmt.Errorf("no locations for fileId %s", fileId)
+		}
+		glog.V(1).Infof("no locations for %s, lookup again in %v", fileId, wait)
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fetchError tells which chunk failed to be fetched, and how it is stored, e.g. to spot a cipher key mismatch
+func fetchError(fileId string, cipherKey []byte, codec CompressionCodec, err error) error {
+	return fmt.Errorf("fetch %s (encrypted=%v compressed=%v): %w", fileId, len(cipherKey) > 0, codec != CompressionNone, err)
 }
 
-func retriedFetchChunkData(buffer []byte, urlStrings []string, cipherKey []byte, isGzipped bool, isFullChunk bool, offset int64) (n int, err error) {
+// readUrlAsStream reads the chunks from the volume servers, tests replace it to script the responses
+var readUrlAsStream = util.ReadUrlAsStreamWithContext
+
+func retriedFetchChunkData(buffer []byte, urlStrings []string, cipherKey []byte, isGzipped bool, isFullChunk bool, offset int64, flow *ReadFlow) (n int, err error) {
+	return retriedFetchChunkDataWithContext(context.Background(), buffer, urlStrings, cipherKey, gzipCodec(isGzipped), isFullChunk, offset, flow)
+}
+
+// retriedFetchChunkDataWithContext stops retrying once the context is done, and returns the error of the context.
+// The request in flight is cancelled too. The content is decompressed according to the codec.
+func retriedFetchChunkDataWithContext(ctx context.Context, buffer []byte, urlStrings []string, cipherKey []byte, codec CompressionCodec, isFullChunk bool, offset int64, flow *ReadFlow) (n int, err error) {
+
+	if !codec.decodedOnTheWire() {
+		data, err := fetchDecompressed(ctx, urlStrings, cipherKey, codec, flow)
+		if err != nil {
+			return 0, err
+		}
+		if data, err = sliceDecompressed(data, isFullChunk, offset, len(buffer)); err != nil {
+			return 0, err
+		}
+		return copy(buffer, data), nil
+	}
+	isGzipped := codec == CompressionGzip
 
 	var shouldRetry bool
 
-	for waitTime := time.Second; waitTime < util.RetryWaitTime; waitTime += waitTime / 2 {
-		for _, urlString := range urlStrings {
-			n = 0
-			if strings.Contains(urlString, "%") {
-				urlString = url.PathEscape(urlString)
-			}
-			shouldRetry, err = util.ReadUrlAsStream(urlString+"?readDeleted=true", cipherKey, isGzipped, isFullChunk, offset, len(buffer), func(data []byte) {
-				if n < len(buffer) {
-					x := copy(buffer[n:], data)
-					n += x
+	metrics := newChunkFetchMetrics(isFullChunk)
+	policy := flow.retryPolicy(ctx, int64(len(buffer)))
+	fetchCtx, deadline, cancel := policy.timeout(ctx)
+	defer cancel()
+	urlStrings = orderReplicas(urlStrings, flow)
+	// the first round is read whatever the wait
+	for rounds, waitTime := 1, policy.InitialWait; rounds == 1 || waitTime < policy.MaxWait; rounds, waitTime = rounds+1, policy.nextWait(waitTime) {
+		for passes := 1; ; passes++ {
+			for _, urlString := range rotateReplicas(urlStrings, rounds) {
+				if timedOut(deadline, 0) {
+					err, shouldRetry = deadlineExceeded(err), false
+					break
+				}
+				n = 0
+				inFlightLimit, volumeServer := MaxInFlightBytesPerVolumeServer, volumeServerOf(urlString)
+				acquireErr := flow.waitRateLimit(fetchCtx)
+				if acquireErr == nil {
+					acquireErr = volumeServerInFlight.acquire(fetchCtx, volumeServer, int64(len(buffer)), inFlightLimit)
 				}
-			})
-			if !shouldRetry {
+				if acquireErr != nil {
+					if err, shouldRetry = acquireErr, false; ctx.Err() == nil {
+						err = deadlineExceeded(err)
+					}
+					break
+				}
+				chargeRead(flow, int64(len(buffer)))
+				start := time.Now()
+				metrics.attempt()
+				attemptCtx, stall := policy.stallTimeout(fetchCtx)
+				shouldRetry, err = readUrlAsStream(attemptCtx, flow.chunkUrl(urlString), flow.header(), cipherKey, isGzipped, isFullChunk, offset, len(buffer), func(data []byte) {
+					stall.pause()
+					defer stall.resume()
+					if n < len(buffer) {
+						x := copy(buffer[n:], data)
+						n += x
+						flow.delivered(x)
+					}
+				})
+				stalled := stall.stop()
+				volumeServerInFlight.release(volumeServer, int64(len(buffer)), inFlightLimit)
+				if err != nil && fetchCtx.Err() != nil && ctx.Err() == nil {
+					err = deadlineExceeded(err)
+				} else if err != nil && stalled {
+					// the next replica may answer
+					err, shouldRetry = stall.error(err), true
+				}
+				if err == nil {
+					observeReadLatency(volumeServer, time.Since(start))
+					metrics.succeeded(urlString, int64(n))
+				} else if ctx.Err() == nil {
+					metrics.urlFailed(volumeServer)
+					observeReadFailure(volumeServer, time.Since(start))
+				}
+				if !shouldRetry {
+					if policy.nextReplicaIfNotFound(err) {
+						// the replication may have reached the next replica
+						continue
+					}
+					break
+				}
+				if err != nil {
+					glog.V(0).Infof("read %s failed, err: %v", urlString, err)
+				} else {
+					break
+				}
+			}
+			wait, readAgain := policy.notFoundWait(err, passes)
+			if !readAgain || shouldRetry || flow.expired(wait) || timedOut(deadline, wait) {
 				break
 			}
-			if err != nil {
-				glog.V(0).Infof("read %s failed, err: %v", urlString, err)
-			} else {
+			glog.V(0).Infof("chunk not found on any replica, read again in %v", wait)
+			if sleepErr := sleepContext(fetchCtx, wait); sleepErr != nil {
+				if err = sleepErr; ctx.Err() == nil {
+					err = deadlineExceeded(err)
+				}
 				break
 			}
 		}
+		if err != nil && shouldRetry && policy.exhausted(rounds) {
+			break
+		}
+		wait := policy.jittered(waitTime)
+		if err != nil && shouldRetry && (flow.expired(wait) || timedOut(deadline, wait)) {
+			err = deadlineExceeded(err)
+			break
+		}
 		if err != nil && shouldRetry {
-			glog.V(0).Infof("retry reading in %v", waitTime)
-			time.Sleep(waitTime)
+			glog.V(0).Infof("retry reading in %v", wait)
+			flow.emit(&ReadEvent{Type: ReadEventRetry, Err: err, Wait: wait})
+			if sleepErr := sleepContext(fetchCtx, wait); sleepErr != nil {
+				if err = sleepErr; ctx.Err() == nil {
+					err = deadlineExceeded(err)
+				}
+				break
+			}
 		} else {
 			break
 		}
 	}
+	if err != nil && shouldRetry && ctx.Err() == nil {
+		metrics.exhausted()
+	}
 
 	return n, err
 
 }
 
-func retriedStreamFetchChunkData(writer io.Writer, urlStrings []string, cipherKey []byte, isGzipped bool, isFullChunk bool, offset int64, size int) (err error) {
+func retriedStreamFetchChunkData(writer io.Writer, urlStrings []string, cipherKey []byte, isGzipped bool, isFullChunk bool, offset int64, size int, flow *ReadFlow) (totalWritten int, err error) {
+	return retriedStreamFetchChunkDataWithContext(context.Background(), writer, urlStrings, cipherKey, gzipCodec(isGzipped), isFullChunk, offset, size, flow)
+}
+
+// retriedStreamFetchChunkDataWithContext stops retrying once the context is done, like retriedFetchChunkDataWithContext.
+// The retries resume after the bytes already written, and totalWritten tells how many were written,
+// also on failure, so the caller knows the length of the valid prefix.
+func retriedStreamFetchChunkDataWithContext(ctx context.Context, writer io.Writer, urlStrings []string, cipherKey []byte, codec CompressionCodec, isFullChunk bool, offset int64, size int, flow *ReadFlow) (totalWritten int, err error) {
+
+	if !codec.decodedOnTheWire() {
+		return writeDecompressed(ctx, writer, urlStrings, cipherKey, codec, isFullChunk, offset, size, flow)
+	}
+	isGzipped := codec == CompressionGzip
 
 	var shouldRetry bool
-	var totalWritten int
-
-	for waitTime := time.Second; waitTime < util.RetryWaitTime; waitTime += waitTime / 2 {
-		for _, urlString := range urlStrings {
-			var localProcessed int
-			var writeErr error
-			shouldRetry, err = util.ReadUrlAsStream(urlString+"?readDeleted=true", cipherKey, isGzipped, isFullChunk, offset, size, func(data []byte) {
-				if totalWritten > localProcessed {
-					toBeSkipped := totalWritten - localProcessed
-					if len(data) <= toBeSkipped {
-						localProcessed += len(data)
-						return // skip if already processed
+
+	metrics := newChunkFetchMetrics(isFullChunk)
+	policy := flow.retryPolicy(ctx, int64(size))
+	fetchCtx, deadline, cancel := policy.timeout(ctx)
+	defer cancel()
+	urlStrings = orderReplicas(urlStrings, flow)
+	// the first round is read whatever the wait
+	for rounds, waitTime := 1, policy.InitialWait; rounds == 1 || waitTime < policy.MaxWait; rounds, waitTime = rounds+1, policy.nextWait(waitTime) {
+		for passes := 1; ; passes++ {
+			for _, urlString := range rotateReplicas(urlStrings, rounds) {
+				if timedOut(deadline, 0) {
+					err, shouldRetry = deadlineExceeded(err), false
+					break
+				}
+				var localProcessed int
+				var writeErr error
+				inFlightLimit, volumeServer := MaxInFlightBytesPerVolumeServer, volumeServerOf(urlString)
+				acquireErr := flow.waitRateLimit(fetchCtx)
+				if acquireErr == nil {
+					acquireErr = volumeServerInFlight.acquire(fetchCtx, volumeServer, int64(size), inFlightLimit)
+				}
+				if acquireErr != nil {
+					if err, shouldRetry = acquireErr, false; ctx.Err() == nil {
+						err = deadlineExceeded(err)
 					}
-					data = data[toBeSkipped:]
-					localProcessed += toBeSkipped
+					break
+				}
+				// reads of unknown size are charged as the data arrives
+				chargeRead(flow, int64(size))
+				start := time.Now()
+				metrics.attempt()
+				attemptCtx, stall := policy.stallTimeout(fetchCtx)
+				shouldRetry, err = readUrlAsStream(attemptCtx, flow.chunkUrl(urlString), flow.header(), cipherKey, isGzipped, isFullChunk, offset, size, func(data []byte) {
+					stall.pause()
+					defer stall.resume()
+					if size <= 0 {
+						chargeRead(flow, int64(len(data)))
+					}
+					if totalWritten > localProcessed {
+						toBeSkipped := totalWritten - localProcessed
+						if len(data) <= toBeSkipped {
+							localProcessed += len(data)
+							return // skip if already processed
+						}
+						data = data[toBeSkipped:]
+						localProcessed += toBeSkipped
+					}
+					var writtenCount int
+					writtenCount, writeErr = writer.Write(data)
+					localProcessed += writtenCount
+					totalWritten += writtenCount
+					flow.delivered(writtenCount)
+				})
+				stalled := stall.stop()
+				volumeServerInFlight.release(volumeServer, int64(size), inFlightLimit)
+				if err != nil && fetchCtx.Err() != nil && ctx.Err() == nil {
+					err = deadlineExceeded(err)
+				} else if err != nil && stalled {
+					// the next replica may answer
+					err, shouldRetry = stall.error(err), true
+				}
+				if err == nil && writeErr == nil {
+					observeReadLatency(volumeServer, time.Since(start))
+					metrics.succeeded(urlString, int64(localProcessed))
+				} else if err != nil && ctx.Err() == nil {
+					metrics.urlFailed(volumeServer)
+					observeReadFailure(volumeServer, time.Since(start))
+				}
+				if !shouldRetry {
+					if policy.nextReplicaIfNotFound(err) {
+						// the replication may have reached the next replica
+						continue
+					}
+					break
+				}
+				if writeErr != nil {
+					err = writeErr
+					break
+				}
+				if err != nil {
+					glog.V(0).Infof("read %s failed, err: %v", urlString, err)
+				} else {
+					break
 				}
-				var writtenCount int
-				writtenCount, writeErr = writer.Write(data)
-				localProcessed += writtenCount
-				totalWritten += writtenCount
-			})
-			if !shouldRetry {
-				break
 			}
-			if writeErr != nil {
-				err = writeErr
+			wait, readAgain := policy.notFoundWait(err, passes)
+			if !readAgain || shouldRetry || flow.expired(wait) || timedOut(deadline, wait) {
 				break
 			}
-			if err != nil {
-				glog.V(0).Infof("read %s failed, err: %v", urlString, err)
-			} else {
+			glog.V(0).Infof("chunk not found on any replica, read again in %v", wait)
+			if sleepErr := sleepContext(fetchCtx, wait); sleepErr != nil {
+				if err = sleepErr; ctx.Err() == nil {
+					err = deadlineExceeded(err)
+				}
 				break
 			}
 		}
+		if err != nil && shouldRetry && policy.exhausted(rounds) {
+			break
+		}
+		wait := policy.jittered(waitTime)
+		if err != nil && shouldRetry && (flow.expired(wait) || timedOut(deadline, wait)) {
+			err = deadlineExceeded(err)
+			break
+		}
 		if err != nil && shouldRetry {
-			glog.V(0).Infof("retry reading in %v", waitTime)
-			time.Sleep(waitTime)
+			glog.V(0).Infof("retry reading in %v", wait)
+			flow.emit(&ReadEvent{Type: ReadEventRetry, Err: err, Wait: wait})
+			if sleepErr := sleepContext(fetchCtx, wait); sleepErr != nil {
+				if err = sleepErr; ctx.Err() == nil {
+					err = deadlineExceeded(err)
+				}
+				break
+			}
 		} else {
 			break
 		}
 	}
+	if err != nil && shouldRetry && ctx.Err() == nil {
+		metrics.exhausted()
+	}
 
-	return err
+	return totalWritten, err
 
 }
 
+// MaybeManifestize merges every EffectiveManifestBatch data chunks into a manifest chunk
 func MaybeManifestize(saveFunc SaveDataAsChunkFunctionType, inputChunks []*filer_pb.FileChunk) (chunks []*filer_pb.FileChunk, err error) {
-	return doMaybeManifestize(saveFunc, inputChunks, ManifestBatch, mergeIntoManifest)
+	return doMaybeManifestize(saveFunc, inputChunks, EffectiveManifestBatch(), mergeIntoManifest)
+}
+
+// MaybeManifestizeWithBatch is like MaybeManifestize, but merges every batch data chunks
+// instead of EffectiveManifestBatch. The batch must be at least 2.
+func MaybeManifestizeWithBatch(saveFunc SaveDataAsChunkFunctionType, inputChunks []*filer_pb.FileChunk, batch int) (chunks []*filer_pb.FileChunk, err error) {
+	if err := checkManifestBatch(batch); err != nil {
+		return inputChunks, err
+	}
+	return doMaybeManifestize(saveFunc, inputChunks, batch, mergeIntoManifest)
 }
 
 func doMaybeManifestize(saveFunc SaveDataAsChunkFunctionType, inputChunks []*filer_pb.FileChunk, mergeFactor int, mergefn func(saveFunc SaveDataAsChunkFunctionType, dataChunks []*filer_pb.FileChunk) (manifestChunk *filer_pb.FileChunk, err error)) (chunks []*filer_pb.FileChunk, err error) {
 
-	var dataChunks []*filer_pb.FileChunk
-	for _, chunk := range inputChunks {
-		if !chunk.IsChunkManifest {
-			dataChunks = append(dataChunks, chunk)
-		} else {
-			chunks = append(chunks, chunk)
+	manifestChunks, batches, remaining := manifestBatches(inputChunks, mergeFactor)
+
+	merged, err := mergeBatches(saveFunc, batches, mergefn)
+	if err != nil {
+		return nonManifestChunks(inputChunks), err
+	}
+	chunks = append(chunks, manifestChunks...)
+	chunks = append(chunks, merged...)
+	chunks = append(chunks, remaining...)
+	return
+}
+
+// mergeBatches merges each batch into a manifest chunk, with at most ManifestizeConcurrency merges in flight.
+// The manifest chunks are in the order of the batches. On failure, the first error in batch order is returned.
+func mergeBatches(saveFunc SaveDataAsChunkFunctionType, batches [][]*filer_pb.FileChunk, mergefn func(saveFunc SaveDataAsChunkFunctionType, dataChunks []*filer_pb.FileChunk) (manifestChunk *filer_pb.FileChunk, err error)) (manifestChunks []*filer_pb.FileChunk, err error) {
+	concurrency := ManifestizeConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency == 1 || len(batches) <= 1 {
+		for _, batch := range batches {
+			chunk, err := mergefn(saveFunc, batch)
+			if err != nil {
+				return nil, err
+			}
+			manifestChunks = append(manifestChunks, chunk)
 		}
+		return
 	}
 
-	remaining := len(dataChunks)
-	for i := 0; i+mergeFactor <= len(dataChunks); i += mergeFactor {
-		chunk, err := mergefn(saveFunc, dataChunks[i:i+mergeFactor])
+	manifestChunks = make([]*filer_pb.FileChunk, len(batches))
+	errs := make([]error, len(batches))
+	limiter := make(chan struct{}, concurrency)
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		limiter <- struct{}{}
+		if failed.Load() {
+			// the result is discarded anyway, do not save more manifests
+			<-limiter
+			break
+		}
+		wg.Add(1)
+		go func(i int, batch []*filer_pb.FileChunk) {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+			manifestChunks[i], errs[i] = mergefn(saveFunc, batch)
+			if errs[i] != nil {
+				failed.Store(true)
+			}
+		}(i, batch)
+	}
+	wg.Wait()
+	for _, err := range errs {
 		if err != nil {
-			return dataChunks, err
+			return nil, err
 		}
-		chunks = append(chunks, chunk)
-		remaining -= mergeFactor
 	}
-	// remaining
-	for i := len(dataChunks) - remaining; i < len(dataChunks); i++ {
-		chunks = append(chunks, dataChunks[i])
+	return manifestChunks, nil
+}
+
+// checkManifestBatch rejects the merge factors merging nothing, which manifestBatches can not split by
+func checkManifestBatch(batch int) error {
+	if batch < 2 {
+		return fmt.Errorf("invalid manifest batch %d, must be at least 2", batch)
+	}
+	return nil
+}
+
+// manifestBatches splits the chunks the way MaybeManifestize merges them: existing manifest chunks are kept,
+// every full batch of mergeFactor data chunks is merged into one manifest, and the remaining data chunks are kept.
+func manifestBatches(inputChunks []*filer_pb.FileChunk, mergeFactor int) (manifestChunks []*filer_pb.FileChunk, batches [][]*filer_pb.FileChunk, remaining []*filer_pb.FileChunk) {
+	var dataChunks []*filer_pb.FileChunk
+	manifestChunks, dataChunks = SeparateManifestChunks(inputChunks)
+
+	i := 0
+	for ; i+mergeFactor <= len(dataChunks); i += mergeFactor {
+		batches = append(batches, dataChunks[i:i+mergeFactor])
+	}
+	remaining = dataChunks[i:]
+	return
+}
+
+func nonManifestChunks(chunks []*filer_pb.FileChunk) []*filer_pb.FileChunk {
+	_, dataChunks := SeparateManifestChunks(chunks)
+	return dataChunks
+}
+
+// ManifestSavings compares the serialized size of the top-level chunk list before and after manifesting
+type ManifestSavings struct {
+	CurrentSize     int // serialized size of the top-level chunks now
+	ManifestedSize  int // serialized size of the top-level chunks after manifesting
+	ManifestStorage int // size of the manifest bodies that would be stored in volumes
+}
+
+// NetSavings is negative if manifesting costs more than it saves
+func (s ManifestSavings) NetSavings() int {
+	return s.CurrentSize - s.ManifestedSize - s.ManifestStorage
+}
+
+// EstimateManifestSavings estimates how manifesting with the merge factor would change the metadata size,
+// without writing anything. The merge factor must be at least 2.
+func EstimateManifestSavings(chunks []*filer_pb.FileChunk, mergeFactor int) (savings ManifestSavings, err error) {
+	if err = checkManifestBatch(mergeFactor); err != nil {
+		return
+	}
+	savings.CurrentSize = serializedChunksSize(chunks)
+
+	manifestChunks, batches, remaining := manifestBatches(chunks, mergeFactor)
+	var topLevelChunks []*filer_pb.FileChunk
+	topLevelChunks = append(topLevelChunks, manifestChunks...)
+	for _, batch := range batches {
+		savings.ManifestStorage += serializedChunksSize(batch)
+		topLevelChunks = append(topLevelChunks, estimatedManifestChunk(batch))
 	}
+	topLevelChunks = append(topLevelChunks, remaining...)
+	savings.ManifestedSize = serializedChunksSize(topLevelChunks)
+
 	return
 }
 
+// serializedChunksSize is the size of the chunks as a repeated field, after BeforeEntrySerialization
+func serializedChunksSize(chunks []*filer_pb.FileChunk) int {
+	cloned := cloneChunks(chunks)
+	filer_pb.BeforeEntrySerialization(cloned)
+	return proto.Size(&filer_pb.FileChunkManifest{Chunks: cloned})
+}
+
+// estimatedManifestChunk looks like the chunk mergeIntoManifest would create for the batch
+func estimatedManifestChunk(batch []*filer_pb.FileChunk) *filer_pb.FileChunk {
+	first, last := batch[0], batch[len(batch)-1]
+	return &filer_pb.FileChunk{
+		FileId:          first.GetFileIdString(),
+		Offset:          first.Offset,
+		Size:            uint64(last.Offset + int64(last.Size) - first.Offset),
+		ModifiedTsNs:    last.ModifiedTsNs,
+		ETag:            first.ETag,
+		IsChunkManifest: true,
+	}
+}
+
+// ManifestCreated describes a manifest chunk created by merging data chunks
+type ManifestCreated struct {
+	ManifestFileId string
+	ChunkFileIds   []string
+	StartOffset    int64
+	StopOffset     int64
+}
+
+// ManifestCreatedHook, when set, is called once for each manifest chunk created by merging data chunks,
+// e.g. to audit why the chunk count of a file changed. The chunks left unmerged are not reported.
+var ManifestCreatedHook func(created *ManifestCreated)
+
+// CompressManifest compresses the body of the manifest chunks with gzip, flagged by IsCompressed like the data
+// chunks, so clients without CompressionCodec read them too. The volume servers are not told the body is
+// compressed, so it is decompressed after fetching it.
+var CompressManifest = false
+
+// EncryptManifest encrypts the body of the manifest chunks with a key of their own, for save functions
+// not encrypting the data themselves
+var EncryptManifest = false
+
+// encodeManifestBody compresses, then encrypts, the serialized manifest, as CompressManifest and EncryptManifest ask for
+func encodeManifestBody(data []byte) (body []byte, cipherKey []byte, err error) {
+	body = data
+	if CompressManifest {
+		if body, err = util.GzipData(body); err != nil {
+			return nil, nil, fmt.Errorf("compressing manifest: %v", err)
+		}
+	}
+	if EncryptManifest {
+		cipherKey = util.GenCipherKey()
+		if body, err = util.Encrypt(body, cipherKey); err != nil {
+			return nil, nil, fmt.Errorf("encrypting manifest: %v", err)
+		}
+	}
+	return body, cipherKey, nil
+}
+
 func mergeIntoManifest(saveFunc SaveDataAsChunkFunctionType, dataChunks []*filer_pb.FileChunk) (manifestChunk *filer_pb.FileChunk, err error) {
 
-	filer_pb.BeforeEntrySerialization(dataChunks)
+	if len(dataChunks) == 0 {
+		return nil, fmt.Errorf("no chunks to merge into a manifest")
+	}
+	for _, chunk := range dataChunks {
+		if chunk.Offset < 0 || chunk.Size > uint64(math.MaxInt64-chunk.Offset) {
+			return nil, fmt.Errorf("chunk %s at offset %d of size %d is out of range", chunk.GetFileIdString(), chunk.Offset, chunk.Size)
+		}
+	}
 
-	// create and serialize the manifest
-	data, serErr := proto.Marshal(&filer_pb.FileChunkManifest{
-		Chunks: dataChunks,
-	})
+	assertManifestChunks("mergeIntoManifest", dataChunks)
+	if issues := CheckChunksContiguity(dataChunks); len(issues) > 0 {
+		if RejectNonContiguousManifests {
+			return nil, fmt.Errorf("%w: %d gaps or overlaps among %d chunks, first %s", ErrNonContiguousManifest, len(issues), len(dataChunks), issues[0])
+		}
+		logged := issues
+		if len(logged) > maxLoggedContiguityIssues {
+			logged = logged[:maxLoggedContiguityIssues]
+		}
+		glog.Warningf("merging %d chunks with %d gaps or overlaps into a manifest, first: %s", len(dataChunks), len(issues), strings.Join(logged, ", "))
+		glog.V(1).Infof("gaps and overlaps of the %d chunks merged into a manifest: %s", len(dataChunks), strings.Join(issues, ", "))
+	}
+
+	data, serErr := SerializeChunkManifest(dataChunks)
 	if serErr != nil {
-		return nil, fmt.Errorf("serializing manifest: %v", serErr)
+		return nil, serErr
 	}
 
 	minOffset, maxOffset := int64(math.MaxInt64), int64(math.MinInt64)
+	var maxModifiedTsNs int64
 	for _, chunk := range dataChunks {
 		if minOffset > int64(chunk.Offset) {
 			minOffset = chunk.Offset
@@ -262,15 +1347,52 @@ func mergeIntoManifest(saveFunc SaveDataAsChunkFunctionType, dataChunks []*filer
 		if maxOffset < int64(chunk.Size)+chunk.Offset {
 			maxOffset = int64(chunk.Size) + chunk.Offset
 		}
+		if maxModifiedTsNs < chunk.ModifiedTsNs {
+			maxModifiedTsNs = chunk.ModifiedTsNs
+		}
 	}
 
-	manifestChunk, err = saveFunc(bytes.NewReader(data), "", 0, 0)
+	body, cipherKey, err := encodeManifestBody(data)
+	if err != nil {
+		return nil, err
+	}
+	manifestChunk, err = saveFunc(bytes.NewReader(body), "", 0, maxModifiedTsNs)
 	if err != nil {
 		return nil, err
 	}
+	// the reads decrypt before decompressing, so the save function may only encrypt a compressed body
+	if CompressManifest && manifestChunk.IsCompressed || EncryptManifest && (len(manifestChunk.CipherKey) > 0 || manifestChunk.IsCompressed) {
+		return nil, fmt.Errorf("manifest %s is encoded again when saved", manifestChunk.GetFileIdString())
+	}
+	if CompressManifest {
+		manifestChunk.IsCompressed = true
+	}
+	if EncryptManifest {
+		manifestChunk.CipherKey = cipherKey
+	}
 	manifestChunk.IsChunkManifest = true
 	manifestChunk.Offset = minOffset
 	manifestChunk.Size = uint64(maxOffset - minOffset)
+	manifestChunk.ManifestSize = uint64(len(data))
+	// the manifest carries the latest modification time and generation of the chunks it contains
+	manifestChunk.ModifiedTsNs = maxModifiedTsNs
+	manifestChunk.Generation = MaxChunkGeneration(dataChunks)
+	if err = SetChunkChecksum(manifestChunk, manifestChecksumAlgorithm(), data); err != nil {
+		return nil, err
+	}
+	warmManifest(manifestChunk, data)
+	if hook := ManifestCreatedHook; hook != nil {
+		chunkFileIds := make([]string, 0, len(dataChunks))
+		for _, chunk := range dataChunks {
+			chunkFileIds = append(chunkFileIds, chunk.GetFileIdString())
+		}
+		hook(&ManifestCreated{
+			ManifestFileId: manifestChunk.GetFileIdString(),
+			ChunkFileIds:   chunkFileIds,
+			StartOffset:    minOffset,
+			StopOffset:     maxOffset,
+		})
+	}
 
 	return
 }
@@ -0,0 +1,67 @@
+package filer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+// assertManifestChunks panics if the chunks of one manifest violate the invariants
+// the manifest code relies on. It only runs when built with "-tags manifestAssert",
+// otherwise the check is compiled out.
+func assertManifestChunks(where string, chunks []*filer_pb.FileChunk) {
+	if !manifestAssertEnabled {
+		return
+	}
+	if violations := checkManifestChunks(chunks); len(violations) > 0 {
+		panic(fmt.Sprintf("manifest assertion failed in %s:\n%s", where, strings.Join(violations, "\n")))
+	}
+}
+
+// checkManifestChunks does not check the chunk order, since unordered and overwriting chunks are valid
+func checkManifestChunks(chunks []*filer_pb.FileChunk) (violations []string) {
+	for i, chunk := range chunks {
+		if chunk == nil {
+			violations = append(violations, fmt.Sprintf("chunk %d is nil", i))
+			continue
+		}
+		if chunk.Offset < 0 {
+			violations = append(violations, fmt.Sprintf("chunk %d %s has negative offset %d", i, chunk.GetFileIdString(), chunk.Offset))
+		}
+		if chunk.Size > math.MaxInt64 || chunk.Offset > math.MaxInt64-int64(chunk.Size) {
+			violations = append(violations, fmt.Sprintf("chunk %d %s has invalid size %d at offset %d", i, chunk.GetFileIdString(), chunk.Size, chunk.Offset))
+		}
+	}
+	return
+}
+
+// CheckChunksContiguity reports the gaps and overlaps between the chunks, in offset order.
+// Both are valid in a manifest, from sparse writes and overwrites, but make the manifest size
+// cover more than its data chunks, so they are worth knowing about when merging.
+func CheckChunksContiguity(chunks []*filer_pb.FileChunk) (issues []string) {
+	sorted := make([]*filer_pb.FileChunk, len(chunks))
+	copy(sorted, chunks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+	if len(sorted) == 0 {
+		return
+	}
+	// the chunk reaching furthest so far
+	last := sorted[0]
+	for _, chunk := range sorted[1:] {
+		lastStop := last.Offset + int64(last.Size)
+		if chunk.Offset > lastStop {
+			issues = append(issues, fmt.Sprintf("gap [%d,%d) between %s and %s", lastStop, chunk.Offset, last.GetFileIdString(), chunk.GetFileIdString()))
+		} else if chunk.Offset < lastStop {
+			issues = append(issues, fmt.Sprintf("overlap [%d,%d) between %s and %s", chunk.Offset, min(lastStop, chunk.Offset+int64(chunk.Size)), last.GetFileIdString(), chunk.GetFileIdString()))
+		}
+		if chunk.Offset+int64(chunk.Size) > lastStop {
+			last = chunk
+		}
+	}
+	return
+}
@@ -0,0 +1,6 @@
+//go:build !manifestAssert
+// +build !manifestAssert
+
+package filer
+
+const manifestAssertEnabled = false
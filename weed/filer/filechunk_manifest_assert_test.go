@@ -0,0 +1,62 @@
+package filer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestCheckManifestChunks(t *testing.T) {
+	assert.Empty(t, checkManifestChunks([]*filer_pb.FileChunk{
+		{FileId: "1", Offset: 0, Size: 10},
+		{FileId: "2", Offset: 10, Size: 10},
+	}))
+	assert.Len(t, checkManifestChunks([]*filer_pb.FileChunk{
+		{FileId: "1", Offset: 0, Size: 10},
+		nil,
+	}), 1)
+	assert.Len(t, checkManifestChunks([]*filer_pb.FileChunk{
+		{FileId: "1", Offset: -1, Size: 10},
+	}), 1)
+	// out of order and overwriting chunks are valid
+	assert.Empty(t, checkManifestChunks([]*filer_pb.FileChunk{
+		{FileId: "1", Offset: 10, Size: 10},
+		{FileId: "2", Offset: 0, Size: 10},
+		{FileId: "3", Offset: 0, Size: 20},
+	}))
+}
+
+func TestAssertManifestChunks(t *testing.T) {
+	invalid := []*filer_pb.FileChunk{nil}
+	if manifestAssertEnabled {
+		assert.Panics(t, func() { assertManifestChunks("test", invalid) })
+	} else {
+		assert.NotPanics(t, func() { assertManifestChunks("test", invalid) })
+	}
+}
+
+func TestCheckChunksContiguity(t *testing.T) {
+	assert.Empty(t, CheckChunksContiguity([]*filer_pb.FileChunk{
+		{FileId: "1,02", Offset: 10, Size: 10},
+		{FileId: "1,01", Offset: 0, Size: 10},
+		{FileId: "1,03", Offset: 20, Size: 10},
+	}))
+	assert.Empty(t, CheckChunksContiguity(nil))
+
+	assert.Equal(t, []string{"gap [10,15) between 1,01 and 1,02"}, CheckChunksContiguity([]*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 10},
+		{FileId: "1,02", Offset: 15, Size: 10},
+	}))
+
+	assert.Equal(t, []string{
+		"overlap [5,10) between 1,01 and 1,02",
+		"overlap [30,40) between 1,02 and 1,03",
+	}, CheckChunksContiguity([]*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 10},
+		{FileId: "1,02", Offset: 5, Size: 95},
+		// within the previous chunk
+		{FileId: "1,03", Offset: 30, Size: 10},
+	}))
+}
@@ -0,0 +1,75 @@
+package filer
+
+import (
+	"math"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// ManifestProgressInterval is the shortest time between two progress reports of ResolveManyManifests
+var ManifestProgressInterval = time.Second
+
+// ManifestResolveProgress counts the work done so far by ResolveManyManifests
+type ManifestResolveProgress struct {
+	Entries           int // entries fully resolved
+	ManifestsResolved int
+	DataChunks        int
+}
+
+// ResolvedEntryChunks is the resolution of the chunks of one entry. A failed entry has Err set,
+// and the chunks resolved before the failure.
+type ResolvedEntryChunks struct {
+	Entry          *filer_pb.Entry
+	DataChunks     []*filer_pb.FileChunk
+	ManifestChunks []*filer_pb.FileChunk
+	Err            error
+}
+
+// ResolveManyManifests resolves the chunks of the entries like ResolveChunkManifestAll, one entry after the other.
+// A failed entry does not stop the others. progressFn, if not nil, is called at most once per
+// ManifestProgressInterval while resolving, and once at the end.
+func ResolveManyManifests(lookupFileIdFn wdclient.LookupFileIdFunctionType, entries []*filer_pb.Entry, progressFn func(progress ManifestResolveProgress)) []*ResolvedEntryChunks {
+	return resolveManyManifests(time.Now, lookupFileIdFn, entries, progressFn)
+}
+
+func resolveManyManifests(now func() time.Time, lookupFileIdFn wdclient.LookupFileIdFunctionType, entries []*filer_pb.Entry, progressFn func(progress ManifestResolveProgress)) []*ResolvedEntryChunks {
+	var progress ManifestResolveProgress
+	lastReport := now()
+	report := func() {
+		if progressFn == nil {
+			return
+		}
+		if current := now(); current.Sub(lastReport) >= ManifestProgressInterval {
+			lastReport = current
+			progressFn(progress)
+		}
+	}
+
+	results := make([]*ResolvedEntryChunks, 0, len(entries))
+	for _, entry := range entries {
+		result := &ResolvedEntryChunks{Entry: entry}
+		walker := newManifestWalker(lookupFileIdFn, 0, math.MaxInt64, func(chunk *filer_pb.FileChunk) bool {
+			if chunk.IsChunkManifest {
+				result.ManifestChunks = append(result.ManifestChunks, chunk)
+				progress.ManifestsResolved++
+			} else {
+				result.DataChunks = append(result.DataChunks, chunk)
+				progress.DataChunks++
+			}
+			report()
+			return true
+		})
+		walker.all = true
+		_, result.Err = walker.walk(entry.GetChunks(), nil)
+		results = append(results, result)
+		progress.Entries++
+		report()
+	}
+
+	if progressFn != nil {
+		progressFn(progress)
+	}
+	return results
+}
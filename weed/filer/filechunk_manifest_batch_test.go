@@ -0,0 +1,65 @@
+package filer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestResolveManyManifests(t *testing.T) {
+	contents := make(map[string]string)
+	var entries []*filer_pb.Entry
+	for i := 0; i < 10; i++ {
+		manifest, err := proto.Marshal(&filer_pb.FileChunkManifest{
+			Chunks: []*filer_pb.FileChunk{
+				{FileId: fmt.Sprintf("2,%02x", 2*i+1), Offset: 0, Size: 10},
+				{FileId: fmt.Sprintf("2,%02x", 2*i+2), Offset: 10, Size: 10},
+			},
+		})
+		assert.NoError(t, err)
+		manifestFileId := fmt.Sprintf("1,%02x", i+1)
+		if i != 3 {
+			contents[manifestFileId] = string(manifest)
+		}
+		entries = append(entries, &filer_pb.Entry{
+			Name: fmt.Sprintf("file%d", i),
+			Chunks: []*filer_pb.FileChunk{
+				{FileId: manifestFileId, Offset: 0, Size: 20, IsChunkManifest: true},
+				{FileId: fmt.Sprintf("3,%02x", i+1), Offset: 20, Size: 10},
+			},
+		})
+	}
+	lookup, closeFn := newTestVolumeServer(t, contents)
+	defer closeFn()
+
+	// each chunk takes 100ms
+	clock := time.Unix(0, 0)
+	now := func() time.Time {
+		clock = clock.Add(100 * time.Millisecond)
+		return clock
+	}
+	var reports []ManifestResolveProgress
+	results := resolveManyManifests(now, lookup, entries, func(progress ManifestResolveProgress) {
+		reports = append(reports, progress)
+	})
+
+	assert.Equal(t, 10, len(results))
+	assert.Error(t, results[3].Err)
+	for i, result := range results {
+		if i == 3 {
+			continue
+		}
+		assert.NoError(t, result.Err)
+		assert.Equal(t, 3, len(result.DataChunks))
+		assert.Equal(t, 1, len(result.ManifestChunks))
+	}
+	// about once a second, instead of once per chunk
+	assert.Less(t, len(reports), 10)
+	assert.Greater(t, len(reports), 1)
+	assert.Equal(t, ManifestResolveProgress{Entries: 10, ManifestsResolved: 9, DataChunks: 27}, reports[len(reports)-1])
+}
@@ -0,0 +1,64 @@
+package filer
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+// resolvedManifestCache keeps the unmarshalled chunks of recently resolved manifests, up to an approximate
+// number of bytes, evicting the least recently used. The content of a manifest file id never changes,
+// so entries never go stale.
+type resolvedManifestCache struct {
+	cache *ccache.Cache
+}
+
+type resolvedManifest []*filer_pb.FileChunk
+
+// Size makes ccache bound the cache by the memory of the chunks
+func (m resolvedManifest) Size() int64 {
+	var size int64
+	for _, chunk := range m {
+		size += chunkMemorySize(chunk)
+	}
+	return size
+}
+
+var resolvedManifests atomic.Pointer[resolvedManifestCache]
+
+// SetResolvedManifestCacheBytes makes ResolveOneChunkManifest keep the chunks of the manifests it resolves,
+// up to about maxBytes of chunks, so concurrent readers of the same file skip fetching and unmarshalling its
+// manifests again. 0 disables the cache, which is the default.
+func SetResolvedManifestCacheBytes(maxBytes int64) {
+	if maxBytes <= 0 {
+		resolvedManifests.Store(nil)
+		return
+	}
+	resolvedManifests.Store(&resolvedManifestCache{
+		cache: ccache.New(ccache.Configure().MaxSize(maxBytes).ItemsToPrune(16)),
+	})
+}
+
+// get returns a copy of the cached chunks, owned by the caller
+func (c *resolvedManifestCache) get(fileId string) ([]*filer_pb.FileChunk, bool) {
+	if c == nil {
+		return nil, false
+	}
+	item := c.cache.Get(fileId)
+	if item == nil {
+		return nil, false
+	}
+	item.Extend(time.Hour)
+	return cloneChunks(item.Value().(resolvedManifest)), true
+}
+
+// set keeps a copy of the chunks, so the caller may modify them
+func (c *resolvedManifestCache) set(fileId string, chunks []*filer_pb.FileChunk) {
+	if c == nil {
+		return
+	}
+	c.cache.Set(fileId, resolvedManifest(cloneChunks(chunks)), time.Hour)
+}
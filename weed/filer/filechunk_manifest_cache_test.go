@@ -0,0 +1,50 @@
+package filer
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestResolvedManifestCache(t *testing.T) {
+	defer SetResolvedManifestCacheBytes(0)
+	SetResolvedManifestCacheBytes(1024 * 1024)
+
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "2,01", Offset: 0, Size: 10},
+			{FileId: "2,02", Offset: 10, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"7,01": string(data)})
+	defer closeFn()
+	var lookups int32
+	lookupFn := func(fileId string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		return lookup(fileId)
+	}
+	manifestChunk := &filer_pb.FileChunk{FileId: "7,01", Offset: 0, Size: 20, IsChunkManifest: true}
+
+	chunks, err := ResolveOneChunkManifest(lookupFn, manifestChunk)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(chunks))
+	chunks[0].Offset = 100
+
+	// resolved again without fetching, and unaffected by the changes of the first caller
+	chunks, err = ResolveOneChunkManifest(lookupFn, manifestChunk)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lookups))
+	assert.Equal(t, 2, len(chunks))
+	assert.Equal(t, int64(0), chunks[0].Offset)
+	assert.Equal(t, "2,02", chunks[1].GetFileIdString())
+
+	SetResolvedManifestCacheBytes(0)
+	_, err = ResolveOneChunkManifest(lookupFn, manifestChunk)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&lookups))
+}
@@ -0,0 +1,47 @@
+package filer
+
+import (
+	"math"
+	"unsafe"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// ManifestEstimate is the cost of resolving all the chunk manifests of a file
+type ManifestEstimate struct {
+	DataChunks     int64
+	ManifestChunks int64
+	// MemoryBytes estimates the memory held by the resolved data chunks, as returned by ResolveChunkManifest
+	MemoryBytes int64
+}
+
+// EstimateChunkManifest walks the manifest chunks of the whole file, without reading the data chunks,
+// and counts the data chunks the file resolves to, e.g. to spot files of millions of tiny chunks before reading them.
+func EstimateChunkManifest(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk) (estimate *ManifestEstimate, err error) {
+	estimate = &ManifestEstimate{}
+	err = walkChunkManifest(lookupFileIdFn, chunks, 0, math.MaxInt64, func(chunk *filer_pb.FileChunk) bool {
+		if chunk.IsChunkManifest {
+			estimate.ManifestChunks++
+		} else {
+			estimate.DataChunks++
+			estimate.MemoryBytes += chunkMemorySize(chunk)
+		}
+		return true
+	})
+	return estimate, err
+}
+
+// chunkMemorySize is the approximate size of the chunk in memory, including its slot in the slice of chunks
+func chunkMemorySize(chunk *filer_pb.FileChunk) int64 {
+	size := int64(unsafe.Sizeof(chunk)) + int64(unsafe.Sizeof(*chunk))
+	size += int64(len(chunk.FileId) + len(chunk.ETag) + len(chunk.SourceFileId) + len(chunk.CipherKey) +
+		len(chunk.ChecksumAlgorithm) + len(chunk.Checksum) + len(chunk.CompressionCodec))
+	if chunk.Fid != nil {
+		size += int64(unsafe.Sizeof(*chunk.Fid))
+	}
+	if chunk.SourceFid != nil {
+		size += int64(unsafe.Sizeof(*chunk.SourceFid))
+	}
+	return size
+}
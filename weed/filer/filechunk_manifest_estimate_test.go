@@ -0,0 +1,50 @@
+package filer
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestEstimateChunkManifest(t *testing.T) {
+	inner, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "2,01", Offset: 0, Size: 10},
+			{FileId: "2,02", Offset: 10, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	outer, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 0, Size: 20, IsChunkManifest: true},
+			{FileId: "2,03", Offset: 20, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(outer), "1,02": string(inner)})
+	defer closeFn()
+	var lookups int32
+	lookupFn := func(fileId string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		return lookup(fileId)
+	}
+
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 30, IsChunkManifest: true},
+		{FileId: "2,04", Offset: 30, Size: 10},
+	}
+	estimate, err := EstimateChunkManifest(lookupFn, chunks)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), estimate.DataChunks)
+	assert.Equal(t, int64(2), estimate.ManifestChunks)
+	assert.Equal(t, 4*chunkMemorySize(&filer_pb.FileChunk{FileId: "2,01"}), estimate.MemoryBytes)
+	// only the manifests are read
+	assert.Equal(t, int32(2), atomic.LoadInt32(&lookups))
+
+	_, err = EstimateChunkManifest(lookupFn, append(chunks, &filer_pb.FileChunk{FileId: "1,09", Offset: 40, Size: 10, IsChunkManifest: true}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package filer
+
+import (
+	"fmt"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// ContentHashIndex is an external deduplication index, from the content hash of a chunk to its file id.
+// The hash has the form <algorithm>:<hex digest>, as in the signature of a file.
+type ContentHashIndex interface {
+	LookupContentHash(hash string) (fileId string, found bool, err error)
+}
+
+// ManifestIndexMismatch is a data chunk whose file id differs from the one indexed for its content hash.
+// IndexedFileId is empty if the hash is not indexed.
+type ManifestIndexMismatch struct {
+	FileId        string
+	Offset        int64
+	Size          uint64
+	Hash          string
+	IndexedFileId string
+}
+
+func (m *ManifestIndexMismatch) String() string {
+	if m.IndexedFileId == "" {
+		return fmt.Sprintf("chunk %s [%d,%d) hash %s is not indexed", m.FileId, m.Offset, m.Offset+int64(m.Size), m.Hash)
+	}
+	return fmt.Sprintf("chunk %s [%d,%d) hash %s is indexed as %s", m.FileId, m.Offset, m.Offset+int64(m.Size), m.Hash, m.IndexedFileId)
+}
+
+// VerifyManifestAgainstIndex resolves the chunk manifests, and checks each data chunk is the one the index
+// has for its content hash. The hash is computed like for the file signature, so only chunks without
+// a recorded checksum or ETag are fetched. The mismatches are returned in chunk order.
+func VerifyManifestAgainstIndex(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, index ContentHashIndex) (mismatches []*ManifestIndexMismatch, err error) {
+	dataChunks, _, err := ResolveChunkManifestAll(lookupFileIdFn, chunks)
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range dataChunks {
+		hash, err := chunkContentHash(lookupFileIdFn, chunk)
+		if err != nil {
+			return nil, err
+		}
+		indexedFileId, found, err := index.LookupContentHash(hash)
+		if err != nil {
+			return nil, fmt.Errorf("lookup %s of chunk %s: %v", hash, chunk.GetFileIdString(), err)
+		}
+		if found && indexedFileId == chunk.GetFileIdString() {
+			continue
+		}
+		mismatches = append(mismatches, &ManifestIndexMismatch{
+			FileId:        chunk.GetFileIdString(),
+			Offset:        chunk.Offset,
+			Size:          chunk.Size,
+			Hash:          hash,
+			IndexedFileId: indexedFileId,
+		})
+	}
+	return mismatches, nil
+}
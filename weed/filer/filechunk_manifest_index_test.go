@@ -0,0 +1,56 @@
+package filer
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+type mapContentHashIndex map[string]string
+
+func (index mapContentHashIndex) LookupContentHash(hash string) (string, bool, error) {
+	fileId, found := index[hash]
+	return fileId, found, nil
+}
+
+func TestVerifyManifestAgainstIndex(t *testing.T) {
+	etag := func(content string) (string, string) {
+		digest := md5.Sum([]byte(content))
+		return base64.StdEncoding.EncodeToString(digest[:]), "md5:" + hex.EncodeToString(digest[:])
+	}
+	etag1, hash1 := etag("aaaa")
+	etag2, hash2 := etag("bbbb")
+	etag3, hash3 := etag("cccc")
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 0, Size: 4, ModifiedTsNs: 1, ETag: etag1},
+			{FileId: "1,03", Offset: 4, Size: 4, ModifiedTsNs: 1, ETag: etag2},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(data)})
+	defer closeFn()
+
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 8, ModifiedTsNs: 1, IsChunkManifest: true},
+		{FileId: "1,04", Offset: 8, Size: 4, ModifiedTsNs: 1, ETag: etag3},
+	}
+
+	mismatches, err := VerifyManifestAgainstIndex(lookup, chunks, mapContentHashIndex{hash1: "1,02", hash2: "1,03", hash3: "1,04"})
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	// the chunk of hash2 was moved by a rebalancing, and hash3 dropped from the index
+	mismatches, err = VerifyManifestAgainstIndex(lookup, chunks, mapContentHashIndex{hash1: "1,02", hash2: "2,05"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*ManifestIndexMismatch{
+		{FileId: "1,03", Offset: 4, Size: 4, Hash: hash2, IndexedFileId: "2,05"},
+		{FileId: "1,04", Offset: 8, Size: 4, Hash: hash3},
+	}, mismatches)
+}
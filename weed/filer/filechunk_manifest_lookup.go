@@ -0,0 +1,90 @@
+package filer
+
+import (
+	"sync"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// BatchLookupFileIdFunctionType looks up the locations of several file ids in one call, e.g. one request to the master.
+// The file ids missing from the result are looked up again one by one.
+type BatchLookupFileIdFunctionType func(fileIds []string) (locations map[string][]string, err error)
+
+// ResolveChunkManifestBatch resolves the chunks like ResolveChunkManifest, but looks up the manifest chunks
+// of each chunk list with one call of batchLookupFn before fetching them, instead of one lookup per manifest.
+// Without batchLookupFn, or for the file ids it does not locate, lookupFileIdFn is used.
+func ResolveChunkManifestBatch(lookupFileIdFn wdclient.LookupFileIdFunctionType, batchLookupFn BatchLookupFileIdFunctionType, chunks []*filer_pb.FileChunk, startOffset, stopOffset int64) (dataChunks, manifestChunks []*filer_pb.FileChunk, manifestResolveErr error) {
+	if batchLookupFn == nil || !HasChunkManifest(chunks) {
+		return ResolveChunkManifest(lookupFileIdFn, chunks, startOffset, stopOffset)
+	}
+	locations := newBatchLookupLocations(lookupFileIdFn, batchLookupFn)
+	walker := newManifestWalker(locations.lookup, startOffset, stopOffset, func(chunk *filer_pb.FileChunk) bool {
+		if chunk.IsChunkManifest {
+			manifestChunks = append(manifestChunks, chunk)
+		} else {
+			dataChunks = append(dataChunks, chunk)
+		}
+		return true
+	})
+	walker.prelookup = locations.prefetch
+	if _, err := walker.walk(chunks, nil); err != nil {
+		return dataChunks, nil, err
+	}
+	notifyDataChunksResolved(dataChunks)
+	return
+}
+
+// batchLookupLocations keeps the locations found by the batch lookups, for the fetches of the manifests
+type batchLookupLocations struct {
+	sync.Mutex
+	lookupFileIdFn wdclient.LookupFileIdFunctionType
+	batchLookupFn  BatchLookupFileIdFunctionType
+	locations      map[string][]string
+}
+
+func newBatchLookupLocations(lookupFileIdFn wdclient.LookupFileIdFunctionType, batchLookupFn BatchLookupFileIdFunctionType) *batchLookupLocations {
+	return &batchLookupLocations{
+		lookupFileIdFn: lookupFileIdFn,
+		batchLookupFn:  batchLookupFn,
+		locations:      make(map[string][]string),
+	}
+}
+
+// prefetch looks up the manifests not located yet, with one batch lookup
+func (l *batchLookupLocations) prefetch(manifests []*filer_pb.FileChunk) {
+	var fileIds []string
+	l.Lock()
+	for _, chunk := range manifests {
+		if _, found := l.locations[chunk.GetFileIdString()]; !found {
+			fileIds = append(fileIds, chunk.GetFileIdString())
+		}
+	}
+	l.Unlock()
+	if len(fileIds) == 0 {
+		return
+	}
+	locations, err := l.batchLookupFn(fileIds)
+	if err != nil {
+		glog.V(1).Infof("batch lookup of %d manifests: %v, look them up one by one", len(fileIds), err)
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	for fileId, urlStrings := range locations {
+		if len(urlStrings) > 0 {
+			l.locations[fileId] = urlStrings
+		}
+	}
+}
+
+func (l *batchLookupLocations) lookup(fileId string) ([]string, error) {
+	l.Lock()
+	urlStrings, found := l.locations[fileId]
+	l.Unlock()
+	if found {
+		return urlStrings, nil
+	}
+	return l.lookupFileIdFn(fileId)
+}
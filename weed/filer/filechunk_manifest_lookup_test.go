@@ -0,0 +1,77 @@
+package filer
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestResolveChunkManifestBatch(t *testing.T) {
+	// two manifests of two nested manifests each
+	contents := make(map[string]string)
+	var topLevel []*filer_pb.FileChunk
+	for i := 0; i < 2; i++ {
+		var nested []*filer_pb.FileChunk
+		for j := 0; j < 2; j++ {
+			offset := int64(i*20 + j*10)
+			leaf := string(rune('a' + 2*i + j))
+			data, err := SerializeChunkManifest([]*filer_pb.FileChunk{
+				{FileId: "3," + leaf + "1", Offset: offset, Size: 5},
+				{FileId: "3," + leaf + "2", Offset: offset + 5, Size: 5},
+			})
+			assert.NoError(t, err)
+			contents["2,"+leaf] = string(data)
+			nested = append(nested, &filer_pb.FileChunk{FileId: "2," + leaf, Offset: offset, Size: 10, IsChunkManifest: true})
+		}
+		data, err := SerializeChunkManifest(nested)
+		assert.NoError(t, err)
+		fileId := "1," + string(rune('a'+i))
+		contents[fileId] = string(data)
+		topLevel = append(topLevel, &filer_pb.FileChunk{FileId: fileId, Offset: int64(i * 20), Size: 20, IsChunkManifest: true})
+	}
+	lookup, closeFn := newTestVolumeServer(t, contents)
+	defer closeFn()
+
+	var lock sync.Mutex
+	var lookups []string
+	var batches [][]string
+	countingLookup := func(fileId string) ([]string, error) {
+		lock.Lock()
+		lookups = append(lookups, fileId)
+		lock.Unlock()
+		return lookup(fileId)
+	}
+	batchLookup := func(fileIds []string) (map[string][]string, error) {
+		lock.Lock()
+		batches = append(batches, fileIds)
+		lock.Unlock()
+		locations := make(map[string][]string)
+		for _, fileId := range fileIds {
+			// the batch does not locate 2,d
+			if fileId != "2,d" {
+				locations[fileId], _ = lookup(fileId)
+			}
+		}
+		return locations, nil
+	}
+
+	dataChunks, manifestChunks, err := ResolveChunkManifestBatch(countingLookup, batchLookup, topLevel, 0, 40)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, len(dataChunks))
+	assert.Equal(t, 6, len(manifestChunks))
+	// one batch per chunk list, and a single lookup of the manifest missing from its batch
+	assert.Equal(t, [][]string{{"1,a", "1,b"}, {"2,a", "2,b"}, {"2,c", "2,d"}}, batches)
+	assert.Equal(t, []string{"2,d"}, lookups)
+
+	// without a batch lookup, each manifest is looked up
+	lookups, batches = nil, nil
+	expected := dataChunks
+	dataChunks, _, err = ResolveChunkManifestBatch(countingLookup, nil, topLevel, 0, 40)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, dataChunks)
+	assert.Equal(t, 6, len(lookups))
+	assert.Empty(t, batches)
+}
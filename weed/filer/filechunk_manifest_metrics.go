@@ -0,0 +1,33 @@
+package filer
+
+import (
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// manifest maintenance operations, used as metric labels
+const (
+	ManifestOpRecompact = "recompact"
+	ManifestOpMigrate   = "migrate"
+	ManifestOpGC        = "gc"
+)
+
+// ManifestMaintenanceStats counts the work done by one manifest maintenance operation
+type ManifestMaintenanceStats struct {
+	ManifestsRewritten int
+	ChunksRewritten    int
+	ManifestsDeleted   int
+	ChunksDeleted      int
+	BytesMoved         int64
+}
+
+// Report adds the counts and the time since start to the manifest maintenance metrics
+func (s *ManifestMaintenanceStats) Report(operation string, start time.Time) {
+	stats.FilerManifestMaintenanceCounter.WithLabelValues(operation, stats.ManifestRewritten).Add(float64(s.ManifestsRewritten))
+	stats.FilerManifestMaintenanceCounter.WithLabelValues(operation, stats.ChunkRewritten).Add(float64(s.ChunksRewritten))
+	stats.FilerManifestMaintenanceCounter.WithLabelValues(operation, stats.ManifestDeleted).Add(float64(s.ManifestsDeleted))
+	stats.FilerManifestMaintenanceCounter.WithLabelValues(operation, stats.ChunkDeleted).Add(float64(s.ChunksDeleted))
+	stats.FilerManifestMaintenanceBytesCounter.WithLabelValues(operation).Add(float64(s.BytesMoved))
+	stats.FilerManifestMaintenanceHistogram.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
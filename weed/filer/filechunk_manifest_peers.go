@@ -0,0 +1,161 @@
+package filer
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/cluster/lock_manager"
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	"github.com/seaweedfs/seaweedfs/weed/pb"
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// CoalesceManifestsAcrossFilers makes ResolveOneChunkManifest ask the filer owning a manifest on the lock ring
+// to resolve it, so the filers of a cluster reading the same file fetch each of its manifests once.
+// Off by default.
+var CoalesceManifestsAcrossFilers = false
+
+// WarmManifestsOnWrite makes a new manifest kept in the resolved manifest cache when written, and pushed to the
+// filer owning it when coalescing across filers, so any filer serves the first read of the file warm. Off by default.
+var WarmManifestsOnWrite = false
+
+// ManifestPeerTimeout bounds the wait on the owning filer, after which the manifest is resolved locally
+var ManifestPeerTimeout = 10 * time.Second
+
+// manifestPeerRing tells which filer owns a manifest, set once the filer aggregates from its peers
+type manifestPeerRing struct {
+	dlm            *lock_manager.DistributedLockManager
+	grpcDialOption grpc.DialOption
+}
+
+var manifestPeers atomic.Pointer[manifestPeerRing]
+
+func (f *Filer) resolveManifestsWithPeers() {
+	manifestPeers.Store(&manifestPeerRing{dlm: f.Dlm, grpcDialOption: f.GrpcDialOption})
+}
+
+// owner returns the filer owning the manifest, or "" if this filer owns it
+func (r *manifestPeerRing) owner(fileId string) pb.ServerAddress {
+	if r == nil {
+		return ""
+	}
+	servers := r.dlm.LockRing.GetSnapshot()
+	if len(servers) <= 1 {
+		return ""
+	}
+	if server := r.dlm.CalculateTargetServer(fileId, servers); server != r.dlm.Host {
+		return server
+	}
+	return ""
+}
+
+// resolveManifestOnPeer asks a filer to resolve a manifest, replaced in tests
+var resolveManifestOnPeer = func(ctx context.Context, peer pb.ServerAddress, grpcDialOption grpc.DialOption, chunk *filer_pb.FileChunk) (dataChunks []*filer_pb.FileChunk, err error) {
+	err = pb.WithFilerClient(false, 0, peer, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+		resp, err := client.ResolveChunkManifest(ctx, &filer_pb.ResolveChunkManifestRequest{ManifestChunk: chunk})
+		if err != nil {
+			return err
+		}
+		dataChunks = resp.Chunks
+		return nil
+	})
+	return
+}
+
+// cacheManifestOnPeer pushes the chunks of a manifest to a filer, replaced in tests
+var cacheManifestOnPeer = func(ctx context.Context, peer pb.ServerAddress, grpcDialOption grpc.DialOption, chunk *filer_pb.FileChunk, dataChunks []*filer_pb.FileChunk) error {
+	return pb.WithFilerClient(false, 0, peer, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+		_, err := client.CacheChunkManifest(ctx, &filer_pb.CacheChunkManifestRequest{ManifestChunk: chunk, Chunks: dataChunks})
+		return err
+	})
+}
+
+// fetchOneChunkManifestFromOwner resolves the manifest on the filer owning it, falling back to fetching it
+// from the volume servers when this filer owns it or the owner fails.
+func fetchOneChunkManifestFromOwner(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunk *filer_pb.FileChunk) (dataChunks []*filer_pb.FileChunk, manifestResolveErr error) {
+	if !CoalesceManifestsAcrossFilers {
+		return fetchOneChunkManifest(lookupFileIdFn, chunk)
+	}
+	ring := manifestPeers.Load()
+	owner := ring.owner(chunk.GetFileIdString())
+	if owner == "" {
+		return fetchOneChunkManifest(lookupFileIdFn, chunk)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ManifestPeerTimeout)
+	defer cancel()
+	dataChunks, err := resolveManifestOnPeer(ctx, owner, ring.grpcDialOption, chunk)
+	if err != nil {
+		glog.V(1).Infof("resolve manifest %s on filer %s: %v, resolving it locally", chunk.GetFileIdString(), owner, err)
+		return fetchOneChunkManifest(lookupFileIdFn, chunk)
+	}
+	return dataChunks, nil
+}
+
+// ResolveOneChunkManifestForPeer resolves a manifest for another filer, like ResolveOneChunkManifest but never
+// forwarding it again. Requests for the manifests this filer owns share the fetch and the cache of its own reads,
+// while those it does not own, which only happens while peers disagree on the ring, resolve on their own
+// so two filers never wait on each other.
+func ResolveOneChunkManifestForPeer(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunk *filer_pb.FileChunk) (dataChunks []*filer_pb.FileChunk, manifestResolveErr error) {
+	if chunk == nil {
+		return nil, fmt.Errorf("no manifest chunk")
+	}
+	if !chunk.IsChunkManifest {
+		return nil, fmt.Errorf("%s is not a manifest chunk", chunk.GetFileIdString())
+	}
+	if manifestPeers.Load().owner(chunk.GetFileIdString()) != "" {
+		return resolveOneChunkManifest(lookupFileIdFn, chunk, "peer:"+chunk.GetFileIdString(), fetchOneChunkManifest)
+	}
+	return resolveOneChunkManifest(lookupFileIdFn, chunk, chunk.GetFileIdString(), fetchOneChunkManifest)
+}
+
+// CacheChunkManifestForPeer keeps the chunks of a manifest another filer has just written, for the reads to come
+func CacheChunkManifestForPeer(chunk *filer_pb.FileChunk, dataChunks []*filer_pb.FileChunk) error {
+	if chunk == nil {
+		return fmt.Errorf("no manifest chunk")
+	}
+	if !chunk.IsChunkManifest {
+		return fmt.Errorf("%s is not a manifest chunk", chunk.GetFileIdString())
+	}
+	resolvedManifests.Load().set(chunk.GetFileIdString(), dataChunks)
+	return nil
+}
+
+// warmManifest keeps the chunks of a new manifest, serialized in data, as its resolution would return them,
+// and pushes them to the filer owning the manifest in the background
+func warmManifest(manifestChunk *filer_pb.FileChunk, data []byte) {
+	if !WarmManifestsOnWrite {
+		return
+	}
+	fileId := manifestChunk.GetFileIdString()
+	dataChunks, err := ParseChunkManifest(data)
+	if err != nil {
+		glog.V(1).Infof("warm manifest %s: %v", fileId, err)
+		return
+	}
+	dataChunks = deduplicateManifestChunks(fileId, dataChunks)
+	resolvedManifests.Load().set(fileId, dataChunks)
+
+	if !CoalesceManifestsAcrossFilers {
+		return
+	}
+	ring := manifestPeers.Load()
+	owner := ring.owner(fileId)
+	if owner == "" {
+		return
+	}
+	// the caller keeps modifying its manifest chunk
+	chunk := proto.Clone(manifestChunk).(*filer_pb.FileChunk)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), ManifestPeerTimeout)
+		defer cancel()
+		if err := cacheManifestOnPeer(ctx, owner, ring.grpcDialOption, chunk, dataChunks); err != nil {
+			glog.V(1).Infof("push manifest %s to filer %s: %v", fileId, owner, err)
+		}
+	}()
+}
@@ -0,0 +1,171 @@
+package filer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/cluster/lock_manager"
+	"github.com/seaweedfs/seaweedfs/weed/pb"
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestResolveOneChunkManifestAcrossFilers(t *testing.T) {
+	self, peer := pb.ServerAddress("filer1:8888"), pb.ServerAddress("filer2:8888")
+	dlm := lock_manager.NewDistributedLockManager(self)
+	servers := []pb.ServerAddress{self, peer}
+	dlm.LockRing.SetSnapshot(servers)
+	defer manifestPeers.Store(nil)
+	manifestPeers.Store(&manifestPeerRing{dlm: dlm})
+	defer func() { CoalesceManifestsAcrossFilers = false }()
+	CoalesceManifestsAcrossFilers = true
+
+	// a manifest owned by each filer
+	var localFileId, peerFileId string
+	for i := 1; localFileId == "" || peerFileId == ""; i++ {
+		fileId := fmt.Sprintf("7,%02x", i)
+		if dlm.CalculateTargetServer(fileId, servers) == peer {
+			peerFileId = fileId
+		} else {
+			localFileId = fileId
+		}
+	}
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{{FileId: "2,01", Offset: 0, Size: 10}},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{localFileId: string(data), peerFileId: string(data)})
+	defer closeFn()
+	var lookups int32
+	lookupFn := func(fileId string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		return lookup(fileId)
+	}
+
+	var peerCalls int32
+	var peerErr error
+	defer func(original func(context.Context, pb.ServerAddress, grpc.DialOption, *filer_pb.FileChunk) ([]*filer_pb.FileChunk, error)) {
+		resolveManifestOnPeer = original
+	}(resolveManifestOnPeer)
+	resolveManifestOnPeer = func(ctx context.Context, server pb.ServerAddress, grpcDialOption grpc.DialOption, chunk *filer_pb.FileChunk) ([]*filer_pb.FileChunk, error) {
+		atomic.AddInt32(&peerCalls, 1)
+		assert.Equal(t, peer, server)
+		if peerErr != nil {
+			return nil, peerErr
+		}
+		return []*filer_pb.FileChunk{{FileId: "2,02", Offset: 0, Size: 10}}, nil
+	}
+	manifestChunk := func(fileId string) *filer_pb.FileChunk {
+		return &filer_pb.FileChunk{FileId: fileId, Offset: 0, Size: 10, IsChunkManifest: true}
+	}
+
+	// resolved by the owning filer, without fetching
+	chunks, err := ResolveOneChunkManifest(lookupFn, manifestChunk(peerFileId))
+	assert.NoError(t, err)
+	assert.Equal(t, "2,02", chunks[0].GetFileIdString())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&peerCalls))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&lookups))
+
+	// fetched by the filer owning it
+	chunks, err = ResolveOneChunkManifest(lookupFn, manifestChunk(localFileId))
+	assert.NoError(t, err)
+	assert.Equal(t, "2,01", chunks[0].GetFileIdString())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&peerCalls))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lookups))
+
+	// fetched locally when the owner fails
+	peerErr = fmt.Errorf("unavailable")
+	chunks, err = ResolveOneChunkManifest(lookupFn, manifestChunk(peerFileId))
+	assert.NoError(t, err)
+	assert.Equal(t, "2,01", chunks[0].GetFileIdString())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peerCalls))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&lookups))
+
+	// a peer request is never forwarded again, even for a manifest this filer does not own
+	chunks, err = ResolveOneChunkManifestForPeer(lookupFn, manifestChunk(peerFileId))
+	assert.NoError(t, err)
+	assert.Equal(t, "2,01", chunks[0].GetFileIdString())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peerCalls))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&lookups))
+
+	_, err = ResolveOneChunkManifestForPeer(lookupFn, &filer_pb.FileChunk{FileId: "2,01", Size: 10})
+	assert.Error(t, err)
+	_, err = ResolveOneChunkManifestForPeer(lookupFn, nil)
+	assert.Error(t, err)
+
+	// all resolved locally when off
+	CoalesceManifestsAcrossFilers = false
+	_, err = ResolveOneChunkManifest(lookupFn, manifestChunk(peerFileId))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peerCalls))
+}
+
+func TestWarmManifestsOnWrite(t *testing.T) {
+	self, peer := pb.ServerAddress("filer1:8888"), pb.ServerAddress("filer2:8888")
+	dlm := lock_manager.NewDistributedLockManager(self)
+	servers := []pb.ServerAddress{self, peer}
+	dlm.LockRing.SetSnapshot(servers)
+	defer manifestPeers.Store(nil)
+	manifestPeers.Store(&manifestPeerRing{dlm: dlm})
+	defer SetResolvedManifestCacheBytes(0)
+	SetResolvedManifestCacheBytes(1024 * 1024)
+	defer func() { WarmManifestsOnWrite, CoalesceManifestsAcrossFilers = false, false }()
+	WarmManifestsOnWrite = true
+
+	var peerFileId string
+	for i := 1; peerFileId == ""; i++ {
+		if fileId := fmt.Sprintf("7,%02x", i); dlm.CalculateTargetServer(fileId, servers) == peer {
+			peerFileId = fileId
+		}
+	}
+	pushed := make(chan *filer_pb.CacheChunkManifestRequest, 1)
+	defer func(original func(context.Context, pb.ServerAddress, grpc.DialOption, *filer_pb.FileChunk, []*filer_pb.FileChunk) error) {
+		cacheManifestOnPeer = original
+	}(cacheManifestOnPeer)
+	cacheManifestOnPeer = func(ctx context.Context, server pb.ServerAddress, grpcDialOption grpc.DialOption, chunk *filer_pb.FileChunk, dataChunks []*filer_pb.FileChunk) error {
+		assert.Equal(t, peer, server)
+		pushed <- &filer_pb.CacheChunkManifestRequest{ManifestChunk: chunk, Chunks: dataChunks}
+		return nil
+	}
+	saveFunc := func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		return &filer_pb.FileChunk{FileId: peerFileId}, nil
+	}
+	dataChunks := []*filer_pb.FileChunk{
+		{FileId: "2,01", Offset: 0, Size: 10},
+		{FileId: "2,02", Offset: 10, Size: 10},
+	}
+	noLookup := func(fileId string) ([]string, error) {
+		t.Errorf("unexpected lookup of %s", fileId)
+		return nil, fmt.Errorf("no lookup")
+	}
+
+	// the first read on the writing filer is warm
+	manifestChunk, err := mergeIntoManifest(saveFunc, dataChunks)
+	assert.NoError(t, err)
+	chunks, err := ResolveOneChunkManifest(noLookup, manifestChunk)
+	assert.NoError(t, err)
+	assertEqualChunks(t, dataChunks, chunks)
+
+	// and pushed to the owning filer, whose first read is warm too
+	CoalesceManifestsAcrossFilers = true
+	manifestChunk, err = mergeIntoManifest(saveFunc, dataChunks)
+	assert.NoError(t, err)
+	req := <-pushed
+	assert.Equal(t, peerFileId, req.ManifestChunk.GetFileIdString())
+	assert.True(t, req.ManifestChunk.IsChunkManifest)
+	// the owning filer has not seen the manifest yet
+	SetResolvedManifestCacheBytes(1024 * 1024)
+	assert.NoError(t, CacheChunkManifestForPeer(req.ManifestChunk, req.Chunks))
+	chunks, err = ResolveOneChunkManifestForPeer(noLookup, manifestChunk)
+	assert.NoError(t, err)
+	assertEqualChunks(t, dataChunks, chunks)
+
+	assert.Error(t, CacheChunkManifestForPeer(dataChunks[0], dataChunks))
+	assert.Error(t, CacheChunkManifestForPeer(nil, dataChunks))
+}
@@ -0,0 +1,83 @@
+package filer
+
+import (
+	"io"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+// ManifestAntiAffinity places each manifest chunk on a volume other than those of the data chunks it contains,
+// when possible, so reading a file does not concentrate on one volume.
+var ManifestAntiAffinity bool
+
+// VolumeStorageOf tells the collection and replication of a volume, e.g. "3".
+// When set, each manifest chunk is saved with the collection and replication holding most of its data.
+var VolumeStorageOf func(volumeId string) (collection, replication string)
+
+// ManifestPlacement tells where to save a manifest chunk.
+// An empty Collection keeps the collection and replication the data is saved with.
+type ManifestPlacement struct {
+	AvoidVolumeIds map[string]struct{}
+	Collection     string
+	Replication    string
+}
+
+// SaveDataAsChunkWithPlacementFunctionType saves the data like SaveDataAsChunkFunctionType,
+// following the placement when it is not nil.
+type SaveDataAsChunkWithPlacementFunctionType func(reader io.Reader, name string, offset int64, tsNs int64, placement *ManifestPlacement) (chunk *filer_pb.FileChunk, err error)
+
+// MaybeManifestizeWithPlacement merges the chunks like MaybeManifestize.
+// With ManifestAntiAffinity, each manifest chunk avoids the volumes of its data chunks.
+// With VolumeStorageOf, each manifest chunk lands in the collection of its data chunks.
+func MaybeManifestizeWithPlacement(saveFunc SaveDataAsChunkWithPlacementFunctionType, inputChunks []*filer_pb.FileChunk) (chunks []*filer_pb.FileChunk, err error) {
+	return doMaybeManifestize(nil, inputChunks, EffectiveManifestBatch(), func(_ SaveDataAsChunkFunctionType, dataChunks []*filer_pb.FileChunk) (*filer_pb.FileChunk, error) {
+		placement := &ManifestPlacement{}
+		if ManifestAntiAffinity {
+			placement.AvoidVolumeIds = chunkVolumeIds(dataChunks)
+		}
+		if volumeStorageOf := VolumeStorageOf; volumeStorageOf != nil {
+			placement.Collection, placement.Replication = dominantStorage(dataChunks, volumeStorageOf)
+		}
+		return mergeIntoManifest(func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+			return saveFunc(reader, name, offset, tsNs, placement)
+		}, dataChunks)
+	})
+}
+
+func chunkVolumeIds(chunks []*filer_pb.FileChunk) map[string]struct{} {
+	volumeIds := make(map[string]struct{})
+	for _, chunk := range chunks {
+		volumeIds[VolumeId(chunk.GetFileIdString())] = struct{}{}
+	}
+	return volumeIds
+}
+
+// dominantStorage returns the collection and replication holding the most bytes of the chunks,
+// the first one seen on a tie
+func dominantStorage(chunks []*filer_pb.FileChunk, volumeStorageOf func(volumeId string) (collection, replication string)) (collection, replication string) {
+	type storage struct {
+		collection, replication string
+	}
+	storages := make(map[string]storage)
+	bytes := make(map[storage]uint64)
+	var order []storage
+	for _, chunk := range chunks {
+		volumeId := VolumeId(chunk.GetFileIdString())
+		s, found := storages[volumeId]
+		if !found {
+			s.collection, s.replication = volumeStorageOf(volumeId)
+			storages[volumeId] = s
+		}
+		if _, found := bytes[s]; !found {
+			order = append(order, s)
+		}
+		bytes[s] += chunk.Size
+	}
+	var dominant storage
+	for i, s := range order {
+		if i == 0 || bytes[s] > bytes[dominant] {
+			dominant = s
+		}
+	}
+	return dominant.collection, dominant.replication
+}
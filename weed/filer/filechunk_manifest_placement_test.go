@@ -0,0 +1,74 @@
+package filer
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestMaybeManifestizeWithPlacement(t *testing.T) {
+	var chunks []*filer_pb.FileChunk
+	for i := 0; i < ManifestBatch; i++ {
+		chunks = append(chunks, &filer_pb.FileChunk{FileId: fmt.Sprintf("%d,%x", 1+i%2, i+1), Offset: int64(i), Size: 1})
+	}
+
+	var avoided []map[string]struct{}
+	saveFunc := func(reader io.Reader, name string, offset int64, tsNs int64, placement *ManifestPlacement) (*filer_pb.FileChunk, error) {
+		avoided = append(avoided, placement.AvoidVolumeIds)
+		return &filer_pb.FileChunk{FileId: "3,01"}, nil
+	}
+
+	manifested, err := MaybeManifestizeWithPlacement(saveFunc, chunks)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(manifested))
+	assert.Equal(t, []map[string]struct{}{nil}, avoided)
+
+	ManifestAntiAffinity = true
+	defer func() {
+		ManifestAntiAffinity = false
+	}()
+	avoided = nil
+	_, err = MaybeManifestizeWithPlacement(saveFunc, chunks)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]struct{}{{"1": {}, "2": {}}}, avoided)
+}
+
+func TestMaybeManifestizeWithPlacementStorage(t *testing.T) {
+	var chunks []*filer_pb.FileChunk
+	for i := 0; i < ManifestBatch; i++ {
+		// volume 2 holds fewer chunks, but more bytes
+		volumeId, size := 1, uint64(1)
+		if i%4 == 0 {
+			volumeId, size = 2, 10
+		}
+		chunks = append(chunks, &filer_pb.FileChunk{FileId: fmt.Sprintf("%d,%x", volumeId, i+1), Offset: int64(i) * 10, Size: size})
+	}
+
+	var placements []ManifestPlacement
+	saveFunc := func(reader io.Reader, name string, offset int64, tsNs int64, placement *ManifestPlacement) (*filer_pb.FileChunk, error) {
+		placements = append(placements, *placement)
+		return &filer_pb.FileChunk{FileId: "3,01"}, nil
+	}
+
+	_, err := MaybeManifestizeWithPlacement(saveFunc, chunks)
+	assert.NoError(t, err)
+	assert.Equal(t, []ManifestPlacement{{}}, placements)
+
+	VolumeStorageOf = func(volumeId string) (string, string) {
+		if volumeId == "2" {
+			return "videos", "001"
+		}
+		return "", "000"
+	}
+	defer func() {
+		VolumeStorageOf = nil
+	}()
+	placements = nil
+	_, err = MaybeManifestizeWithPlacement(saveFunc, chunks)
+	assert.NoError(t, err)
+	assert.Equal(t, []ManifestPlacement{{Collection: "videos", Replication: "001"}}, placements)
+}
@@ -0,0 +1,54 @@
+package filer
+
+import (
+	"math"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+// ManifestizePlan is what MaybeManifestizeWithBatch would do with the chunks
+type ManifestizePlan struct {
+	InputChunks    int
+	KeptManifests  []*filer_pb.FileChunk // existing manifest chunks, kept as they are
+	NewManifests   []*PlannedManifest
+	LeftoverChunks []*filer_pb.FileChunk // data chunks not filling a whole batch, kept as they are
+}
+
+// PlannedManifest is a manifest chunk that would be created, with the data chunks merged into it
+type PlannedManifest struct {
+	Offset     int64
+	Size       uint64
+	DataChunks []*filer_pb.FileChunk
+}
+
+// OutputChunks is the number of top-level chunks after manifesting
+func (p *ManifestizePlan) OutputChunks() int {
+	return len(p.KeptManifests) + len(p.NewManifests) + len(p.LeftoverChunks)
+}
+
+// MaybeManifestizePlan plans the merge of the chunks like MaybeManifestizeWithBatch, without saving anything.
+func MaybeManifestizePlan(inputChunks []*filer_pb.FileChunk, batch int) (*ManifestizePlan, error) {
+	if err := checkManifestBatch(batch); err != nil {
+		return nil, err
+	}
+	manifestChunks, batches, remaining := manifestBatches(inputChunks, batch)
+	plan := &ManifestizePlan{
+		InputChunks:    len(inputChunks),
+		KeptManifests:  manifestChunks,
+		LeftoverChunks: remaining,
+	}
+	for _, dataChunks := range batches {
+		// the range mergeIntoManifest gives the manifest chunk
+		minOffset, maxOffset := int64(math.MaxInt64), int64(math.MinInt64)
+		for _, chunk := range dataChunks {
+			minOffset = min(minOffset, chunk.Offset)
+			maxOffset = max(maxOffset, chunk.Offset+int64(chunk.Size))
+		}
+		plan.NewManifests = append(plan.NewManifests, &PlannedManifest{
+			Offset:     minOffset,
+			Size:       uint64(maxOffset - minOffset),
+			DataChunks: dataChunks,
+		})
+	}
+	return plan, nil
+}
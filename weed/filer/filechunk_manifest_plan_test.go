@@ -0,0 +1,47 @@
+package filer
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestMaybeManifestizePlan(t *testing.T) {
+	inputs := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 100, IsChunkManifest: true},
+		{FileId: "1,02", Offset: 100, Size: 10},
+		{FileId: "1,03", Offset: 110, Size: 10},
+		{FileId: "1,04", Offset: 120, Size: 10},
+		{FileId: "1,05", Offset: 130, Size: 10},
+		{FileId: "1,06", Offset: 140, Size: 10},
+	}
+
+	plan, err := MaybeManifestizePlan(inputs, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, plan.InputChunks)
+	assert.Equal(t, inputs[:1], plan.KeptManifests)
+	if assert.Equal(t, 2, len(plan.NewManifests)) {
+		assert.Equal(t, &PlannedManifest{Offset: 100, Size: 20, DataChunks: inputs[1:3]}, plan.NewManifests[0])
+		assert.Equal(t, &PlannedManifest{Offset: 120, Size: 20, DataChunks: inputs[3:5]}, plan.NewManifests[1])
+	}
+	assert.Equal(t, inputs[5:], plan.LeftoverChunks)
+	assert.Equal(t, 4, plan.OutputChunks())
+
+	// the plan matches what is done
+	chunks, err := MaybeManifestizeWithBatch(func(_ io.Reader, _ string, _ int64, _ int64) (*filer_pb.FileChunk, error) {
+		return &filer_pb.FileChunk{FileId: "2,01"}, nil
+	}, inputs, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, plan.OutputChunks(), len(chunks))
+
+	plan, err = MaybeManifestizePlan(inputs, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, plan.NewManifests)
+	assert.Equal(t, 6, plan.OutputChunks())
+
+	_, err = MaybeManifestizePlan(inputs, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,47 @@
+package filer
+
+import (
+	"fmt"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// ReadManifestRange reads the file range [startOffset, stopOffset) covered by one manifest chunk.
+// The manifest is fetched once, and only the data chunks overlapping the range are fetched, as well as
+// the nested manifests overlapping it. The range is clipped to the range of the manifest chunk,
+// and the holes in it read as zeros.
+func ReadManifestRange(lookupFileIdFn wdclient.LookupFileIdFunctionType, manifestChunk *filer_pb.FileChunk, startOffset, stopOffset int64) ([]byte, error) {
+	if !manifestChunk.IsChunkManifest {
+		return nil, fmt.Errorf("%s is not a manifest chunk", manifestChunk.GetFileIdString())
+	}
+	startOffset = max(startOffset, manifestChunk.Offset)
+	stopOffset = min(stopOffset, manifestChunk.Offset+int64(manifestChunk.Size))
+	if startOffset >= stopOffset {
+		return []byte{}, nil
+	}
+
+	chunks, err := ResolveOneChunkManifest(lookupFileIdFn, manifestChunk)
+	if err != nil {
+		return nil, err
+	}
+	visibles, err := NonOverlappingVisibleIntervals(lookupFileIdFn, chunks, startOffset, stopOffset)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, stopOffset-startOffset)
+	readFlow := NewReadFlow(ReadSourceStream)
+	chunkViews := ViewFromVisibleIntervals(visibles, startOffset, stopOffset-startOffset)
+	for x := chunkViews.Front(); x != nil; x = x.Next {
+		chunkView := x.Value
+		buffer := data[chunkView.ViewOffset-startOffset : chunkView.ViewOffset-startOffset+int64(chunkView.ViewSize)]
+		n, err := fetchChunkViewRange(buffer, lookupFileIdFn, chunkView, chunkView.OffsetInChunk, readFlow)
+		if err != nil {
+			return nil, fmt.Errorf("read chunk %s: %v", chunkView.FileId, err)
+		}
+		if n != len(buffer) {
+			return nil, fmt.Errorf("read chunk %s: %d of %d bytes", chunkView.FileId, n, len(buffer))
+		}
+	}
+	return data, nil
+}
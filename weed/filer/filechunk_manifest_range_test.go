@@ -0,0 +1,57 @@
+package filer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestReadManifestRange(t *testing.T) {
+	contents := make(map[string]string)
+	var chunks []*filer_pb.FileChunk
+	var content strings.Builder
+	for i := 0; i < 100; i++ {
+		fileId := fmt.Sprintf("2,%02x", i)
+		data := strings.Repeat(string(rune('a'+i%26)), 10)
+		contents[fileId] = data
+		content.WriteString(data)
+		chunks = append(chunks, &filer_pb.FileChunk{FileId: fileId, Offset: int64(i) * 10, Size: 10, ModifiedTsNs: 1})
+	}
+	manifest, err := proto.Marshal(&filer_pb.FileChunkManifest{Chunks: chunks})
+	assert.NoError(t, err)
+	contents["1,01"] = string(manifest)
+	lookup, closeFn := newTestVolumeServer(t, contents)
+	defer closeFn()
+	var lock sync.Mutex
+	var lookups []string
+	lookupFn := func(fileId string) ([]string, error) {
+		lock.Lock()
+		lookups = append(lookups, fileId)
+		lock.Unlock()
+		return lookup(fileId)
+	}
+	manifestChunk := &filer_pb.FileChunk{FileId: "1,01", Offset: 0, Size: 1000, ModifiedTsNs: 1, IsChunkManifest: true}
+
+	data, err := ReadManifestRange(lookupFn, manifestChunk, 495, 505)
+	assert.NoError(t, err)
+	assert.Equal(t, content.String()[495:505], string(data))
+	// the manifest, and the two chunks overlapping the range
+	assert.Equal(t, []string{"1,01", "2,31", "2,32"}, lookups)
+
+	// clipped to the range of the manifest
+	data, err = ReadManifestRange(lookupFn, manifestChunk, 990, 2000)
+	assert.NoError(t, err)
+	assert.Equal(t, content.String()[990:], string(data))
+	data, err = ReadManifestRange(lookupFn, manifestChunk, 1000, 2000)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+
+	_, err = ReadManifestRange(lookupFn, chunks[0], 0, 10)
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package filer
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/util"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// RecompactFileFunc recompacts the manifests of one file. It should update the file entry only after
+// all new manifests are saved, so the file is either fully recompacted or left as it was.
+type RecompactFileFunc func(path util.FullPath) (ManifestMaintenanceStats, error)
+
+// RecompactionResult tells which files a budgeted recompaction got through
+type RecompactionResult struct {
+	Completed []util.FullPath
+	Failed    map[util.FullPath]error
+	Remaining []util.FullPath // not started before the deadline
+}
+
+// RecompactWithinBudget recompacts the files one at a time until the deadline.
+// A started file is always finished, and no file is started when the time left is shorter than
+// the average time taken per file so far, so the job stops cleanly at the end of its window.
+func RecompactWithinBudget(deadline time.Time, paths []util.FullPath, recompactFile RecompactFileFunc) *RecompactionResult {
+	return recompactWithinBudget(time.Now, deadline, paths, recompactFile)
+}
+
+func recompactWithinBudget(now func() time.Time, deadline time.Time, paths []util.FullPath, recompactFile RecompactFileFunc) *RecompactionResult {
+	result := &RecompactionResult{
+		Failed: make(map[util.FullPath]error),
+	}
+	start := now()
+	var total ManifestMaintenanceStats
+	defer func() {
+		total.Report(ManifestOpRecompact, start)
+	}()
+
+	for i, path := range paths {
+		current := now()
+		if i > 0 {
+			average := current.Sub(start) / time.Duration(i)
+			if current.Add(average).After(deadline) {
+				result.Remaining = paths[i:]
+				break
+			}
+		} else if !current.Before(deadline) {
+			result.Remaining = paths
+			break
+		}
+
+		stats, err := recompactFile(path)
+		if err != nil {
+			glog.Errorf("recompact %s: %v", path, err)
+			result.Failed[path] = err
+			continue
+		}
+		result.Completed = append(result.Completed, path)
+		total.ManifestsRewritten += stats.ManifestsRewritten
+		total.ChunksRewritten += stats.ChunksRewritten
+		total.ManifestsDeleted += stats.ManifestsDeleted
+		total.ChunksDeleted += stats.ChunksDeleted
+		total.BytesMoved += stats.BytesMoved
+	}
+
+	glog.V(0).Infof("recompacted %d files, %d failed, %d remaining", len(result.Completed), len(result.Failed), len(result.Remaining))
+	return result
+}
+
+// ReManifestize repacks the chunks of a file after many edits. The manifests are resolved to their data chunks,
+// the data chunks fully overwritten by later ones are dropped, and the rest are merged again into
+// manifests of batch chunks, in offset order. The old manifests and the dropped data chunks are returned
+// as garbage, to be deleted once the entry is updated with the new chunks.
+func ReManifestize(lookupFileIdFn wdclient.LookupFileIdFunctionType, saveFunc SaveDataAsChunkFunctionType, chunks []*filer_pb.FileChunk, batch int) (remanifested, garbage []*filer_pb.FileChunk, err error) {
+	start := time.Now()
+	dataChunks, manifestChunks, err := ResolveChunkManifestAll(lookupFileIdFn, chunks)
+	if err != nil {
+		return nil, nil, err
+	}
+	visibles, err := NonOverlappingVisibleIntervals(lookupFileIdFn, dataChunks, 0, math.MaxInt64)
+	if err != nil {
+		return nil, nil, err
+	}
+	compacted, shadowed := SeparateGarbageChunks(visibles, dataChunks)
+	sort.SliceStable(compacted, func(i, j int) bool {
+		return compacted[i].Offset < compacted[j].Offset
+	})
+
+	remanifested, err = MaybeManifestizeWithBatch(saveFunc, compacted, batch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stats := ManifestMaintenanceStats{
+		ManifestsDeleted: len(manifestChunks),
+		ChunksDeleted:    len(shadowed),
+	}
+	for _, chunk := range remanifested {
+		if chunk.IsChunkManifest {
+			stats.ManifestsRewritten++
+			stats.BytesMoved += int64(chunk.ManifestSize)
+		}
+	}
+	stats.ChunksRewritten = len(compacted) - (len(remanifested) - stats.ManifestsRewritten)
+	stats.Report(ManifestOpRecompact, start)
+	glog.V(1).Infof("remanifestized %d chunks into %d, %d manifests and %d overwritten chunks dropped", len(chunks), len(remanifested), len(manifestChunks), len(shadowed))
+
+	return remanifested, append(manifestChunks, shadowed...), nil
+}
@@ -0,0 +1,93 @@
+package filer
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/util"
+)
+
+func TestRecompactWithinBudget(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	now := func() time.Time { return clock }
+	paths := []util.FullPath{"/a", "/b", "/c", "/d", "/e"}
+
+	// each file takes 10 minutes, with a 35 minute budget
+	result := recompactWithinBudget(now, clock.Add(35*time.Minute), paths, func(path util.FullPath) (ManifestMaintenanceStats, error) {
+		clock = clock.Add(10 * time.Minute)
+		if path == "/b" {
+			return ManifestMaintenanceStats{}, fmt.Errorf("conflict")
+		}
+		return ManifestMaintenanceStats{ManifestsRewritten: 1}, nil
+	})
+	assert.Equal(t, []util.FullPath{"/a", "/c"}, result.Completed)
+	assert.Equal(t, 1, len(result.Failed))
+	assert.Error(t, result.Failed["/b"])
+	// the 4th file would end after the deadline
+	assert.Equal(t, []util.FullPath{"/d", "/e"}, result.Remaining)
+
+	result = recompactWithinBudget(now, clock, paths, func(path util.FullPath) (ManifestMaintenanceStats, error) {
+		t.Fatalf("should not start %s after the deadline", path)
+		return ManifestMaintenanceStats{}, nil
+	})
+	assert.Empty(t, result.Completed)
+	assert.Equal(t, paths, result.Remaining)
+}
+
+func TestReManifestize(t *testing.T) {
+	contents := make(map[string]string)
+	lookup, closeFn := newTestVolumeServer(t, contents)
+	defer closeFn()
+	var lock sync.Mutex
+	saveFunc := func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		fileId := fmt.Sprintf("1,%02x", len(contents)+1)
+		contents[fileId] = string(data)
+		return &filer_pb.FileChunk{FileId: fileId}, nil
+	}
+
+	// 20 chunks manifested by 8, then the first 40 bytes overwritten 10 times
+	var chunks []*filer_pb.FileChunk
+	for i := 0; i < 20; i++ {
+		chunks = append(chunks, &filer_pb.FileChunk{FileId: fmt.Sprintf("2,%02x", i+1), Offset: int64(i) * 10, Size: 10, ModifiedTsNs: 1})
+	}
+	chunks, err := MaybeManifestizeWithBatch(saveFunc, chunks, 8)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		chunks = append(chunks, &filer_pb.FileChunk{FileId: fmt.Sprintf("3,%02x", i+1), Offset: 0, Size: 40, ModifiedTsNs: int64(i) + 2})
+	}
+	assert.Equal(t, 16, len(chunks))
+
+	visibleIntervals := func(chunks []*filer_pb.FileChunk) (intervals []string) {
+		visibles, err := NonOverlappingVisibleIntervals(lookup, chunks, 0, math.MaxInt64)
+		assert.NoError(t, err)
+		for x := visibles.Front(); x != nil; x = x.Next {
+			intervals = append(intervals, fmt.Sprintf("%s[%d,%d)", x.Value.fileId, x.Value.start, x.Value.stop))
+		}
+		return
+	}
+	before := visibleIntervals(chunks)
+
+	remanifested, garbage, err := ReManifestize(lookup, saveFunc, chunks, 8)
+	assert.NoError(t, err)
+	// chunks 5 to 20 and the last overwrite: two manifests and one loose chunk
+	assert.Equal(t, 3, len(remanifested))
+	assert.True(t, remanifested[0].IsChunkManifest)
+	assert.True(t, remanifested[1].IsChunkManifest)
+	assert.Equal(t, "2,14", remanifested[2].GetFileIdString())
+	// the two old manifests, the four overwritten chunks, and the nine earlier overwrites
+	assert.Equal(t, 15, len(garbage))
+	assert.Equal(t, before, visibleIntervals(remanifested))
+}
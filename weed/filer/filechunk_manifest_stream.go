@@ -0,0 +1,180 @@
+package filer
+
+import (
+	"fmt"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// ResolveChunkManifestStream resolves the chunks like ResolveChunkManifest, but passes each data chunk
+// to eachDataChunkFn as soon as its manifest is resolved, instead of collecting them all.
+// Returning false from eachDataChunkFn stops the resolution, and no more manifests are fetched.
+// Up to ManifestResolveConcurrency manifests ahead are fetched while the earlier chunks are processed.
+func ResolveChunkManifestStream(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, startOffset, stopOffset int64, eachDataChunkFn func(chunk *filer_pb.FileChunk) bool) error {
+	return walkChunkManifest(lookupFileIdFn, chunks, startOffset, stopOffset, func(chunk *filer_pb.FileChunk) bool {
+		return chunk.IsChunkManifest || eachDataChunkFn(chunk)
+	})
+}
+
+// MaxManifestDepth is the deepest nesting of manifests resolved, to fail on corrupted manifests instead of recursing forever
+var MaxManifestDepth = 10
+
+// walkChunkManifest visits the chunks overlapping [startOffset, stopOffset) in order, each manifest chunk
+// before the chunks it lists.
+func walkChunkManifest(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, startOffset, stopOffset int64, fn func(chunk *filer_pb.FileChunk) bool) error {
+	_, err := newManifestWalker(lookupFileIdFn, startOffset, stopOffset, fn).walk(chunks, nil)
+	return err
+}
+
+func newManifestWalker(lookupFileIdFn wdclient.LookupFileIdFunctionType, startOffset, stopOffset int64, fn func(chunk *filer_pb.FileChunk) bool) *manifestWalker {
+	lookahead := ManifestResolveConcurrency
+	if lookahead < 1 {
+		lookahead = 1
+	}
+	return &manifestWalker{
+		lookupFileIdFn: lookupFileIdFn,
+		startOffset:    startOffset,
+		stopOffset:     stopOffset,
+		limiter:        make(chan struct{}, lookahead),
+		lookahead:      lookahead,
+		fn:             fn,
+	}
+}
+
+type manifestWalker struct {
+	lookupFileIdFn wdclient.LookupFileIdFunctionType
+	startOffset    int64
+	stopOffset     int64
+	limiter        chan struct{} // shared by all levels, to cap the fetches in flight
+	lookahead      int
+	fn             func(chunk *filer_pb.FileChunk) bool
+	// if set, a manifest failing to resolve is reported here and skipped, instead of failing the walk
+	onError func(chunk *filer_pb.FileChunk, err error)
+	// visits all the chunks of the file, without checking them against the range
+	all bool
+	// visits the chunks of size 0 within the range too, the manifests among them without resolving them
+	includeEmpty bool
+	// if set, is told the manifests of each chunk list before they are fetched, e.g. to look them up together
+	prelookup func(manifests []*filer_pb.FileChunk)
+}
+
+type manifestFetch struct {
+	chunks []*filer_pb.FileChunk
+	err    error
+	done   chan struct{}
+}
+
+func (w *manifestWalker) overlaps(chunk *filer_pb.FileChunk) bool {
+	if chunk.Size == 0 && w.includeEmpty {
+		return w.all || w.startOffset <= chunk.Offset && chunk.Offset < w.stopOffset
+	}
+	if w.all {
+		return chunk.Size > 0
+	}
+	return max(chunk.Offset, w.startOffset) < min(chunk.Offset+int64(chunk.Size), w.stopOffset)
+}
+
+func (w *manifestWalker) fetch(chunk *filer_pb.FileChunk) *manifestFetch {
+	f := &manifestFetch{done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		// only the fetch holds a slot, so nested manifests can not starve their parents
+		w.limiter <- struct{}{}
+		f.chunks, f.err = ResolveOneChunkManifest(w.lookupFileIdFn, chunk)
+		<-w.limiter
+	}()
+	return f
+}
+
+// checkNesting fails if the manifest is one of its ancestors, or too deeply nested
+func checkNesting(chunk *filer_pb.FileChunk, ancestors []string) error {
+	for _, ancestor := range ancestors {
+		if ancestor == chunk.GetFileIdString() {
+			return fmt.Errorf("manifest cycle detected at %s", ancestor)
+		}
+	}
+	if len(ancestors) >= MaxManifestDepth {
+		return fmt.Errorf("manifest depth exceeded: %s is nested in %d manifests", chunk.GetFileIdString(), len(ancestors))
+	}
+	return nil
+}
+
+func manifestParent(ancestors []string) string {
+	if len(ancestors) == 0 {
+		return "the entry"
+	}
+	return "manifest " + ancestors[len(ancestors)-1]
+}
+
+// walk visits the chunks listed in the manifests of the ancestors file ids, outermost first
+func (w *manifestWalker) walk(chunks []*filer_pb.FileChunk, ancestors []string) (keepGoing bool, err error) {
+	var manifests []int
+	for i, chunk := range chunks {
+		if chunk.IsChunkManifest && chunk.Size > 0 && w.overlaps(chunk) && checkNesting(chunk, ancestors) == nil {
+			manifests = append(manifests, i)
+		}
+	}
+	if w.prelookup != nil && len(manifests) > 0 {
+		manifestChunks := make([]*filer_pb.FileChunk, 0, len(manifests))
+		for _, i := range manifests {
+			manifestChunks = append(manifestChunks, chunks[i])
+		}
+		w.prelookup(manifestChunks)
+	}
+	fetches := make(map[int]*manifestFetch, min(int64(len(manifests)), int64(w.lookahead)))
+	launched, visited := 0, 0
+
+	for i, chunk := range chunks {
+		if chunk.IsChunkManifest && chunk.Size == 0 {
+			// covers no data, but tells a broken entry
+			glog.Warningf("skip manifest %s of size 0 in %s", chunk.GetFileIdString(), manifestParent(ancestors))
+			if w.includeEmpty && w.overlaps(chunk) && !w.fn(chunk) {
+				return false, nil
+			}
+			continue
+		}
+		if !w.overlaps(chunk) {
+			continue
+		}
+		if !chunk.IsChunkManifest {
+			if !w.fn(chunk) {
+				return false, nil
+			}
+			continue
+		}
+
+		if err = checkNesting(chunk, ancestors); err != nil {
+			if w.onError != nil {
+				w.onError(chunk, err)
+				continue
+			}
+			return false, err
+		}
+		// fetch this manifest and the next ones
+		for ; launched < len(manifests) && launched < visited+w.lookahead; launched++ {
+			fetches[manifests[launched]] = w.fetch(chunks[manifests[launched]])
+		}
+		visited++
+		f := fetches[i]
+		delete(fetches, i)
+		<-f.done
+		if f.err != nil {
+			if w.onError != nil {
+				w.onError(chunk, f.err)
+				continue
+			}
+			return false, f.err
+		}
+		if !w.fn(chunk) {
+			return false, nil
+		}
+		// recursive, on a copy of the ancestors shared with the siblings
+		nestedAncestors := append(ancestors[:len(ancestors):len(ancestors)], chunk.GetFileIdString())
+		if keepGoing, err = w.walk(f.chunks, nestedAncestors); !keepGoing || err != nil {
+			return keepGoing, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,133 @@
+package filer
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestResolveChunkManifestStream(t *testing.T) {
+	defer func(concurrency int) {
+		ManifestResolveConcurrency = concurrency
+	}(ManifestResolveConcurrency)
+	ManifestResolveConcurrency = 1
+
+	contents := make(map[string]string)
+	var chunks []*filer_pb.FileChunk
+	for i := 0; i < 5; i++ {
+		offset := int64(i * 20)
+		manifest, err := proto.Marshal(&filer_pb.FileChunkManifest{
+			Chunks: []*filer_pb.FileChunk{
+				{FileId: fmt.Sprintf("2,%02x", 2*i+1), Offset: offset, Size: 10},
+				{FileId: fmt.Sprintf("2,%02x", 2*i+2), Offset: offset + 10, Size: 10},
+			},
+		})
+		assert.NoError(t, err)
+		manifestId := fmt.Sprintf("1,%02x", i+1)
+		contents[manifestId] = string(manifest)
+		chunks = append(chunks, &filer_pb.FileChunk{FileId: manifestId, Offset: offset, Size: 20, IsChunkManifest: true})
+	}
+	lookup, closeFn := newTestVolumeServer(t, contents)
+	defer closeFn()
+	var lookups int32
+	lookupFn := func(fileId string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		return lookup(fileId)
+	}
+
+	// stop after the first chunk past offset 30
+	var fileIds []string
+	err := ResolveChunkManifestStream(lookupFn, chunks, 0, math.MaxInt64, func(chunk *filer_pb.FileChunk) bool {
+		fileIds = append(fileIds, chunk.GetFileIdString())
+		return chunk.Offset < 30
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2,01", "2,02", "2,03", "2,04"}, fileIds)
+	// with a concurrency of 1, no manifest is fetched ahead
+	assert.Equal(t, int32(2), atomic.LoadInt32(&lookups))
+
+	// missing manifests fail the resolution
+	err = ResolveChunkManifestStream(lookupFn, append(chunks, &filer_pb.FileChunk{FileId: "1,09", Offset: 100, Size: 10, IsChunkManifest: true}), 0, math.MaxInt64, func(chunk *filer_pb.FileChunk) bool {
+		return true
+	})
+	assert.Error(t, err)
+}
+
+func TestResolveChunkManifestNesting(t *testing.T) {
+	newManifest := func(chunks ...*filer_pb.FileChunk) string {
+		data, err := proto.Marshal(&filer_pb.FileChunkManifest{Chunks: chunks})
+		assert.NoError(t, err)
+		return string(data)
+	}
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		// lists itself after a data chunk
+		"1,01": newManifest(
+			&filer_pb.FileChunk{FileId: "1,02", Offset: 0, Size: 10},
+			&filer_pb.FileChunk{FileId: "1,01", Offset: 10, Size: 10, IsChunkManifest: true},
+		),
+		// a chain of three manifests
+		"2,01": newManifest(&filer_pb.FileChunk{FileId: "2,02", Offset: 0, Size: 10, IsChunkManifest: true}),
+		"2,02": newManifest(&filer_pb.FileChunk{FileId: "2,03", Offset: 0, Size: 10, IsChunkManifest: true}),
+		"2,03": newManifest(&filer_pb.FileChunk{FileId: "2,04", Offset: 0, Size: 10}),
+	})
+	defer closeFn()
+
+	_, _, err := ResolveChunkManifest(lookup, []*filer_pb.FileChunk{{FileId: "1,01", Offset: 0, Size: 20, IsChunkManifest: true}}, 0, math.MaxInt64)
+	assert.EqualError(t, err, "manifest cycle detected at 1,01")
+
+	chain := []*filer_pb.FileChunk{{FileId: "2,01", Offset: 0, Size: 10, IsChunkManifest: true}}
+	dataChunks, manifestChunks, err := ResolveChunkManifest(lookup, chain, 0, math.MaxInt64)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(dataChunks))
+	assert.Equal(t, 3, len(manifestChunks))
+
+	defer func(depth int) {
+		MaxManifestDepth = depth
+	}(MaxManifestDepth)
+	MaxManifestDepth = 2
+	_, _, err = ResolveChunkManifest(lookup, chain, 0, math.MaxInt64)
+	assert.ErrorContains(t, err, "manifest depth exceeded")
+}
+
+func TestResolveChunkManifestBestEffort(t *testing.T) {
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 0, Size: 10},
+			// lost
+			{FileId: "1,03", Offset: 10, Size: 10, IsChunkManifest: true},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(data)})
+	defer closeFn()
+
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 20, IsChunkManifest: true},
+		// lost
+		{FileId: "1,04", Offset: 20, Size: 10, IsChunkManifest: true},
+		{FileId: "1,05", Offset: 30, Size: 10},
+	}
+	_, _, err = ResolveChunkManifest(lookup, chunks, 0, math.MaxInt64)
+	assert.Error(t, err)
+
+	dataChunks, manifestChunks, errs := ResolveChunkManifestBestEffort(lookup, chunks, 0, math.MaxInt64)
+	if assert.Equal(t, 2, len(dataChunks)) {
+		assert.Equal(t, "1,02", dataChunks[0].GetFileIdString())
+		assert.Equal(t, "1,05", dataChunks[1].GetFileIdString())
+	}
+	assert.Equal(t, 1, len(manifestChunks))
+	if assert.Equal(t, 2, len(errs)) {
+		var resolveErr *ManifestResolveError
+		assert.ErrorAs(t, errs[0], &resolveErr)
+		assert.Equal(t, "1,03", resolveErr.FileId)
+		assert.Equal(t, int64(10), resolveErr.Offset)
+		assert.ErrorAs(t, errs[1], &resolveErr)
+		assert.Equal(t, "1,04", resolveErr.FileId)
+	}
+}
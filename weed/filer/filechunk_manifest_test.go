@@ -2,12 +2,27 @@ package filer
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/stats"
+	"github.com/seaweedfs/seaweedfs/weed/util"
 )
 
 func TestDoMaybeManifestize(t *testing.T) {
@@ -111,3 +126,1469 @@ func mockMerge(saveFunc SaveDataAsChunkFunctionType, dataChunks []*filer_pb.File
 
 	return
 }
+
+func TestMergeIntoManifestModifiedTsNs(t *testing.T) {
+	var savedTsNs int64
+	saveFunc := func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		savedTsNs = tsNs
+		return &filer_pb.FileChunk{FileId: "manifest"}, nil
+	}
+	manifestChunk, err := mergeIntoManifest(saveFunc, []*filer_pb.FileChunk{
+		{FileId: "1", Offset: 0, Size: 10, ModifiedTsNs: 3},
+		{FileId: "2", Offset: 10, Size: 10, ModifiedTsNs: 7},
+		{FileId: "3", Offset: 20, Size: 10, ModifiedTsNs: 5},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), savedTsNs)
+	assert.Equal(t, int64(7), manifestChunk.ModifiedTsNs)
+	assert.NotZero(t, manifestChunk.ManifestSize)
+
+	assert.Equal(t, int64(9), MaxModifiedTsNs([]*filer_pb.FileChunk{
+		manifestChunk,
+		{FileId: "4", Offset: 30, Size: 10, ModifiedTsNs: 9},
+	}))
+}
+
+func TestMergeIntoManifestOutOfRange(t *testing.T) {
+	var saved int
+	saveFunc := func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		saved++
+		return &filer_pb.FileChunk{FileId: "manifest"}, nil
+	}
+	_, err := mergeIntoManifest(saveFunc, nil)
+	assert.Error(t, err)
+	_, err = mergeIntoManifest(saveFunc, []*filer_pb.FileChunk{
+		{FileId: "1", Offset: 0, Size: 10},
+		{FileId: "2", Offset: math.MaxInt64 - 5, Size: 10},
+	})
+	assert.ErrorContains(t, err, "chunk 2 at offset")
+	_, err = mergeIntoManifest(saveFunc, []*filer_pb.FileChunk{
+		{FileId: "1", Offset: -10, Size: 10},
+	})
+	assert.Error(t, err)
+	_, err = mergeIntoManifest(saveFunc, []*filer_pb.FileChunk{
+		{FileId: "1", Offset: 0, Size: math.MaxUint64},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, saved)
+
+	// up to the largest offset
+	manifestChunk, err := mergeIntoManifest(saveFunc, []*filer_pb.FileChunk{
+		{FileId: "1", Offset: math.MaxInt64 - 20, Size: 10},
+		{FileId: "2", Offset: math.MaxInt64 - 10, Size: 10},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64-20), manifestChunk.Offset)
+	assert.Equal(t, uint64(20), manifestChunk.Size)
+}
+
+func TestMergeIntoManifestNonContiguous(t *testing.T) {
+	var saved int
+	saveFunc := func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		saved++
+		return &filer_pb.FileChunk{FileId: "manifest"}, nil
+	}
+	gapped := []*filer_pb.FileChunk{
+		{FileId: "1", Offset: 0, Size: 10},
+		{FileId: "2", Offset: 15, Size: 10},
+		{FileId: "3", Offset: 30, Size: 10},
+	}
+
+	// merged anyway by default
+	manifestChunk, err := mergeIntoManifest(saveFunc, gapped)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(40), manifestChunk.Size)
+	assert.Equal(t, 1, saved)
+
+	defer func() {
+		RejectNonContiguousManifests = false
+	}()
+	RejectNonContiguousManifests = true
+	_, err = mergeIntoManifest(saveFunc, gapped)
+	assert.ErrorIs(t, err, ErrNonContiguousManifest)
+	assert.ErrorContains(t, err, "2 gaps or overlaps among 3 chunks, first gap [10,15) between 1 and 2")
+	assert.Equal(t, 1, saved)
+
+	// left unmerged
+	chunks, err := MaybeManifestizeWithBatch(saveFunc, gapped, 3)
+	assert.ErrorIs(t, err, ErrNonContiguousManifest)
+	assertEqualChunks(t, gapped, chunks)
+
+	_, err = mergeIntoManifest(saveFunc, []*filer_pb.FileChunk{
+		{FileId: "1", Offset: 0, Size: 10},
+		{FileId: "2", Offset: 10, Size: 10},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, saved)
+}
+
+func TestChunksExtent(t *testing.T) {
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 10, Size: 10, ModifiedTsNs: 2},
+			{FileId: "1,03", Offset: 20, Size: 10, ModifiedTsNs: 3},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(data)})
+	defer closeFn()
+
+	chunks := []*filer_pb.FileChunk{
+		// the manifest chunk metadata claims more than its content
+		{FileId: "1,01", Offset: 10, Size: 30, ModifiedTsNs: 5, IsChunkManifest: true},
+		{FileId: "1,04", Offset: 40, Size: 10, ModifiedTsNs: 4},
+	}
+
+	assert.Equal(t, ChunksExtent{StartOffset: 10, StopOffset: 50, ModifiedTsNs: 5}, UnverifiedChunksExtent(chunks))
+
+	extent, err := VerifiedChunksExtent(lookup, chunks)
+	assert.NoError(t, err)
+	assert.Equal(t, ChunksExtent{StartOffset: 10, StopOffset: 50, ModifiedTsNs: 4}, extent)
+
+	assert.Equal(t, ChunksExtent{}, UnverifiedChunksExtent(nil))
+}
+
+func TestSeparateEntryChunks(t *testing.T) {
+	assert.False(t, HasChunkManifestInEntry(nil))
+	manifestChunks, nonManifestChunks := SeparateEntryChunks(nil)
+	assert.Empty(t, manifestChunks)
+	assert.Empty(t, nonManifestChunks)
+
+	assert.False(t, HasChunkManifestInEntry(&filer_pb.Entry{}))
+	manifestChunks, nonManifestChunks = SeparateEntryChunks(&filer_pb.Entry{})
+	assert.Empty(t, manifestChunks)
+	assert.Empty(t, nonManifestChunks)
+
+	entry := &filer_pb.Entry{Chunks: []*filer_pb.FileChunk{
+		{FileId: "1,01"},
+		{FileId: "1,02", IsChunkManifest: true},
+		{FileId: "1,03"},
+	}}
+	assert.True(t, HasChunkManifestInEntry(entry))
+	manifestChunks, nonManifestChunks = SeparateEntryChunks(entry)
+	assert.Equal(t, []*filer_pb.FileChunk{entry.Chunks[1]}, manifestChunks)
+	assert.Equal(t, []*filer_pb.FileChunk{entry.Chunks[0], entry.Chunks[2]}, nonManifestChunks)
+}
+
+func TestSummarizeChunks(t *testing.T) {
+	manifestCount, dataCount, totalLogicalSize, maxOffsetEnd := SummarizeChunks([]*filer_pb.FileChunk{
+		{FileId: "1,04", Offset: 50, Size: 10},
+		{FileId: "1,01", Offset: 0, Size: 30, IsChunkManifest: true},
+		// overlaps the manifest
+		{FileId: "1,02", Offset: 20, Size: 20},
+		// within the previous chunk
+		{FileId: "1,03", Offset: 25, Size: 5},
+	})
+	assert.Equal(t, 1, manifestCount)
+	assert.Equal(t, 3, dataCount)
+	assert.Equal(t, uint64(50), totalLogicalSize)
+	assert.Equal(t, int64(60), maxOffsetEnd)
+
+	manifestCount, dataCount, totalLogicalSize, maxOffsetEnd = SummarizeChunks(nil)
+	assert.Equal(t, 0, manifestCount+dataCount)
+	assert.Equal(t, uint64(0), totalLogicalSize)
+	assert.Equal(t, int64(0), maxOffsetEnd)
+}
+
+func TestEstimateManifestSavings(t *testing.T) {
+	var chunks []*filer_pb.FileChunk
+	for i := 0; i < 100; i++ {
+		chunks = append(chunks, &filer_pb.FileChunk{
+			FileId:       fmt.Sprintf("3,%x12345678", i+1),
+			Offset:       int64(i * 1024),
+			Size:         1024,
+			ModifiedTsNs: int64(i + 1),
+			ETag:         "1B2M2Y8AsgTpgAmY7PhCfg==",
+		})
+	}
+
+	savings, err := EstimateManifestSavings(chunks, 50)
+	assert.NoError(t, err)
+	assert.Greater(t, savings.CurrentSize, savings.ManifestedSize)
+	assert.Greater(t, savings.ManifestStorage, 0)
+	assert.Equal(t, "3,112345678", chunks[0].FileId, "input chunks should not be modified")
+
+	// nothing to merge
+	savings, err = EstimateManifestSavings(chunks[:3], 50)
+	assert.NoError(t, err)
+	assert.Equal(t, savings.CurrentSize, savings.ManifestedSize)
+	assert.Equal(t, 0, savings.ManifestStorage)
+	assert.Equal(t, 0, savings.NetSavings())
+
+	for _, mergeFactor := range []int{-1, 0, 1} {
+		_, err = EstimateManifestSavings(chunks, mergeFactor)
+		assert.Error(t, err, "merge factor %d", mergeFactor)
+	}
+}
+
+func TestResolveOneChunkManifestCoalesced(t *testing.T) {
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 0, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(data)})
+	defer closeFn()
+
+	var lookupCount int32
+	release := make(chan struct{})
+	lookupFn := func(fileId string) ([]string, error) {
+		atomic.AddInt32(&lookupCount, 1)
+		<-release
+		return lookup(fileId)
+	}
+
+	manifestChunk := &filer_pb.FileChunk{FileId: "1,01", Offset: 0, Size: 10, IsChunkManifest: true}
+	var wg sync.WaitGroup
+	results := make([][]*filer_pb.FileChunk, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = ResolveOneChunkManifest(lookupFn, manifestChunk)
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lookupCount))
+	for _, result := range results {
+		assert.Equal(t, 1, len(result))
+		assert.Equal(t, "1,02", result[0].GetFileIdString())
+	}
+}
+
+func TestResolveOneChunkManifestVersion(t *testing.T) {
+	newManifest := func(version int32) string {
+		data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+			Chunks:  []*filer_pb.FileChunk{{FileId: "1,09", Offset: 0, Size: 10}},
+			Version: version,
+		})
+		assert.NoError(t, err)
+		return string(data)
+	}
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": newManifest(0),
+		"1,02": newManifest(ManifestVersion),
+		"1,03": newManifest(ManifestVersion + 1),
+	})
+	defer closeFn()
+
+	for _, fileId := range []string{"1,01", "1,02"} {
+		chunks, err := ResolveOneChunkManifest(lookup, &filer_pb.FileChunk{FileId: fileId, Size: 10, IsChunkManifest: true})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(chunks))
+	}
+
+	_, err := ResolveOneChunkManifest(lookup, &filer_pb.FileChunk{FileId: "1,03", Size: 10, IsChunkManifest: true})
+	assert.ErrorContains(t, err, "unsupported manifest version")
+}
+
+func TestResolveChunkManifestWithLocations(t *testing.T) {
+	manifest, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,01", Offset: 0, Size: 4, ModifiedTsNs: 1},
+			{FileId: "1,02", Offset: 4, Size: 4, ModifiedTsNs: 2},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,10": string(manifest),
+	})
+	defer closeFn()
+
+	lookups := make(map[string]int)
+	countingLookup := func(fileId string) ([]string, error) {
+		lookups[fileId]++
+		return lookup(fileId)
+	}
+	located, err := ResolveChunkManifestWithLocations(countingLookup, []*filer_pb.FileChunk{
+		{FileId: "1,10", Offset: 0, Size: 8, ModifiedTsNs: 2, IsChunkManifest: true},
+		{FileId: "1,03", Offset: 8, Size: 4, ModifiedTsNs: 3},
+		{FileId: "1,03", Offset: 12, Size: 4, ModifiedTsNs: 4},
+	}, 0, math.MaxInt64)
+	assert.NoError(t, err)
+	if assert.Equal(t, 4, len(located)) {
+		for i, fileId := range []string{"1,01", "1,02", "1,03", "1,03"} {
+			assert.Equal(t, fileId, located[i].Chunk.GetFileIdString())
+			if assert.Equal(t, 1, len(located[i].Urls)) {
+				assert.True(t, strings.HasSuffix(located[i].Urls[0], "/"+fileId), located[i].Urls[0])
+			}
+		}
+	}
+	assert.Equal(t, 1, lookups["1,03"])
+	assert.Equal(t, 1, lookups["1,01"])
+}
+
+func TestRetriedFetchChunkDataStatus(t *testing.T) {
+	var requests int32
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	defer func(wait time.Duration) {
+		util.RetryWaitTime = wait
+	}(util.RetryWaitTime)
+	util.RetryWaitTime = 6 * time.Second
+	clock, restoreClock := useFakeClock()
+	defer restoreClock()
+	urls := []string{server.URL + "/1,01", server.URL + "/1,01"}
+	fetchCount := func(counterType string) float64 {
+		return testutil.ToFloat64(stats.FilerChunkFetchCounter.WithLabelValues(stats.ChunkFetchRange, counterType))
+	}
+	urlFailureCount := func() float64 {
+		return testutil.ToFloat64(stats.FilerChunkFetchUrlFailureCounter.WithLabelValues(stats.ChunkFetchRange, volumeServerOf(urls[0])))
+	}
+	attempts, retries, exhausted, urlFailures := fetchCount(stats.ChunkFetchAttempt), fetchCount(stats.ChunkFetchRetry), fetchCount(stats.ChunkFetchExhausted), urlFailureCount()
+
+	// permanent errors are not retried on other replicas
+	status = http.StatusRequestedRangeNotSatisfiable
+	_, err := retriedFetchChunkData(make([]byte, 4), urls, nil, false, false, 0, nil)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	atomic.StoreInt32(&requests, 0)
+	assert.Empty(t, clock.sleeps)
+
+	// transient errors are retried on all replicas, backing off by half each round
+	atomic.StoreInt32(&requests, 0)
+	status = http.StatusServiceUnavailable
+	_, err = retriedFetchChunkData(make([]byte, 4), urls, nil, false, false, 0, nil)
+	assert.Error(t, err)
+	assert.Equal(t, int32(10), atomic.LoadInt32(&requests))
+	assert.Equal(t, []time.Duration{time.Second, 1500 * time.Millisecond, 2250 * time.Millisecond, 3375 * time.Millisecond, 5062500 * time.Microsecond}, clock.sleeps)
+
+	assert.Equal(t, attempts+11, fetchCount(stats.ChunkFetchAttempt))
+	assert.Equal(t, retries+9, fetchCount(stats.ChunkFetchRetry))
+	assert.Equal(t, exhausted+1, fetchCount(stats.ChunkFetchExhausted))
+	assert.Equal(t, urlFailures+11, urlFailureCount())
+}
+
+func TestChunkFetchedHook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/down/") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+	type fetched struct {
+		fileId, urlString string
+		bytes             int64
+		attempts          int
+	}
+	var hits []fetched
+	defer func(hook func(string, string, int64, int)) {
+		ChunkFetchedHook = hook
+	}(ChunkFetchedHook)
+	ChunkFetchedHook = func(fileId, urlString string, bytes int64, attempts int) {
+		hits = append(hits, fetched{fileId, urlString, bytes, attempts})
+	}
+
+	urls := []string{server.URL + "/down/1,01", server.URL + "/1,01"}
+	var buf bytes.Buffer
+	_, err := retriedStreamFetchChunkData(&buf, urls, nil, false, true, 0, 0, nil)
+	assert.NoError(t, err)
+	_, err = retriedFetchChunkData(make([]byte, 4), urls[1:], nil, false, true, 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []fetched{
+		{"1,01", urls[1], 4, 2},
+		{"1,01", urls[1], 4, 1},
+	}, hits)
+
+	// failed fetches are not reported
+	hits = nil
+	_, err = retriedFetchChunkData(make([]byte, 4), urls[:1], nil, false, true, 0, &ReadFlow{retry: &RetryPolicy{InitialWait: time.Millisecond, MaxWait: time.Hour, MaxAttempts: 1}})
+	assert.Error(t, err)
+	assert.Empty(t, hits)
+}
+
+func TestRetriedFetchChunkDataContext(t *testing.T) {
+	var hang atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hang.Load() {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	defer func(wait time.Duration) {
+		util.RetryWaitTime = wait
+	}(util.RetryWaitTime)
+	util.RetryWaitTime = time.Minute
+	urls := []string{server.URL + "/1,01"}
+
+	// the backoff sleep is cut short
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := retriedFetchChunkDataWithContext(ctx, make([]byte, 4), urls, nil, CompressionNone, false, 0, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// the request in flight is cancelled
+	hang.Store(true)
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = retriedStreamFetchChunkDataWithContext(ctx, io.Discard, urls, nil, CompressionNone, false, 0, 4, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestResolveOneChunkManifestDuplicates(t *testing.T) {
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,01", Offset: 0, Size: 10, ModifiedTsNs: 1},
+			{FileId: "1,02", Offset: 10, Size: 10, ModifiedTsNs: 2},
+			{FileId: "1,01", Offset: 0, Size: 10, ModifiedTsNs: 1},
+			{FileId: "1,01", Offset: 20, Size: 10, ModifiedTsNs: 3},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,10": string(data),
+	})
+	defer closeFn()
+	defer func(dedup bool) {
+		DeduplicateManifestChunks = dedup
+	}(DeduplicateManifestChunks)
+
+	manifestChunk := &filer_pb.FileChunk{FileId: "1,10", Size: 30, IsChunkManifest: true}
+	DeduplicateManifestChunks = false
+	chunks, err := ResolveOneChunkManifest(lookup, manifestChunk)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(chunks))
+
+	DeduplicateManifestChunks = true
+	chunks, err = ResolveOneChunkManifest(lookup, manifestChunk)
+	assert.NoError(t, err)
+	if assert.Equal(t, 3, len(chunks)) {
+		assert.Equal(t, "1,01", chunks[0].GetFileIdString())
+		assert.Equal(t, "1,02", chunks[1].GetFileIdString())
+		assert.Equal(t, int64(20), chunks[2].Offset)
+	}
+}
+
+func TestResolveChunkManifestParallel(t *testing.T) {
+	defer func(concurrency int) {
+		ManifestResolveConcurrency = concurrency
+	}(ManifestResolveConcurrency)
+	ManifestResolveConcurrency = 3
+
+	// each top level manifest lists a data chunk and a nested manifest with another data chunk
+	contents := make(map[string]string)
+	var chunks []*filer_pb.FileChunk
+	var expected []string
+	for i := 0; i < 6; i++ {
+		offset := int64(i * 20)
+		manifestId, nestedId := fmt.Sprintf("1,%02x", 2*i+1), fmt.Sprintf("2,%02x", 2*i+1)
+		dataId, nestedDataId := fmt.Sprintf("1,%02x", 2*i+2), fmt.Sprintf("2,%02x", 2*i+2)
+		nested, err := proto.Marshal(&filer_pb.FileChunkManifest{
+			Chunks: []*filer_pb.FileChunk{{FileId: nestedDataId, Offset: offset + 10, Size: 10}},
+		})
+		assert.NoError(t, err)
+		manifest, err := proto.Marshal(&filer_pb.FileChunkManifest{
+			Chunks: []*filer_pb.FileChunk{
+				{FileId: dataId, Offset: offset, Size: 10},
+				{FileId: nestedId, Offset: offset + 10, Size: 10, IsChunkManifest: true},
+			},
+		})
+		assert.NoError(t, err)
+		contents[manifestId], contents[nestedId] = string(manifest), string(nested)
+		chunks = append(chunks, &filer_pb.FileChunk{FileId: manifestId, Offset: offset, Size: 20, IsChunkManifest: true})
+		expected = append(expected, dataId, nestedDataId)
+	}
+	lookup, closeFn := newTestVolumeServer(t, contents)
+	defer closeFn()
+
+	var inFlight, maxInFlight int32
+	lookupFn := func(fileId string) ([]string, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return lookup(fileId)
+	}
+
+	dataChunks, manifestChunks, err := ResolveChunkManifest(lookupFn, chunks, 0, math.MaxInt64)
+	assert.NoError(t, err)
+	var fileIds []string
+	for _, chunk := range dataChunks {
+		fileIds = append(fileIds, chunk.GetFileIdString())
+	}
+	assert.Equal(t, expected, fileIds)
+	assert.Equal(t, 12, len(manifestChunks))
+	// the scheduling decides how many of the lookups overlap
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(ManifestResolveConcurrency))
+	assert.Greater(t, atomic.LoadInt32(&maxInFlight), int32(1))
+
+	// only the manifests overlapping the range are fetched
+	dataChunks, manifestChunks, err = ResolveChunkManifest(lookupFn, chunks, 55, 60)
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(dataChunks)) {
+		assert.Equal(t, "2,06", dataChunks[0].GetFileIdString())
+	}
+	assert.Equal(t, 2, len(manifestChunks))
+}
+
+func TestMaybeManifestizeWithBatch(t *testing.T) {
+	var inputs []*filer_pb.FileChunk
+	for i := 0; i < 7; i++ {
+		inputs = append(inputs, &filer_pb.FileChunk{FileId: fmt.Sprintf("1,%02x", i+1), Offset: int64(i * 10), Size: 10})
+	}
+	var saved int32
+	saveFunc := func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		return &filer_pb.FileChunk{FileId: fmt.Sprintf("2,%02x", atomic.AddInt32(&saved, 1))}, nil
+	}
+
+	for _, test := range []struct {
+		batch     int
+		manifests int
+		remaining int
+	}{
+		{batch: 2, manifests: 3, remaining: 1},
+		{batch: 3, manifests: 2, remaining: 1},
+		{batch: 8, manifests: 0, remaining: 7},
+	} {
+		saved = 0
+		chunks, err := MaybeManifestizeWithBatch(saveFunc, inputs, test.batch)
+		assert.NoError(t, err)
+		manifestChunks, dataChunks := SeparateManifestChunks(chunks)
+		assert.Equal(t, test.manifests, len(manifestChunks), "batch %d", test.batch)
+		assert.Equal(t, test.remaining, len(dataChunks), "batch %d", test.batch)
+		for _, manifestChunk := range manifestChunks {
+			assert.Equal(t, uint64(10*test.batch), manifestChunk.Size)
+		}
+	}
+
+	for _, batch := range []int{-1, 0, 1} {
+		chunks, err := MaybeManifestizeWithBatch(saveFunc, inputs, batch)
+		assert.Error(t, err)
+		assert.Equal(t, inputs, chunks)
+	}
+}
+
+func TestSetManifestBatch(t *testing.T) {
+	defer SetManifestBatch(ManifestBatch)
+	assert.Equal(t, ManifestBatch, EffectiveManifestBatch())
+
+	assert.NoError(t, SetManifestBatch(3))
+	assert.Equal(t, 3, EffectiveManifestBatch())
+	for _, batch := range []int{-1, 0, 1} {
+		assert.Error(t, SetManifestBatch(batch))
+		assert.Equal(t, 3, EffectiveManifestBatch(), "batch %d", batch)
+	}
+
+	var inputs []*filer_pb.FileChunk
+	for i := 0; i < 7; i++ {
+		inputs = append(inputs, &filer_pb.FileChunk{FileId: fmt.Sprintf("1,%02x", i+1), Offset: int64(i * 10), Size: 10})
+	}
+	chunks, err := MaybeManifestize(slowManifestSaveFunc(0), inputs)
+	assert.NoError(t, err)
+	manifestChunks, dataChunks := SeparateManifestChunks(chunks)
+	assert.Equal(t, 2, len(manifestChunks))
+	assert.Equal(t, 1, len(dataChunks))
+}
+
+// slowManifestSaveFunc saves each manifest after the delay, naming it after the first chunk it contains
+func slowManifestSaveFunc(delay time.Duration) SaveDataAsChunkFunctionType {
+	return func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		chunks, err := ParseChunkManifest(data)
+		if err != nil {
+			return nil, err
+		}
+		time.Sleep(delay)
+		return &filer_pb.FileChunk{FileId: "9," + strings.TrimPrefix(chunks[0].GetFileIdString(), "1,")}, nil
+	}
+}
+
+func TestMaybeManifestizeConcurrently(t *testing.T) {
+	defer func(concurrency int) {
+		ManifestizeConcurrency = concurrency
+	}(ManifestizeConcurrency)
+
+	var inputs []*filer_pb.FileChunk
+	for i := 0; i < 21; i++ {
+		inputs = append(inputs, &filer_pb.FileChunk{FileId: fmt.Sprintf("1,%02x", i+1), Offset: int64(i * 10), Size: 10})
+	}
+	// the later batches are saved faster, and still come in offset order
+	var saves int32
+	saveFunc := slowManifestSaveFunc(0)
+	unevenSaveFunc := func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		time.Sleep(time.Duration(10-atomic.AddInt32(&saves, 1)) * time.Millisecond)
+		return saveFunc(reader, name, offset, tsNs)
+	}
+
+	var expected []*filer_pb.FileChunk
+	for _, concurrency := range []int{0, 1, 4, 100} {
+		ManifestizeConcurrency = concurrency
+		saves = 0
+		chunks, err := MaybeManifestizeWithBatch(unevenSaveFunc, inputs, 2)
+		assert.NoError(t, err, "concurrency %d", concurrency)
+		assert.Equal(t, 11, len(chunks), "concurrency %d", concurrency)
+		for i, chunk := range chunks[:10] {
+			assert.Equal(t, fmt.Sprintf("9,%02x", 2*i+1), chunk.GetFileIdString(), "concurrency %d", concurrency)
+			assert.Equal(t, int64(20*i), chunk.Offset, "concurrency %d", concurrency)
+		}
+		if expected == nil {
+			expected = chunks
+		}
+		assert.Equal(t, expected, chunks, "concurrency %d", concurrency)
+	}
+
+	// a failed batch fails the whole merge
+	ManifestizeConcurrency = 4
+	saves = 0
+	chunks, err := MaybeManifestizeWithBatch(func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		if atomic.AddInt32(&saves, 1) == 3 {
+			return nil, fmt.Errorf("volume full")
+		}
+		return saveFunc(reader, name, offset, tsNs)
+	}, inputs, 2)
+	assert.Error(t, err)
+	assert.Equal(t, inputs, chunks)
+}
+
+func BenchmarkMaybeManifestizeSlowSave(b *testing.B) {
+	defer func(concurrency int) {
+		ManifestizeConcurrency = concurrency
+	}(ManifestizeConcurrency)
+
+	var inputs []*filer_pb.FileChunk
+	for i := 0; i < 64*16; i++ {
+		inputs = append(inputs, &filer_pb.FileChunk{FileId: fmt.Sprintf("1,%04x", i+1), Offset: int64(i * 10), Size: 10})
+	}
+	saveFunc := slowManifestSaveFunc(time.Millisecond)
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			ManifestizeConcurrency = concurrency
+			for i := 0; i < b.N; i++ {
+				if _, err := MaybeManifestizeWithBatch(saveFunc, inputs, 16); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveChunkManifestNested(t *testing.T) {
+	leaves, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,03", Offset: 0, Size: 10},
+			{FileId: "1,04", Offset: 10, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	root, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 0, Size: 20, IsChunkManifest: true},
+			{FileId: "1,05", Offset: 20, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(root), "1,02": string(leaves)})
+	defer closeFn()
+
+	dataChunks, manifestChunks, err := ResolveChunkManifest(lookup, []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 30, IsChunkManifest: true},
+		{FileId: "1,06", Offset: 30, Size: 10},
+	}, 0, math.MaxInt64)
+	assert.NoError(t, err)
+	fileIds := func(chunks []*filer_pb.FileChunk) (ids []string) {
+		for _, chunk := range chunks {
+			ids = append(ids, chunk.GetFileIdString())
+		}
+		return
+	}
+	assert.Equal(t, []string{"1,03", "1,04", "1,05", "1,06"}, fileIds(dataChunks))
+	assert.Equal(t, []string{"1,01", "1,02"}, fileIds(manifestChunks))
+
+	dataChunks, manifestChunks, err = ResolveChunkManifestAll(lookup, []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 30, IsChunkManifest: true},
+		{FileId: "1,06", Offset: 30, Size: 10},
+		{FileId: "1,07", Offset: 40, Size: 0},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1,03", "1,04", "1,05", "1,06"}, fileIds(dataChunks))
+	assert.Equal(t, []string{"1,01", "1,02"}, fileIds(manifestChunks))
+}
+
+func TestResolveOneChunkManifestTruncated(t *testing.T) {
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 0, Size: 10},
+			{FileId: "1,03", Offset: 10, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": string(data[:len(data)-3]),
+		"1,04": string(data),
+	})
+	defer closeFn()
+
+	_, err = ResolveOneChunkManifest(lookup, &filer_pb.FileChunk{FileId: "1,01", Size: 20, IsChunkManifest: true, ManifestSize: uint64(len(data))})
+	assert.EqualError(t, err, fmt.Sprintf("manifest 1,01: expected %d bytes got %d", len(data), len(data)-3))
+
+	defer func(verify bool) {
+		VerifyManifestETag = verify
+	}(VerifyManifestETag)
+	VerifyManifestETag = true
+	digest := md5.Sum([]byte("something else"))
+	manifestChunk := &filer_pb.FileChunk{FileId: "1,04", Size: 20, IsChunkManifest: true, ManifestSize: uint64(len(data)), ETag: base64.StdEncoding.EncodeToString(digest[:])}
+	_, err = ResolveOneChunkManifest(lookup, manifestChunk)
+	assert.ErrorContains(t, err, "does not match etag")
+
+	digest = md5.Sum(data)
+	manifestChunk.ETag = base64.StdEncoding.EncodeToString(digest[:])
+	chunks, err := ResolveOneChunkManifest(lookup, manifestChunk)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(chunks))
+}
+
+func TestResolveOneChunkManifestZstd(t *testing.T) {
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 0, Size: 10},
+			{FileId: "1,03", Offset: 10, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	compressed, err := util.ZstdData(data)
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": string(compressed),
+		"1,04": string(data),
+	})
+	defer closeFn()
+
+	chunks, err := ResolveOneChunkManifest(lookup, &filer_pb.FileChunk{FileId: "1,01", Size: 20, IsChunkManifest: true, IsCompressed: true, CompressionCodec: string(CompressionZstd)})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(chunks))
+	assert.Equal(t, "1,03", chunks[1].GetFileIdString())
+
+	// not compressed as the codec says
+	_, err = ResolveOneChunkManifest(lookup, &filer_pb.FileChunk{FileId: "1,04", Size: 20, IsChunkManifest: true, IsCompressed: true, CompressionCodec: string(CompressionZstd)})
+	assert.ErrorContains(t, err, "is not zstd compressed")
+
+	_, err = ResolveOneChunkManifest(lookup, &filer_pb.FileChunk{FileId: "1,04", Size: 20, IsChunkManifest: true, IsCompressed: true, CompressionCodec: "lz4"})
+	assert.ErrorContains(t, err, `unsupported compression codec "lz4"`)
+
+	// range reads decompress the whole chunk
+	urls, _ := lookup("1,01")
+	buffer := make([]byte, 4)
+	n, err := retriedFetchChunkDataWithContext(context.Background(), buffer, urls, nil, CompressionZstd, false, 2, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, data[2:6], buffer)
+
+	assert.Equal(t, CompressionGzip, ChunkCompressionCodec(&filer_pb.FileChunk{IsCompressed: true}))
+	assert.Equal(t, CompressionNone, ChunkCompressionCodec(&filer_pb.FileChunk{}))
+}
+
+func TestResolveOneChunkManifestWithBuffer(t *testing.T) {
+	contents := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+			Chunks: []*filer_pb.FileChunk{
+				{FileId: fmt.Sprintf("2,%02x", 2*i+1), Offset: 0, Size: 10},
+				{FileId: fmt.Sprintf("2,%02x", 2*i+2), Offset: 10, Size: 10},
+			},
+		})
+		assert.NoError(t, err)
+		contents[fmt.Sprintf("1,%02x", i+1)] = string(data)
+	}
+	lookup, closeFn := newTestVolumeServer(t, contents)
+	defer closeFn()
+
+	var buffer bytes.Buffer
+	manifest := &filer_pb.FileChunkManifest{}
+	for i := 0; i < 2; i++ {
+		chunks, err := ResolveOneChunkManifestWithBuffer(lookup, &filer_pb.FileChunk{FileId: fmt.Sprintf("1,%02x", i+1), Size: 20, IsChunkManifest: true}, &buffer, manifest)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(chunks))
+		assert.Equal(t, fmt.Sprintf("2,%02x", 2*i+1), chunks[0].GetFileIdString())
+		assert.Equal(t, fmt.Sprintf("2,%02x", 2*i+2), chunks[1].GetFileIdString())
+	}
+}
+
+// go test -run none -bench ResolveOneChunkManifest -benchtime 10000x compares 10k sequential resolves
+func BenchmarkResolveOneChunkManifest(b *testing.B) {
+	defer func(cache WholeChunkCache) {
+		FetchedChunkCache = cache
+	}(FetchedChunkCache)
+	// keep the fetch out of the measure
+	FetchedChunkCache = NewMemoryWholeChunkCache(16)
+
+	var chunks []*filer_pb.FileChunk
+	for i := 0; i < 1000; i++ {
+		chunks = append(chunks, &filer_pb.FileChunk{FileId: fmt.Sprintf("2,%04x", i), Offset: int64(i) * 10, Size: 10})
+	}
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{Chunks: chunks})
+	if err != nil {
+		b.Fatal(err)
+	}
+	FetchedChunkCache.Set("1,01", data)
+	lookup := func(fileId string) ([]string, error) {
+		return nil, fmt.Errorf("not cached %s", fileId)
+	}
+	manifestChunk := &filer_pb.FileChunk{FileId: "1,01", Size: 10000, IsChunkManifest: true}
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ResolveOneChunkManifest(lookup, manifestChunk); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("reused", func(b *testing.B) {
+		b.ReportAllocs()
+		var buffer bytes.Buffer
+		manifest := &filer_pb.FileChunkManifest{}
+		for i := 0; i < b.N; i++ {
+			if _, err := ResolveOneChunkManifestWithBuffer(lookup, manifestChunk, &buffer, manifest); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestManifestCreatedHook(t *testing.T) {
+	var created []*ManifestCreated
+	defer func(hook func(*ManifestCreated)) {
+		ManifestCreatedHook = hook
+	}(ManifestCreatedHook)
+	// save the manifests one by one, in the order of their file ids
+	defer func(concurrency int) {
+		ManifestizeConcurrency = concurrency
+	}(ManifestizeConcurrency)
+	ManifestizeConcurrency = 1
+	ManifestCreatedHook = func(c *ManifestCreated) {
+		created = append(created, c)
+	}
+
+	var inputs []*filer_pb.FileChunk
+	for i := 0; i < 5; i++ {
+		inputs = append(inputs, &filer_pb.FileChunk{FileId: fmt.Sprintf("1,%02x", i+1), Offset: int64(i * 10), Size: 10})
+	}
+	var saved int
+	saveFunc := func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		saved++
+		return &filer_pb.FileChunk{FileId: fmt.Sprintf("2,%02x", saved)}, nil
+	}
+	_, err := MaybeManifestizeWithBatch(saveFunc, inputs, 2)
+	assert.NoError(t, err)
+	// the leftover chunk is not reported
+	assert.Equal(t, []*ManifestCreated{
+		{ManifestFileId: "2,01", ChunkFileIds: []string{"1,01", "1,02"}, StartOffset: 0, StopOffset: 20},
+		{ManifestFileId: "2,02", ChunkFileIds: []string{"1,03", "1,04"}, StartOffset: 20, StopOffset: 40},
+	}, created)
+
+	created = nil
+	_, err = MaybeManifestizeWithBatch(func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		return nil, fmt.Errorf("volume full")
+	}, inputs, 2)
+	assert.Error(t, err)
+	assert.Empty(t, created)
+}
+
+func TestExpandChunkManifests(t *testing.T) {
+	inner, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "2,01", Offset: 0, Size: 10},
+			{FileId: "2,02", Offset: 10, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	outer, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 0, Size: 20, IsChunkManifest: true},
+			{FileId: "2,03", Offset: 20, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(outer), "1,02": string(inner)})
+	defer closeFn()
+
+	expanded, err := ExpandChunkManifests(lookup, []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 30, IsChunkManifest: true},
+		{FileId: "2,04", Offset: 30, Size: 10},
+	})
+	assert.NoError(t, err)
+	var fileIds []string
+	for _, chunk := range expanded {
+		assert.False(t, chunk.IsChunkManifest)
+		fileIds = append(fileIds, chunk.GetFileIdString())
+	}
+	assert.Equal(t, []string{"2,01", "2,02", "2,03", "2,04"}, fileIds)
+
+	dataChunks := []*filer_pb.FileChunk{{FileId: "2,04", Offset: 30, Size: 10}}
+	expanded, err = ExpandChunkManifests(lookup, dataChunks)
+	assert.NoError(t, err)
+	assert.Equal(t, dataChunks, expanded)
+
+	_, err = ExpandChunkManifests(lookup, []*filer_pb.FileChunk{{FileId: "1,09", Offset: 0, Size: 10, IsChunkManifest: true}})
+	assert.Error(t, err)
+}
+
+func TestFetchChunkRangeShortRead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the chunk has only 2 bytes left at any offset
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("ab"))
+	}))
+	defer server.Close()
+	lookup := func(fileId string) ([]string, error) {
+		return []string{server.URL + "/" + fileId}, nil
+	}
+
+	buffer := make([]byte, 4)
+	n, err := fetchChunkRange(buffer, lookup, "1,01", nil, false, 8, nil)
+	assert.Equal(t, 2, n)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "ab", string(buffer[:n]))
+
+	n, err = fetchChunkRange(buffer[:2], lookup, "1,01", nil, false, 8, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestFetchChunkRangeLength(t *testing.T) {
+	content := "0123456789abcdef"
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		var start, stop int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &stop)
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(content[start : stop+1]))
+	}))
+	defer server.Close()
+	lookup := func(fileId string) ([]string, error) {
+		return []string{server.URL + "/" + fileId}, nil
+	}
+
+	buffer := make([]byte, 8)
+	n, err := fetchChunkRangeLength(buffer, lookup, "1,01", nil, false, 4, 3, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "456", string(buffer[:n]))
+	assert.Equal(t, make([]byte, 5), buffer[n:])
+
+	n, err = fetchChunkRangeLength(buffer, lookup, "1,01", nil, false, 4, len(buffer), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, n)
+	assert.Equal(t, "456789ab", string(buffer))
+
+	// bounded by the buffer
+	n, err = fetchChunkRangeLength(buffer[:2], lookup, "1,01", nil, false, 4, 6, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Equal(t, []string{"bytes=4-6", "bytes=4-11", "bytes=4-5"}, ranges)
+}
+
+func TestResolveOneChunkManifestEmpty(t *testing.T) {
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": ""})
+	defer closeFn()
+	var lookups int32
+	lookupFn := func(fileId string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		return lookup(fileId)
+	}
+
+	// an empty body
+	_, err := ResolveOneChunkManifest(lookupFn, &filer_pb.FileChunk{FileId: "1,01", Size: 20, IsChunkManifest: true})
+	assert.ErrorIs(t, err, ErrEmptyManifest)
+	_, _, err = ResolveChunkManifest(lookupFn, []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 20, IsChunkManifest: true},
+		{FileId: "2,01", Offset: 20, Size: 10},
+	}, 0, math.MaxInt64)
+	assert.ErrorIs(t, err, ErrEmptyManifest)
+
+	// size 0 is not fetched
+	atomic.StoreInt32(&lookups, 0)
+	_, err = ResolveOneChunkManifest(lookupFn, &filer_pb.FileChunk{FileId: "1,02", Size: 0, IsChunkManifest: true})
+	assert.ErrorIs(t, err, ErrEmptyManifest)
+	// and covers no data of the file
+	dataChunks, _, err := ResolveChunkManifest(lookupFn, []*filer_pb.FileChunk{
+		{FileId: "1,02", Offset: 0, Size: 0, IsChunkManifest: true},
+		{FileId: "2,01", Offset: 0, Size: 10},
+	}, 0, math.MaxInt64)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(dataChunks))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&lookups))
+}
+
+func TestBytesBufferPoolCapacity(t *testing.T) {
+	large := make([]byte, 2*MaxPooledBufferCapacity)
+	for i := 0; i < 100; i++ {
+		bytesBuffer := bytesBufferPool.Get().(*bytes.Buffer)
+		assert.LessOrEqual(t, bytesBuffer.Cap(), MaxPooledBufferCapacity)
+		bytesBuffer.Reset()
+		if i%2 == 0 {
+			bytesBuffer.Write(large)
+		} else {
+			bytesBuffer.WriteString("small")
+		}
+		putBytesBuffer(bytesBuffer)
+	}
+}
+
+func BenchmarkBytesBufferPoolLargeThenSmall(b *testing.B) {
+	large := make([]byte, 2*MaxPooledBufferCapacity)
+	var retained int
+	for i := 0; i < b.N; i++ {
+		bytesBuffer := bytesBufferPool.Get().(*bytes.Buffer)
+		bytesBuffer.Reset()
+		bytesBuffer.Write(large)
+		putBytesBuffer(bytesBuffer)
+
+		bytesBuffer = bytesBufferPool.Get().(*bytes.Buffer)
+		if bytesBuffer.Cap() > retained {
+			retained = bytesBuffer.Cap()
+		}
+		bytesBuffer.Reset()
+		bytesBuffer.WriteString("small")
+		putBytesBuffer(bytesBuffer)
+	}
+	b.ReportMetric(float64(retained), "max-pooled-bytes")
+}
+
+func TestDumpRawManifest(t *testing.T) {
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 0, Size: 10},
+			{FileId: "1,03", Offset: 10, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	compressed, err := util.ZstdData(data)
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": string(data),
+		"1,04": string(compressed),
+	})
+	defer closeFn()
+
+	var raw bytes.Buffer
+	assert.NoError(t, DumpRawManifest(lookup, &filer_pb.FileChunk{FileId: "1,01", Size: 20, IsChunkManifest: true}, &raw))
+	assert.Equal(t, data, raw.Bytes())
+
+	raw.Reset()
+	assert.NoError(t, DumpRawManifest(lookup, &filer_pb.FileChunk{FileId: "1,04", Size: 20, IsChunkManifest: true, IsCompressed: true, CompressionCodec: string(CompressionZstd)}, &raw))
+	assert.Equal(t, data, raw.Bytes())
+
+	assert.ErrorContains(t, DumpRawManifest(lookup, &filer_pb.FileChunk{FileId: "1,02", Size: 10}, &raw), "is not a manifest chunk")
+}
+
+func TestFetchErrorIdentifiesChunk(t *testing.T) {
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": "not encrypted with this key"})
+	defer closeFn()
+	cipherKey := util.GenCipherKey()
+
+	var bytesBuffer bytes.Buffer
+	err := fetchWholeChunk(&bytesBuffer, lookup, "1,01", cipherKey, false, NewReadFlow(ReadSourceStream))
+	assert.ErrorContains(t, err, "fetch 1,01 (encrypted=true compressed=false)")
+
+	_, err = fetchChunkRange(make([]byte, 4), lookup, "1,01", cipherKey, true, 0, NewReadFlow(ReadSourceStream))
+	assert.ErrorContains(t, err, "fetch 1,01 (encrypted=true compressed=true)")
+
+	_, err = ResolveOneChunkManifest(lookup, &filer_pb.FileChunk{FileId: "1,01", Size: 20, IsChunkManifest: true, CipherKey: cipherKey})
+	assert.ErrorContains(t, err, "fetch 1,01 (encrypted=true compressed=false)")
+}
+
+func TestMergeIntoManifestEncodedBody(t *testing.T) {
+	contents := make(map[string]string)
+	lookup, closeFn := newTestVolumeServer(t, contents)
+	defer closeFn()
+	saveFunc := func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		fileId := fmt.Sprintf("1,%02x", len(contents)+1)
+		contents[fileId] = string(data)
+		// the md5 of the stored body, like the volume servers
+		digest := md5.Sum(data)
+		return &filer_pb.FileChunk{FileId: fileId, ETag: base64.StdEncoding.EncodeToString(digest[:])}, nil
+	}
+	var dataChunks []*filer_pb.FileChunk
+	for i := 0; i < 100; i++ {
+		dataChunks = append(dataChunks, &filer_pb.FileChunk{FileId: fmt.Sprintf("2,%02x", i+1), Offset: int64(i) * 10, Size: 10, ModifiedTsNs: 1})
+	}
+	defer func(verify bool) {
+		CompressManifest, EncryptManifest, VerifyManifestETag = false, false, verify
+	}(VerifyManifestETag)
+	VerifyManifestETag = true
+
+	for _, tt := range []struct {
+		compress, encrypt bool
+	}{
+		{false, false},
+		{true, false},
+		{false, true},
+		{true, true},
+	} {
+		CompressManifest, EncryptManifest = tt.compress, tt.encrypt
+		manifestChunk, err := mergeIntoManifest(saveFunc, dataChunks)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.compress, manifestChunk.IsCompressed)
+		assert.Equal(t, CompressionNone, CompressionCodec(manifestChunk.CompressionCodec), "gzip as for the data chunks")
+		assert.Equal(t, tt.encrypt, len(manifestChunk.CipherKey) > 0)
+		if tt.compress && !tt.encrypt {
+			assert.Less(t, len(contents[manifestChunk.GetFileIdString()]), int(manifestChunk.ManifestSize))
+		}
+
+		chunks, err := ResolveOneChunkManifest(lookup, manifestChunk)
+		assert.NoError(t, err, "compress=%v encrypt=%v", tt.compress, tt.encrypt)
+		var raw bytes.Buffer
+		assert.NoError(t, DumpRawManifest(lookup, manifestChunk, &raw))
+		assert.Equal(t, int(manifestChunk.ManifestSize), raw.Len())
+		if assert.Equal(t, len(dataChunks), len(chunks)) {
+			assert.Equal(t, "2,64", chunks[99].GetFileIdString())
+		}
+	}
+
+	// the save function compressing the compressed manifest again
+	CompressManifest, EncryptManifest = true, false
+	_, err := mergeIntoManifest(func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		return &filer_pb.FileChunk{FileId: "1,ff", IsCompressed: true}, nil
+	}, dataChunks)
+	assert.ErrorContains(t, err, "is encoded again")
+}
+
+func TestResolveChunkManifestNoManifest(t *testing.T) {
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 10},
+		{FileId: "1,02", Offset: 10, Size: 0},
+		{FileId: "1,03", Offset: 10, Size: 10},
+		{FileId: "1,04", Offset: 20, Size: 10},
+	}
+	dataChunks, manifestChunks, err := ResolveChunkManifest(nil, chunks, 5, 20)
+	assert.NoError(t, err)
+	assert.Nil(t, manifestChunks)
+	assert.Equal(t, []*filer_pb.FileChunk{chunks[0], chunks[2]}, dataChunks)
+
+	var walked []*filer_pb.FileChunk
+	assert.NoError(t, walkChunkManifest(nil, chunks, 5, 20, func(chunk *filer_pb.FileChunk) bool {
+		walked = append(walked, chunk)
+		return true
+	}))
+	assert.Equal(t, walked, dataChunks)
+}
+
+func BenchmarkResolveChunkManifestNoManifest(b *testing.B) {
+	var chunks []*filer_pb.FileChunk
+	for i := 0; i < 4; i++ {
+		chunks = append(chunks, &filer_pb.FileChunk{FileId: fmt.Sprintf("1,%02x", i+1), Offset: int64(i) * 1024, Size: 1024})
+	}
+	b.Run("walk", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var dataChunks []*filer_pb.FileChunk
+			walkChunkManifest(nil, chunks, 512, 3000, func(chunk *filer_pb.FileChunk) bool {
+				dataChunks = append(dataChunks, chunk)
+				return true
+			})
+		}
+	})
+	b.Run("fast path", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ResolveChunkManifest(nil, chunks, 512, 3000)
+		}
+	})
+}
+
+func TestResolveOneChunkManifestTooLarge(t *testing.T) {
+	var chunks []*filer_pb.FileChunk
+	for i := 0; i < 20; i++ {
+		chunks = append(chunks, &filer_pb.FileChunk{FileId: fmt.Sprintf("2,%02x", i+1), Offset: int64(i) * 10, Size: 10})
+	}
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{Chunks: chunks, Version: ManifestVersion})
+	assert.NoError(t, err)
+	count, err := countManifestChunks(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, count)
+
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(data)})
+	defer closeFn()
+	manifestChunk := &filer_pb.FileChunk{FileId: "1,01", Size: 200, IsChunkManifest: true}
+
+	maxManifestChunks := MaxManifestChunks
+	MaxManifestChunks = 10
+	defer func() {
+		MaxManifestChunks = maxManifestChunks
+	}()
+	_, err = ResolveOneChunkManifest(lookup, manifestChunk)
+	assert.ErrorIs(t, err, ErrManifestTooLarge)
+
+	MaxManifestChunks = 20
+	resolved, err := ResolveOneChunkManifest(lookup, manifestChunk)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, len(resolved))
+}
+
+func TestDeduplicateDataChunks(t *testing.T) {
+	first, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "2,01", Offset: 0, Size: 10, ModifiedTsNs: 1},
+			{FileId: "2,02", Offset: 10, Size: 10, ModifiedTsNs: 1},
+			{FileId: "2,03", Offset: 20, Size: 10, ModifiedTsNs: 1},
+		},
+	})
+	assert.NoError(t, err)
+	// overlapping the first manifest, with a copy of one of its chunks and later overwrites
+	second, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "2,02", Offset: 10, Size: 10, ModifiedTsNs: 1},
+			{FileId: "2,04", Offset: 10, Size: 10, ModifiedTsNs: 2},
+			{FileId: "2,05", Offset: 25, Size: 15, ModifiedTsNs: 2},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(first), "1,02": string(second)})
+	defer closeFn()
+
+	dataChunks, _, err := ResolveChunkManifestAll(lookup, []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 30, ModifiedTsNs: 1, IsChunkManifest: true},
+		{FileId: "1,02", Offset: 10, Size: 30, ModifiedTsNs: 2, IsChunkManifest: true},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(dataChunks))
+
+	deduplicated, err := DeduplicateDataChunks(dataChunks)
+	assert.NoError(t, err)
+	var fileIds []string
+	for _, chunk := range deduplicated {
+		fileIds = append(fileIds, chunk.GetFileIdString())
+	}
+	// 2,02 is overwritten by 2,04, and 2,03 only partly by 2,05
+	assert.Equal(t, []string{"2,01", "2,03", "2,04", "2,05"}, fileIds)
+
+	_, err = DeduplicateDataChunks([]*filer_pb.FileChunk{{FileId: "1,01", Size: 30, IsChunkManifest: true}})
+	assert.Error(t, err)
+}
+
+func TestFetchChunkNoLocations(t *testing.T) {
+	clock, restore := useFakeClock()
+	defer restore()
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": "abcd"})
+	defer closeFn()
+	var lookups int
+	// the volume is registered after 2 lookups
+	lookupFn := func(fileId string) ([]string, error) {
+		if lookups++; lookups <= 2 {
+			return nil, nil
+		}
+		return lookup(fileId)
+	}
+	flow := &ReadFlow{retry: &RetryPolicy{InitialWait: time.Second, MaxWait: time.Minute}}
+
+	buffer := make([]byte, 4)
+	n, err := fetchChunkRangeWithContext(context.Background(), buffer, lookupFn, "1,01", nil, CompressionNone, 0, len(buffer), flow)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcd", string(buffer[:n]))
+	assert.Equal(t, []time.Duration{time.Second, 1500 * time.Millisecond}, clock.sleeps)
+
+	lookups = 0
+	var bytesBuffer bytes.Buffer
+	assert.NoError(t, fetchWholeChunkWithContext(context.Background(), &bytesBuffer, lookupFn, "1,01", nil, CompressionNone, flow))
+	assert.Equal(t, "abcd", bytesBuffer.String())
+
+	// never registered
+	lookups = math.MinInt32
+	flow = &ReadFlow{retry: &RetryPolicy{InitialWait: time.Second, MaxWait: time.Minute, MaxAttempts: 3}}
+	_, err = fetchChunkRangeWithContext(context.Background(), buffer, lookupFn, "1,01", nil, CompressionNone, 0, len(buffer), flow)
+	assert.ErrorContains(t, err, "no locations for fileId 1,01")
+	assert.Equal(t, math.MinInt32+3, lookups)
+}
+
+func TestParseChunkManifest(t *testing.T) {
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 0, Size: 10},
+			{FileId: "1,03", Offset: 10, Size: 10, IsChunkManifest: true},
+		},
+		Version: ManifestVersion,
+	})
+	assert.NoError(t, err)
+	chunks, err := ParseChunkManifest(data)
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(chunks)) {
+		assert.Equal(t, "1,02", chunks[0].GetFileIdString())
+		assert.True(t, chunks[1].IsChunkManifest)
+	}
+
+	_, err = ParseChunkManifest(data[:len(data)-3])
+	assert.ErrorContains(t, err, "fail to unmarshal manifest")
+
+	newer, err := proto.Marshal(&filer_pb.FileChunkManifest{Version: ManifestVersion + 1})
+	assert.NoError(t, err)
+	_, err = ParseChunkManifest(newer)
+	assert.ErrorContains(t, err, "unsupported manifest version")
+}
+
+func TestSerializeChunkManifest(t *testing.T) {
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,02", Offset: 0, Size: 10, ModifiedTsNs: 1, ETag: "a"},
+		{FileId: "1,03", Offset: 10, Size: 10, ModifiedTsNs: 2, SourceFileId: "2,04"},
+		{FileId: "1,05", Offset: 20, Size: 30, ModifiedTsNs: 3, IsChunkManifest: true},
+	}
+	data, err := SerializeChunkManifest(chunks)
+	assert.NoError(t, err)
+	parsed, err := ParseChunkManifest(data)
+	assert.NoError(t, err)
+	if assert.Equal(t, len(chunks), len(parsed)) {
+		for i := range chunks {
+			assert.True(t, proto.Equal(chunks[i], parsed[i]), "chunk %d: %v != %v", i, chunks[i], parsed[i])
+		}
+	}
+}
+
+func TestResolveChunkManifestIncludingEmpty(t *testing.T) {
+	manifest, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,02", Offset: 0, Size: 10},
+			{FileId: "1,03", Offset: 10, Size: 0},
+			{FileId: "1,04", Offset: 10, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(manifest)})
+	defer closeFn()
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 20, IsChunkManifest: true},
+		{FileId: "1,05", Offset: 5, Size: 0, IsChunkManifest: true},
+		{FileId: "1,06", Offset: 20, Size: 10},
+		{FileId: "1,07", Offset: 30, Size: 0},
+		{FileId: "1,08", Offset: 50, Size: 0},
+	}
+	fileIds := func(chunks []*filer_pb.FileChunk) (ids []string) {
+		for _, chunk := range chunks {
+			ids = append(ids, chunk.GetFileIdString())
+		}
+		return
+	}
+
+	// chunks of size 0 are left out
+	dataChunks, manifestChunks, err := ResolveChunkManifest(lookup, chunks, 0, 40)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1,02", "1,04", "1,06"}, fileIds(dataChunks))
+	assert.Equal(t, []string{"1,01"}, fileIds(manifestChunks))
+
+	dataChunks, manifestChunks, err = ResolveChunkManifestIncludingEmpty(lookup, chunks, 0, 40)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1,02", "1,03", "1,04", "1,06", "1,07"}, fileIds(dataChunks))
+	assert.Equal(t, []string{"1,01", "1,05"}, fileIds(manifestChunks))
+}
+
+func TestDataChunkResolvedHook(t *testing.T) {
+	manifest, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,03", Offset: 10, Size: 10},
+			{FileId: "1,02", Offset: 0, Size: 10},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(manifest)})
+	defer closeFn()
+
+	var resolved []string
+	DataChunkResolvedHook = func(fileId string, offset int64, size uint64) {
+		resolved = append(resolved, fmt.Sprintf("%s@%d+%d", fileId, offset, size))
+	}
+	defer func() {
+		DataChunkResolvedHook = nil
+	}()
+	_, _, err = ResolveChunkManifest(lookup, []*filer_pb.FileChunk{
+		{FileId: "1,04", Offset: 20, Size: 5},
+		{FileId: "1,01", Offset: 0, Size: 20, IsChunkManifest: true},
+	}, 5, 25)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1,02@0+10", "1,03@10+10", "1,04@20+5"}, resolved)
+
+	// not for the whole file resolutions of the maintenance jobs
+	resolved = nil
+	_, _, err = ResolveChunkManifestAll(lookup, []*filer_pb.FileChunk{{FileId: "1,01", Offset: 0, Size: 20, IsChunkManifest: true}})
+	assert.NoError(t, err)
+	assert.Empty(t, resolved)
+}
+
+func TestResolveOneChunkManifestNotGzipAsFlagged(t *testing.T) {
+	data, err := SerializeChunkManifest([]*filer_pb.FileChunk{
+		{FileId: "1,02", Offset: 0, Size: 4, ModifiedTsNs: 1},
+		{FileId: "1,03", Offset: 4, Size: 4, ModifiedTsNs: 1},
+	})
+	assert.NoError(t, err)
+	// the needle is flagged gzip, so the volume server claims the encoding, but holds the plain manifest
+	var identityReads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+		} else {
+			atomic.AddInt32(&identityReads, 1)
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+	lookup := func(fileId string) ([]string, error) {
+		return []string{server.URL + "/" + fileId}, nil
+	}
+
+	dataChunks, err := ResolveOneChunkManifest(lookup, &filer_pb.FileChunk{FileId: "1,01", Size: uint64(len(data)), IsChunkManifest: true, IsCompressed: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(dataChunks))
+	assert.Equal(t, "1,03", dataChunks[1].GetFileIdString())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&identityReads))
+}
+
+func TestGunzipManifestBody(t *testing.T) {
+	data, err := SerializeChunkManifest([]*filer_pb.FileChunk{{FileId: "2,01", Offset: 0, Size: 10}})
+	assert.NoError(t, err)
+	compressed, err := util.GzipData(data)
+	assert.NoError(t, err)
+	chunk := &filer_pb.FileChunk{FileId: "1,01", IsChunkManifest: true, IsCompressed: true, ManifestSize: uint64(len(data))}
+
+	// decompressed into another buffer, leaving the fetched one as is
+	fetched := bytes.NewBuffer(compressed)
+	body, err := gunzipManifestBody(chunk, fetched)
+	assert.NoError(t, err)
+	assert.NotSame(t, fetched, body)
+	assert.Equal(t, data, body.Bytes())
+	assert.Equal(t, compressed, fetched.Bytes())
+	putBytesBuffer(body)
+
+	// not compressed, or encrypted
+	fetched = bytes.NewBuffer(data)
+	body, err = gunzipManifestBody(chunk, fetched)
+	assert.NoError(t, err)
+	assert.Same(t, fetched, body)
+	fetched = bytes.NewBuffer(compressed)
+	body, err = gunzipManifestBody(&filer_pb.FileChunk{FileId: "1,01", IsCompressed: true, CipherKey: []byte("key")}, fetched)
+	assert.NoError(t, err)
+	assert.Same(t, fetched, body)
+
+	// a truncated body
+	fetched = bytes.NewBuffer(compressed[:len(compressed)-4])
+	_, err = gunzipManifestBody(chunk, fetched)
+	assert.ErrorContains(t, err, "manifest 1,01")
+}
@@ -0,0 +1,69 @@
+package filer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ReadQuorumKey in an entry's extended attributes sets how many replicas must return identical data
+// for each read of the file. It overrides the read_quorum of the matching filer.conf location.
+const ReadQuorumKey = "Seaweed-Read-Quorum"
+
+// ReadQuorum returns the number of replicas that must agree on reads of the entry, at least 1.
+func ReadQuorum(entry *Entry, pathConfQuorum uint32) int {
+	quorum := int(pathConfQuorum)
+	if entry != nil {
+		if value, found := entry.Extended[ReadQuorumKey]; found {
+			if q, err := strconv.Atoi(string(value)); err == nil {
+				quorum = q
+			}
+		}
+	}
+	if quorum < 1 {
+		return 1
+	}
+	return quorum
+}
+
+// quorumFetchChunkView reads the chunk view from replicas until quorum of them returned data,
+// and writes the data only if they all agree.
+func quorumFetchChunkView(ctx context.Context, writer io.Writer, urlStrings []string, chunkView *ChunkView, quorum int, flow *ReadFlow) error {
+	if len(urlStrings) < quorum {
+		return fmt.Errorf("chunk %s has %d replicas, less than read quorum %d", chunkView.FileId, len(urlStrings), quorum)
+	}
+	var agreed []byte
+	var agreeing int
+	var lastErr error
+	for _, urlString := range urlStrings {
+		buffer := make([]byte, chunkView.ViewSize)
+		n, err := retriedFetchChunkDataWithContext(ctx, buffer, []string{urlString}, chunkView.CipherKey, gzipCodec(chunkView.IsGzipped), chunkView.IsFullChunk(), chunkView.OffsetInChunk, flow)
+		if err == nil && n != len(buffer) {
+			err = fmt.Errorf("read %d bytes, expected %d", n, len(buffer))
+		}
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("read %s: %v", urlString, err)
+			continue
+		}
+		if agreed == nil {
+			agreed = buffer
+		} else if !bytes.Equal(agreed, buffer) {
+			return fmt.Errorf("chunk %s replicas disagree: %s differs", chunkView.FileId, urlString)
+		}
+		agreeing++
+		if agreeing >= quorum {
+			// replicas agreeing on corrupted data, e.g. written so, are no better
+			if err = chunkView.verifyFullChunk(agreed); err != nil {
+				return err
+			}
+			_, err = writer.Write(agreed)
+			return err
+		}
+	}
+	return fmt.Errorf("chunk %s: only %d of read quorum %d replicas returned data, last error: %v", chunkView.FileId, agreeing, quorum, lastErr)
+}
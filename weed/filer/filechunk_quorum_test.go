@@ -0,0 +1,58 @@
+package filer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestStreamContentWithQuorum(t *testing.T) {
+	lookup1, closeFn1 := newTestVolumeServer(t, map[string]string{"1,01": "aaaa", "1,02": "bbbb"})
+	defer closeFn1()
+	lookup2, closeFn2 := newTestVolumeServer(t, map[string]string{"1,01": "aaaa", "1,02": "bbXb"})
+	defer closeFn2()
+	lookup3, closeFn3 := newTestVolumeServer(t, map[string]string{"1,01": "aaaa", "1,02": "bbbb"})
+	defer closeFn3()
+	replicas := func(lookups ...func(string) ([]string, error)) testLookup {
+		return func(fileId string) (urls []string, err error) {
+			for _, lookup := range lookups {
+				u, _ := lookup(fileId)
+				urls = append(urls, u...)
+			}
+			return
+		}
+	}
+	agreeing := []*filer_pb.FileChunk{{FileId: "1,01", Offset: 0, Size: 4, ModifiedTsNs: 1}}
+	disagreeing := []*filer_pb.FileChunk{{FileId: "1,02", Offset: 0, Size: 4, ModifiedTsNs: 1}}
+
+	var buf bytes.Buffer
+	assert.NoError(t, StreamContentWithQuorum(context.Background(), replicas(lookup1, lookup2), &buf, agreeing, 0, 4, 0, 2))
+	assert.Equal(t, "aaaa", buf.String())
+
+	buf.Reset()
+	assert.ErrorContains(t, StreamContentWithQuorum(context.Background(), replicas(lookup1, lookup2), &buf, disagreeing, 0, 4, 0, 2), "disagree")
+	assert.Equal(t, 0, buf.Len())
+
+	// a single replica read does not compare
+	assert.NoError(t, StreamContentWithQuorum(context.Background(), replicas(lookup2, lookup1), &buf, disagreeing, 0, 4, 0, 1))
+	assert.Equal(t, "bbXb", buf.String())
+
+	buf.Reset()
+	assert.ErrorContains(t, StreamContentWithQuorum(context.Background(), replicas(lookup1), &buf, agreeing, 0, 4, 0, 2), "less than read quorum")
+
+	// a replica that fails to read does not count
+	missing := []*filer_pb.FileChunk{{FileId: "1,03", Offset: 0, Size: 4, ModifiedTsNs: 1}}
+	assert.Error(t, StreamContentWithQuorum(context.Background(), replicas(lookup1, lookup3), &buf, missing, 0, 4, 0, 2))
+	assert.NoError(t, StreamContentWithQuorum(context.Background(), replicas(lookup1, lookup3), &buf, disagreeing, 0, 4, 0, 2))
+}
+
+func TestReadQuorum(t *testing.T) {
+	assert.Equal(t, 1, ReadQuorum(nil, 0))
+	assert.Equal(t, 2, ReadQuorum(&Entry{}, 2))
+	assert.Equal(t, 3, ReadQuorum(&Entry{Extended: map[string][]byte{ReadQuorumKey: []byte("3")}}, 2))
+	assert.Equal(t, 1, ReadQuorum(&Entry{Extended: map[string][]byte{ReadQuorumKey: []byte("0")}}, 2))
+}
@@ -0,0 +1,106 @@
+package filer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// readSourceRateLimiters caps the bytes per second delivered to the reads of some sources, e.g. the manifest
+// resolution of a backup scan, independently of MaxReadBytesPerSecond. A limiter may be shared by several sources.
+// Sources not listed are not limited.
+var (
+	readSourceRateLimitersLock sync.RWMutex
+	readSourceRateLimiters     = map[string]*ReadRateLimiter{}
+)
+
+// SetReadSourceRateLimiter caps the reads of the flows created later for the source with the limiter, nil for no limit
+func SetReadSourceRateLimiter(source string, limiter *ReadRateLimiter) {
+	readSourceRateLimitersLock.Lock()
+	defer readSourceRateLimitersLock.Unlock()
+	if limiter == nil {
+		delete(readSourceRateLimiters, source)
+		return
+	}
+	readSourceRateLimiters[source] = limiter
+}
+
+func readSourceRateLimiter(source string) *ReadRateLimiter {
+	readSourceRateLimitersLock.RLock()
+	defer readSourceRateLimitersLock.RUnlock()
+	return readSourceRateLimiters[source]
+}
+
+// ReadRateLimiter is a token bucket of bytes, charged with the bytes actually delivered to the reads.
+// A read going over the budget puts the limiter in debt, which the following reads wait out before starting.
+type ReadRateLimiter struct {
+	sync.Mutex
+	bytesPerSecond float64
+	tokens         float64
+	lastRefill     time.Time
+}
+
+func NewReadRateLimiter(bytesPerSecond int64) *ReadRateLimiter {
+	return &ReadRateLimiter{
+		bytesPerSecond: float64(bytesPerSecond),
+	}
+}
+
+// SetRateLimiter caps the reads of the flow with the limiter, nil for no limit
+func (flow *ReadFlow) SetRateLimiter(limiter *ReadRateLimiter) {
+	flow.limiter = limiter
+}
+
+// delivered charges the bytes delivered to a read of the flow to its limiter
+func (flow *ReadFlow) delivered(n int) {
+	if flow == nil || flow.limiter == nil {
+		return
+	}
+	flow.limiter.charge(n)
+}
+
+// waitRateLimit waits out the debt of the limiter of the flow, before a read holds any resource,
+// or returns the error of the context if it is done first
+func (flow *ReadFlow) waitRateLimit(ctx context.Context) error {
+	if flow == nil || flow.limiter == nil {
+		return nil
+	}
+	return flow.limiter.wait(ctx)
+}
+
+func (l *ReadRateLimiter) charge(n int) {
+	if l.bytesPerSecond <= 0 || n <= 0 {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.refill()
+	l.tokens -= float64(n)
+}
+
+func (l *ReadRateLimiter) wait(ctx context.Context) error {
+	if l.bytesPerSecond <= 0 {
+		return nil
+	}
+	l.Lock()
+	l.refill()
+	debt := -l.tokens
+	l.Unlock()
+	if debt <= 0 {
+		return nil
+	}
+	return sleepContext(ctx, time.Duration(debt/l.bytesPerSecond*float64(time.Second)))
+}
+
+// refill adds the tokens accumulated since the last refill, at most one second of burst
+func (l *ReadRateLimiter) refill() {
+	now := retryClock.Now()
+	if l.lastRefill.IsZero() {
+		l.lastRefill = now
+	}
+	l.tokens += now.Sub(l.lastRefill).Seconds() * l.bytesPerSecond
+	if l.tokens > l.bytesPerSecond {
+		l.tokens = l.bytesPerSecond
+	}
+	l.lastRefill = now
+}
@@ -0,0 +1,67 @@
+package filer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadRateLimiter(t *testing.T) {
+	clock, restoreClock := useFakeClock()
+	defer restoreClock()
+	limiter := NewReadRateLimiter(1000)
+	slept := func() (total time.Duration) {
+		clock.Lock()
+		defer clock.Unlock()
+		for _, d := range clock.sleeps {
+			total += d
+		}
+		clock.sleeps = nil
+		return total
+	}
+
+	SetReadSourceRateLimiter(ReadSourceManifest, limiter)
+	defer SetReadSourceRateLimiter(ReadSourceManifest, nil)
+
+	// the bytes delivered to a limited flow are charged, the next read waits them out
+	urls, restoreReads := useScriptedReads([]scriptedRead{{data: strings.Repeat("x", 3000), shouldRetry: true}, {data: "x"}})
+	var buf bytes.Buffer
+	_, err := retriedStreamFetchChunkData(&buf, []string{"http://a:8080/1,01"}, nil, false, true, 0, 0, NewReadFlow(ReadSourceManifest))
+	assert.NoError(t, err)
+	assert.Equal(t, 3000, buf.Len())
+	assert.Zero(t, slept())
+	_, err = retriedStreamFetchChunkData(&buf, []string{"http://a:8080/1,02"}, nil, false, true, 0, 0, NewReadFlow(ReadSourceManifest))
+	restoreReads()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(*urls))
+	assert.Equal(t, 3*time.Second, slept())
+
+	// the other sources are not
+	_, restoreReads = useScriptedReads([]scriptedRead{{data: strings.Repeat("x", 3000), shouldRetry: true}})
+	n, err := retriedFetchChunkData(make([]byte, 3000), []string{"http://a:8080/1,01"}, nil, false, true, 0, NewReadFlow(ReadSourceStream))
+	restoreReads()
+	assert.NoError(t, err)
+	assert.Equal(t, 3000, n)
+	assert.Zero(t, slept())
+
+	// tokens accumulate while idle, up to one second of reads
+	clock.advance(time.Minute)
+	flow := NewReadFlow(ReadSourceStream)
+	flow.SetRateLimiter(limiter)
+	flow.delivered(1000)
+	assert.NoError(t, flow.waitRateLimit(context.Background()))
+	assert.Zero(t, slept())
+	flow.delivered(500)
+	assert.NoError(t, flow.waitRateLimit(context.Background()))
+	assert.Equal(t, 500*time.Millisecond, slept())
+
+	// the wait gives up with the context
+	flow.delivered(500)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, flow.waitRateLimit(ctx), context.Canceled)
+}
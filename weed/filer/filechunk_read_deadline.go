@@ -0,0 +1,68 @@
+package filer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+var ErrReadDeadlineExceeded = errors.New("read deadline exceeded")
+
+// PartialReadError tells that a read failed or ran out of time after writing the data before Offset,
+// so a client can resume the read from Offset.
+type PartialReadError struct {
+	Offset int64 // offset in the file
+	Err    error
+}
+
+func (e *PartialReadError) Error() string {
+	return fmt.Sprintf("partial read, stopped at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *PartialReadError) Unwrap() error {
+	return e.Err
+}
+
+// expired tells whether the deadline of the flow has passed, optionally after waiting for d
+func (flow *ReadFlow) expired(d time.Duration) bool {
+	return flow != nil && !flow.deadline.IsZero() && retryClock.Now().Add(d).After(flow.deadline)
+}
+
+// deadlineExceeded is the error of a fetch given up at its deadline, after the error of its last read if any
+func deadlineExceeded(err error) error {
+	if err == nil {
+		return ErrReadDeadlineExceeded
+	}
+	return fmt.Errorf("%w: %v", ErrReadDeadlineExceeded, err)
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.writer.Write(p)
+	w.written += int64(n)
+	return
+}
+
+// StreamContentWithDeadline streams the content like StreamContent, but gives up at the deadline, including
+// retries that would wait past it. The data written so far is kept, and a *PartialReadError tells where to resume.
+func StreamContentWithDeadline(masterClient wdclient.HasLookupFileIdFunction, writer io.Writer, chunks []*filer_pb.FileChunk, offset int64, size int64, deadline time.Time) error {
+	readFlow := NewReadFlow(ReadSourceStream)
+	readFlow.deadline = deadline
+	counter := &countingWriter{writer: writer}
+	chunkViews := ViewFromChunks(masterClient.GetLookupFileIdFunction(), chunks, offset, size)
+	_, err := doStreamContent(context.Background(), masterClient, counter, chunkViews, offset, size, 0, false, 1, readFlow)
+	var partialErr *PartialReadError
+	if errors.Is(err, ErrReadDeadlineExceeded) && !errors.As(err, &partialErr) {
+		return &PartialReadError{Offset: offset + counter.written, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package filer
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+type ReadEventType int
+
+const (
+	// ReadEventManifestResolved is sent once the chunk manifests are resolved, with the number of chunks to fetch
+	ReadEventManifestResolved ReadEventType = iota
+	// ReadEventChunkFetched is sent after each chunk is written out
+	ReadEventChunkFetched
+	// ReadEventRetry is sent before waiting to retry a chunk read that failed on all replicas
+	ReadEventRetry
+)
+
+func (t ReadEventType) String() string {
+	switch t {
+	case ReadEventManifestResolved:
+		return "manifestResolved"
+	case ReadEventChunkFetched:
+		return "chunkFetched"
+	case ReadEventRetry:
+		return "retry"
+	}
+	return "unknown"
+}
+
+// ReadEvent reports the progress of a streaming read.
+type ReadEvent struct {
+	Type ReadEventType
+	// the chunk, counted from 1, of ChunkCount chunks
+	FileId     string
+	ChunkIndex int
+	ChunkCount int
+	// bytes of the file written out so far, including holes
+	BytesTransferred int64
+	// for ReadEventRetry, the error of the last attempt and the wait before the next one
+	Err  error
+	Wait time.Duration
+}
+
+// emit sends the event without blocking, dropping it if the receiver is not keeping up
+func (flow *ReadFlow) emit(event *ReadEvent) {
+	if flow == nil || flow.events == nil {
+		return
+	}
+	select {
+	case flow.events <- event:
+	default:
+		glog.V(4).Infof("drop read event %s of %s", event.Type, event.FileId)
+	}
+}
+
+// StreamContentWithEvents streams the content like StreamContent, and reports its progress to the events channel.
+// Events are dropped while the channel is full, so a buffered channel is recommended. The channel is not closed.
+func StreamContentWithEvents(masterClient wdclient.HasLookupFileIdFunction, writer io.Writer, chunks []*filer_pb.FileChunk, offset int64, size int64, events chan<- *ReadEvent) error {
+	readFlow := NewReadFlow(ReadSourceStream)
+	readFlow.events = events
+	chunkViews := ViewFromChunks(masterClient.GetLookupFileIdFunction(), chunks, offset, size)
+	readFlow.emit(&ReadEvent{
+		Type:       ReadEventManifestResolved,
+		ChunkCount: chunkViews.Len(),
+	})
+	_, err := doStreamContent(context.Background(), masterClient, writer, chunkViews, offset, size, 0, false, 1, readFlow)
+	return err
+}
@@ -0,0 +1,74 @@
+package filer
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/seaweedfs/seaweedfs/weed/util"
+)
+
+// ReadClientName identifies this process, e.g. "filer 10.0.0.1:8888", in the User-Agent of chunk reads.
+var ReadClientName string
+
+// ReadRequestIds adds a request id header to chunk reads. All reads of one ReadFlow share the id.
+var ReadRequestIds bool
+
+const ReadRequestIdHeader = "X-Request-ID"
+
+// header returns the request headers of the flow's chunk reads
+func (flow *ReadFlow) header() http.Header {
+	if flow == nil {
+		flow = defaultReadFlow
+	}
+	var details []string
+	if ReadClientName != "" {
+		details = append(details, ReadClientName)
+	}
+	if flow.source != "" {
+		details = append(details, flow.source)
+	}
+	userAgent := "SeaweedFS/" + util.VERSION_NUMBER
+	if len(details) > 0 {
+		userAgent += " (" + strings.Join(details, "; ") + ")"
+	}
+	header := http.Header{}
+	header.Set("User-Agent", userAgent)
+	if flow.requestId != "" {
+		header.Set(ReadRequestIdHeader, flow.requestId)
+	}
+	if flow.identityEncoding {
+		header.Set("Accept-Encoding", "identity")
+	}
+	return header
+}
+
+// withIdentityEncoding is a copy of the flow reading the stored bytes as they are,
+// for chunks wrongly flagged as gzip compressed
+func (flow *ReadFlow) withIdentityEncoding() *ReadFlow {
+	if flow == nil {
+		flow = defaultReadFlow
+	}
+	identity := *flow
+	identity.identityEncoding = true
+	return &identity
+}
+
+// chunkUrl is the url the flow reads a chunk from. Only the manifest resolution reads deleted needles,
+// so normal reads of removed chunks fail with 404 instead of resurrecting them.
+// The query of the looked up url is kept, and its escaped path segments stay as they are.
+func (flow *ReadFlow) chunkUrl(urlString string) string {
+	u, err := url.Parse(urlString)
+	if err != nil {
+		// a bare % in the path
+		if u, err = url.Parse(strings.ReplaceAll(urlString, "%", "%25")); err != nil {
+			return urlString
+		}
+	}
+	if flow != nil && flow.readDeleted {
+		query := u.Query()
+		query.Set("readDeleted", "true")
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
@@ -0,0 +1,101 @@
+package filer
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/util"
+)
+
+func TestReadFlowHeader(t *testing.T) {
+	var userAgent, requestId string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent, requestId = r.UserAgent(), r.Header.Get(ReadRequestIdHeader)
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+	defer func(name string, ids bool, wait time.Duration) {
+		ReadClientName, ReadRequestIds, util.RetryWaitTime = name, ids, wait
+	}(ReadClientName, ReadRequestIds, util.RetryWaitTime)
+	ReadClientName, ReadRequestIds, util.RetryWaitTime = "filer 127.0.0.1:8888", true, 1500*time.Millisecond
+
+	flow := NewReadFlow(ReadSourceManifest)
+	var buf bytes.Buffer
+	_, err := retriedStreamFetchChunkData(&buf, []string{server.URL + "/1,01"}, nil, false, true, 0, 0, flow)
+	assert.NoError(t, err)
+	assert.Equal(t, "data", buf.String())
+	assert.Equal(t, "SeaweedFS/"+util.VERSION_NUMBER+" (filer 127.0.0.1:8888; manifest)", userAgent)
+	assert.NotEmpty(t, requestId)
+
+	// later reads of the same flow share the request id
+	firstRequestId := requestId
+	_, err = retriedFetchChunkData(make([]byte, 4), []string{server.URL + "/1,01"}, nil, false, true, 0, flow)
+	assert.NoError(t, err)
+	assert.Equal(t, firstRequestId, requestId)
+
+	ReadClientName, ReadRequestIds = "", false
+	buf.Reset()
+	_, err = retriedStreamFetchChunkData(&buf, []string{server.URL + "/1,01"}, nil, false, true, 0, 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "SeaweedFS/"+util.VERSION_NUMBER, userAgent)
+	assert.Empty(t, requestId)
+}
+
+func TestReadFlowReadDeleted(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	_, err := retriedStreamFetchChunkData(&buf, []string{server.URL + "/1,01"}, nil, false, true, 0, 0, NewReadFlow(ReadSourceStream))
+	assert.NoError(t, err)
+	assert.Equal(t, "", query)
+	_, err = retriedStreamFetchChunkData(&buf, []string{server.URL + "/1,01"}, nil, false, true, 0, 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", query)
+	_, err = retriedStreamFetchChunkData(&buf, []string{server.URL + "/1,01"}, nil, false, true, 0, 0, NewReadFlow(ReadSourceManifest))
+	assert.NoError(t, err)
+	assert.Equal(t, "readDeleted=true", query)
+	_, err = retriedStreamFetchChunkData(&buf, []string{server.URL + "/1,01?collection=a"}, nil, false, true, 0, 0, NewReadFlow(ReadSourceManifest))
+	assert.NoError(t, err)
+	assert.Equal(t, "collection=a&readDeleted=true", query)
+}
+
+func TestReadFlowChunkUrl(t *testing.T) {
+	var requestURI string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURI = r.RequestURI
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path        string
+		readDeleted string
+		other       string
+	}{
+		{path: "/1,01", readDeleted: "/1,01?readDeleted=true", other: "/1,01"},
+		{path: "/1,01?collection=a", readDeleted: "/1,01?collection=a&readDeleted=true", other: "/1,01?collection=a"},
+		{path: "/1,01?readDeleted=false", readDeleted: "/1,01?readDeleted=true", other: "/1,01?readDeleted=false"},
+		{path: "/dir%2Fname/1,01", readDeleted: "/dir%2Fname/1,01?readDeleted=true", other: "/dir%2Fname/1,01"},
+		{path: "/a%zz/1,01", readDeleted: "/a%25zz/1,01?readDeleted=true", other: "/a%25zz/1,01"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		_, err := retriedStreamFetchChunkData(&buf, []string{server.URL + test.path}, nil, false, true, 0, 0, NewReadFlow(ReadSourceManifest))
+		assert.NoError(t, err, test.path)
+		assert.Equal(t, test.readDeleted, requestURI, test.path)
+		assert.Equal(t, "data", buf.String(), test.path)
+		_, err = retriedFetchChunkData(make([]byte, 4), []string{server.URL + test.path}, nil, false, true, 0, NewReadFlow(ReadSourceStream))
+		assert.NoError(t, err, test.path)
+		assert.Equal(t, test.other, requestURI, test.path)
+	}
+}
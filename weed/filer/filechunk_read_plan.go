@@ -0,0 +1,74 @@
+package filer
+
+import (
+	"math"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// ReadRange is a byte range [Offset, Offset+Size) of a file
+type ReadRange struct {
+	Offset int64
+	Size   int64
+}
+
+// ReadPlan lists the parts of data chunks serving one requested range, in file order.
+// Parts of the range not covered by any chunk view are holes.
+type ReadPlan struct {
+	ReadRange
+	ChunkViews []*ChunkView
+}
+
+// PlanReads tells which data chunks, and which offsets within them, serve each of the ranges,
+// without fetching any data. Only the manifests overlapping some range are fetched, each once.
+func PlanReads(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, ranges []ReadRange) ([]*ReadPlan, error) {
+	dataChunks, err := resolveChunksForRanges(lookupFileIdFn, chunks, ranges)
+	if err != nil {
+		return nil, err
+	}
+	visibles := readResolvedChunks(dataChunks, 0, math.MaxInt64)
+
+	var plans []*ReadPlan
+	for _, r := range ranges {
+		plan := &ReadPlan{ReadRange: r}
+		chunkViews := ViewFromVisibleIntervals(visibles, r.Offset, r.Size)
+		for x := chunkViews.Front(); x != nil; x = x.Next {
+			plan.ChunkViews = append(plan.ChunkViews, x.Value)
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+func resolveChunksForRanges(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, ranges []ReadRange) (dataChunks []*filer_pb.FileChunk, err error) {
+	for _, chunk := range chunks {
+		if !overlapsAnyRange(chunk, ranges) {
+			continue
+		}
+		if !chunk.IsChunkManifest {
+			dataChunks = append(dataChunks, chunk)
+			continue
+		}
+		resolvedChunks, resolveErr := ResolveOneChunkManifest(lookupFileIdFn, chunk)
+		if resolveErr != nil {
+			return nil, resolveErr
+		}
+		// recursive
+		subDataChunks, subErr := resolveChunksForRanges(lookupFileIdFn, resolvedChunks, ranges)
+		if subErr != nil {
+			return nil, subErr
+		}
+		dataChunks = append(dataChunks, subDataChunks...)
+	}
+	return
+}
+
+func overlapsAnyRange(chunk *filer_pb.FileChunk, ranges []ReadRange) bool {
+	for _, r := range ranges {
+		if max(chunk.Offset, r.Offset) < min(chunk.Offset+int64(chunk.Size), r.Offset+r.Size) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package filer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestPlanReads(t *testing.T) {
+	newManifest := func(chunks ...*filer_pb.FileChunk) string {
+		data, err := proto.Marshal(&filer_pb.FileChunkManifest{Chunks: chunks})
+		assert.NoError(t, err)
+		return string(data)
+	}
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,10": newManifest(
+			&filer_pb.FileChunk{FileId: "1,01", Offset: 0, Size: 100, ModifiedTsNs: 1},
+			&filer_pb.FileChunk{FileId: "1,02", Offset: 100, Size: 100, ModifiedTsNs: 2},
+		),
+		"1,20": newManifest(
+			&filer_pb.FileChunk{FileId: "1,03", Offset: 200, Size: 100, ModifiedTsNs: 3},
+		),
+	})
+	defer closeFn()
+
+	fetched := make(map[string]int)
+	countingLookup := func(fileId string) ([]string, error) {
+		fetched[fileId]++
+		return lookup(fileId)
+	}
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,10", Offset: 0, Size: 200, ModifiedTsNs: 2, IsChunkManifest: true},
+		{FileId: "1,20", Offset: 200, Size: 100, ModifiedTsNs: 3, IsChunkManifest: true},
+		{FileId: "1,04", Offset: 400, Size: 100, ModifiedTsNs: 4},
+	}
+
+	// a footer read, then a read across two chunks of the same manifest
+	plans, err := PlanReads(countingLookup, chunks, []ReadRange{{Offset: 480, Size: 20}, {Offset: 50, Size: 100}})
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(plans)) {
+		if assert.Equal(t, 1, len(plans[0].ChunkViews)) {
+			v := plans[0].ChunkViews[0]
+			assert.Equal(t, "1,04", v.FileId)
+			assert.Equal(t, int64(80), v.OffsetInChunk)
+			assert.Equal(t, uint64(20), v.ViewSize)
+		}
+		if assert.Equal(t, 2, len(plans[1].ChunkViews)) {
+			assert.Equal(t, "1,01", plans[1].ChunkViews[0].FileId)
+			assert.Equal(t, int64(50), plans[1].ChunkViews[0].OffsetInChunk)
+			assert.Equal(t, uint64(50), plans[1].ChunkViews[0].ViewSize)
+			assert.Equal(t, "1,02", plans[1].ChunkViews[1].FileId)
+			assert.Equal(t, int64(0), plans[1].ChunkViews[1].OffsetInChunk)
+			assert.Equal(t, int64(100), plans[1].ChunkViews[1].ViewOffset)
+		}
+	}
+	// the manifest not overlapping any range is not fetched
+	assert.Equal(t, 1, fetched["1,10"])
+	assert.Equal(t, 0, fetched["1,20"])
+}
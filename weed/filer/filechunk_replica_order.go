@@ -0,0 +1,103 @@
+package filer
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpreadReplicaReads shuffles the replicas of each chunk read, so the first replica looked up is not always
+// read first, and starts each retry round from the next replica, away from the one that failed first.
+// With PreferFastestDataCenter, the replicas keep their latency order and are only rotated on retries.
+var SpreadReplicaReads bool
+
+var replicaRand = newLockedRand(time.Now().UnixNano())
+
+type lockedRand struct {
+	sync.Mutex
+	rand *rand.Rand
+}
+
+func newLockedRand(seed int64) *lockedRand {
+	return &lockedRand{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (r *lockedRand) shuffle(urlStrings []string) {
+	r.Lock()
+	defer r.Unlock()
+	r.rand.Shuffle(len(urlStrings), func(i, j int) {
+		urlStrings[i], urlStrings[j] = urlStrings[j], urlStrings[i]
+	})
+}
+
+// ReplicaPreference reorders, or filters, the replica urls of a chunk before reading it,
+// e.g. to read from the local data center first.
+type ReplicaPreference func(urlStrings []string) []string
+
+// DefaultReplicaPreference applies to the reads whose flow has no preference of its own, including
+// the manifest resolution. nil keeps the order of the lookup.
+var DefaultReplicaPreference ReplicaPreference
+
+// PreferUrlsContaining moves the urls containing the substring, e.g. a data center tag, to the front,
+// keeping the order otherwise.
+func PreferUrlsContaining(substring string) ReplicaPreference {
+	return func(urlStrings []string) []string {
+		preferred := make([]string, 0, len(urlStrings))
+		var others []string
+		for _, urlString := range urlStrings {
+			if strings.Contains(urlString, substring) {
+				preferred = append(preferred, urlString)
+			} else {
+				others = append(others, urlString)
+			}
+		}
+		return append(preferred, others...)
+	}
+}
+
+// SetReplicaPreference makes the reads of the flow order their replicas with the preference
+func (flow *ReadFlow) SetReplicaPreference(preference ReplicaPreference) {
+	flow.replicaPreference = preference
+}
+
+// orderReplicas is the order the flow reads the replicas of a chunk in the first round.
+// A preference filtering out all the replicas is ignored.
+func orderReplicas(urlStrings []string, flow *ReadFlow) []string {
+	urlStrings = spreadReplicas(urlStrings)
+	preference := DefaultReplicaPreference
+	if flow != nil && flow.replicaPreference != nil {
+		preference = flow.replicaPreference
+	}
+	if preference == nil {
+		return urlStrings
+	}
+	if preferred := preference(urlStrings); len(preferred) > 0 {
+		return preferred
+	}
+	return urlStrings
+}
+
+func spreadReplicas(urlStrings []string) []string {
+	if !SpreadReplicaReads || len(urlStrings) <= 1 {
+		return orderByDataCenterLatency(urlStrings)
+	}
+	if PreferFastestDataCenter && DataCenterOf != nil {
+		return orderByDataCenterLatency(urlStrings)
+	}
+	shuffled := append([]string(nil), urlStrings...)
+	replicaRand.shuffle(shuffled)
+	return shuffled
+}
+
+// rotateReplicas is the order to read the replicas in the given retry round, counted from 1
+func rotateReplicas(urlStrings []string, round int) []string {
+	if !SpreadReplicaReads || len(urlStrings) <= 1 {
+		return urlStrings
+	}
+	k := (round - 1) % len(urlStrings)
+	if k == 0 {
+		return urlStrings
+	}
+	return append(append(make([]string, 0, len(urlStrings)), urlStrings[k:]...), urlStrings[:k]...)
+}
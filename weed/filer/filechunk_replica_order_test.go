@@ -0,0 +1,121 @@
+package filer
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderReplicas(t *testing.T) {
+	defer func(spread bool, r *lockedRand) {
+		SpreadReplicaReads, replicaRand = spread, r
+	}(SpreadReplicaReads, replicaRand)
+	urls := []string{"http://a:8080/1,01", "http://b:8080/1,01", "http://c:8080/1,01"}
+
+	SpreadReplicaReads = false
+	assert.Equal(t, urls, orderReplicas(urls, nil))
+	assert.Equal(t, urls, rotateReplicas(urls, 2))
+
+	SpreadReplicaReads = true
+	// the same seed gives the same orders
+	replicaRand = newLockedRand(1)
+	var orders [][]string
+	for i := 0; i < 10; i++ {
+		orders = append(orders, orderReplicas(urls, nil))
+	}
+	replicaRand = newLockedRand(1)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, orders[i], orderReplicas(urls, nil))
+	}
+	firsts := make(map[string]bool)
+	for _, order := range orders {
+		assert.ElementsMatch(t, urls, order)
+		firsts[order[0]] = true
+	}
+	assert.Greater(t, len(firsts), 1)
+	assert.Equal(t, []string{"http://a:8080/1,01", "http://b:8080/1,01", "http://c:8080/1,01"}, urls)
+
+	assert.Equal(t, urls, rotateReplicas(urls, 1))
+	assert.Equal(t, []string{"http://b:8080/1,01", "http://c:8080/1,01", "http://a:8080/1,01"}, rotateReplicas(urls, 2))
+	assert.Equal(t, []string{"http://c:8080/1,01", "http://a:8080/1,01", "http://b:8080/1,01"}, rotateReplicas(urls, 3))
+	assert.Equal(t, urls, rotateReplicas(urls, 4))
+}
+
+func TestSpreadReplicaReadsRetry(t *testing.T) {
+	defer func(spread bool, r *lockedRand) {
+		SpreadReplicaReads, replicaRand = spread, r
+	}(SpreadReplicaReads, replicaRand)
+	SpreadReplicaReads, replicaRand = true, newLockedRand(1)
+	_, restoreClock := useFakeClock()
+	defer restoreClock()
+
+	var lock sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, strings.TrimPrefix(r.URL.Path, "/"))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	urls := []string{server.URL + "/a", server.URL + "/b"}
+
+	_, err := retriedFetchChunkData(make([]byte, 4), urls, nil, false, true, 0, &ReadFlow{retry: &RetryPolicy{InitialWait: time.Millisecond, MaxWait: time.Hour, MaxAttempts: 2}})
+	assert.Error(t, err)
+	// the second round starts from the replica tried last
+	assert.Equal(t, 4, len(requests))
+	assert.Equal(t, requests[1], requests[2])
+	assert.NotEqual(t, requests[0], requests[1])
+}
+
+func TestReplicaPreference(t *testing.T) {
+	var lock sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, r.URL.Path)
+		lock.Unlock()
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+	lookup := func(fileId string) ([]string, error) {
+		return []string{server.URL + "/dc1/" + fileId, server.URL + "/dc2/" + fileId}, nil
+	}
+
+	// no preference keeps the lookup order
+	_, err := fetchChunkRange(make([]byte, 4), lookup, "1,01", nil, false, 0, NewReadFlow(ReadSourceStream))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/dc1/1,01"}, requests)
+
+	requests = nil
+	flow := NewReadFlow(ReadSourceStream)
+	flow.SetReplicaPreference(PreferUrlsContaining("/dc2/"))
+	_, err = fetchChunkRange(make([]byte, 4), lookup, "1,02", nil, false, 0, flow)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/dc2/1,02"}, requests)
+
+	// the default preference applies to reads without their own, such as whole chunk reads
+	defer func(preference ReplicaPreference) {
+		DefaultReplicaPreference = preference
+	}(DefaultReplicaPreference)
+	DefaultReplicaPreference = PreferUrlsContaining("/dc2/")
+	requests = nil
+	var buf bytes.Buffer
+	assert.NoError(t, fetchWholeChunk(&buf, lookup, "1,03", nil, false, nil))
+	assert.Equal(t, []string{"/dc2/1,03"}, requests)
+
+	// a preference filtering out all replicas is ignored
+	flow.SetReplicaPreference(func(urlStrings []string) []string {
+		return nil
+	})
+	requests = nil
+	_, err = fetchChunkRange(make([]byte, 4), lookup, "1,04", nil, false, 0, flow)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/dc1/1,04"}, requests)
+}
@@ -0,0 +1,249 @@
+package filer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/util"
+)
+
+// RetryPolicy bounds the retries of a chunk read. All replicas are tried in each round.
+// The wait before the next round starts at InitialWait and grows by Multiplier each round,
+// and no more rounds are tried once the wait reaches MaxWait, or after MaxAttempts rounds if positive.
+// Each wait is randomized by up to +/- Jitter of it, so readers failing together do not retry in sync.
+// A positive Timeout bounds the whole fetch, reads included: no read starts, and no wait ends, past it,
+// and a read still in flight at the timeout is aborted.
+// A positive StallTimeout abandons a read receiving no data for that long, e.g. from a replica accepting
+// the connection but not answering, and the next replica is read right away.
+// A chunk just written can be not found on the replicas the replication has not reached yet, so with
+// a positive NotFoundAttempts a replica answering 404 hands over to the next one, and once no replica
+// has the chunk, the replicas are read again up to NotFoundAttempts times, NotFoundWait apart,
+// randomized by NotFoundJitter, without using up the backoff of the other errors.
+type RetryPolicy struct {
+	InitialWait      time.Duration
+	MaxWait          time.Duration
+	Multiplier       float64 // up to 1 is 1.5
+	Jitter           float64 // fraction of the wait, from 0 to 1
+	MaxAttempts      int
+	Timeout          time.Duration
+	StallTimeout     time.Duration
+	NotFoundWait     time.Duration
+	NotFoundAttempts int
+	NotFoundJitter   float64
+}
+
+// the backoff of the default retry policies, the defaults keep the historical schedule
+var (
+	RetryInitialWait = time.Second
+	RetryMultiplier  = 1.5
+	RetryJitter      = 0.0
+	RetryMaxAttempts = 0
+	RetryTimeout     time.Duration
+	// long enough for a busy volume server, time spent writing out the data read is not counted
+	RetryStallTimeout = 30 * time.Second
+	// about the time the replication takes to reach the other replicas of a chunk just written
+	RetryNotFoundWait     = 100 * time.Millisecond
+	RetryNotFoundAttempts = 3
+	RetryNotFoundJitter   = 0.2
+)
+
+// nextWait grows the wait of a round into the wait of the next one
+func (policy *RetryPolicy) nextWait(waitTime time.Duration) time.Duration {
+	if policy.Multiplier <= 1 {
+		return waitTime + waitTime/2
+	}
+	return time.Duration(float64(waitTime) * policy.Multiplier)
+}
+
+// jittered is the time to actually wait before retrying
+func (policy *RetryPolicy) jittered(waitTime time.Duration) time.Duration {
+	return jittered(waitTime, policy.Jitter)
+}
+
+func jittered(waitTime time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return waitTime
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	return time.Duration(float64(waitTime) * (1 + jitter*(2*rand.Float64()-1)))
+}
+
+// nextReplicaIfNotFound tells whether to read the next replica after the error, which would end the fetch otherwise
+func (policy *RetryPolicy) nextReplicaIfNotFound(err error) bool {
+	return policy.NotFoundAttempts > 0 && util.IsNotFound(err)
+}
+
+// notFoundWait tells whether to read the replicas again after they were all read passes times,
+// the last one failing with the error, and how long to wait before
+func (policy *RetryPolicy) notFoundWait(err error, passes int) (time.Duration, bool) {
+	if passes > policy.NotFoundAttempts || !util.IsNotFound(err) {
+		return 0, false
+	}
+	return jittered(policy.NotFoundWait, policy.NotFoundJitter), true
+}
+
+// exhausted tells whether no more rounds are allowed after the given number of rounds
+func (policy *RetryPolicy) exhausted(rounds int) bool {
+	return policy.MaxAttempts > 0 && rounds >= policy.MaxAttempts
+}
+
+// timeout starts the Timeout of a fetch. The returned context aborts the read in flight at the deadline.
+func (policy *RetryPolicy) timeout(ctx context.Context) (context.Context, time.Time, context.CancelFunc) {
+	if policy.Timeout <= 0 {
+		return ctx, time.Time{}, func() {}
+	}
+	ctx, cancel := context.WithTimeout(ctx, policy.Timeout)
+	return ctx, retryClock.Now().Add(policy.Timeout), cancel
+}
+
+// timedOut tells whether the deadline of a fetch has passed, optionally after waiting for d
+func timedOut(deadline time.Time, d time.Duration) bool {
+	return !deadline.IsZero() && retryClock.Now().Add(d).After(deadline)
+}
+
+// RetryBudgetBytesPerSecond, when positive, makes the retry budget of a read grow with its size:
+// a read is retried for about as long as it would take to read it again at this rate, within
+// [MinRetryWait, MaxRetryWait]. 0 uses util.RetryWaitTime for all reads.
+var (
+	RetryBudgetBytesPerSecond int64
+	MinRetryWait              = 2 * time.Second
+	MaxRetryWait              = 10 * time.Minute
+)
+
+// minRetryInitialWait replaces a wait of 0 before the second round, which would never grow
+const minRetryInitialWait = 100 * time.Millisecond
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return (&RetryPolicy{
+		InitialWait:      RetryInitialWait,
+		MaxWait:          util.RetryWaitTime,
+		Multiplier:       RetryMultiplier,
+		Jitter:           RetryJitter,
+		MaxAttempts:      RetryMaxAttempts,
+		Timeout:          RetryTimeout,
+		StallTimeout:     RetryStallTimeout,
+		NotFoundWait:     RetryNotFoundWait,
+		NotFoundAttempts: RetryNotFoundAttempts,
+		NotFoundJitter:   RetryNotFoundJitter,
+	}).clamped()
+}
+
+// clamped returns the policy, or a copy of it whose waits grow from a positive InitialWait,
+// and whose MaxWait is above InitialWait so at least one round is read
+func (policy *RetryPolicy) clamped() *RetryPolicy {
+	if policy.InitialWait > 0 && policy.MaxWait > policy.InitialWait {
+		return policy
+	}
+	clamped := *policy
+	if clamped.InitialWait <= 0 {
+		clamped.InitialWait = minRetryInitialWait
+	}
+	if clamped.MaxWait <= clamped.InitialWait {
+		clamped.MaxWait = clamped.InitialWait + 1
+	}
+	return &clamped
+}
+
+// NewRetryPolicyForSize derives the retry budget from the expected bytes of the read,
+// so small reads give up quickly and large reads, which are expensive to restart, are more patient.
+func NewRetryPolicyForSize(expectedBytes int64) *RetryPolicy {
+	if RetryBudgetBytesPerSecond <= 0 {
+		return DefaultRetryPolicy()
+	}
+	policy := DefaultRetryPolicy()
+	policy.MaxWait = time.Duration(float64(expectedBytes) / float64(RetryBudgetBytesPerSecond) * float64(time.Second))
+	if policy.MaxWait < MinRetryWait {
+		policy.MaxWait = MinRetryWait
+	}
+	if policy.MaxWait > MaxRetryWait {
+		policy.MaxWait = MaxRetryWait
+	}
+	return policy.clamped()
+}
+
+// retryPolicy returns the policy of the flow, or else one for a read of n bytes
+func (flow *ReadFlow) retryPolicy(ctx context.Context, n int64) *RetryPolicy {
+	policy := NewRetryPolicyForSize(n)
+	if flow != nil && flow.retry != nil {
+		policy = flow.retry.clamped()
+	}
+	if IsFailFast(ctx) {
+		// a single round, which ends without waiting
+		failFast := *policy
+		failFast.MaxAttempts, failFast.NotFoundAttempts = 1, 0
+		return &failFast
+	}
+	return policy
+}
+
+type failFastKey struct{}
+
+// WithFailFast makes the chunk reads under the context try each replica once, and return the error
+// right away instead of waiting to retry, e.g. for interactive reads behind a circuit breaker.
+func WithFailFast(ctx context.Context) context.Context {
+	return context.WithValue(ctx, failFastKey{}, true)
+}
+
+// IsFailFast tells whether the chunk reads under the context are not retried, see WithFailFast
+func IsFailFast(ctx context.Context) bool {
+	failFast, _ := ctx.Value(failFastKey{}).(bool)
+	return failFast
+}
+
+// ErrReadStalled is the error of a read abandoned after receiving no data for the StallTimeout
+var ErrReadStalled = errors.New("read stalled")
+
+// stallGuard cancels a read once it receives no data for the timeout. The time spent
+// handling the data, between pause and resume, is not counted. A nil guard does nothing.
+type stallGuard struct {
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	fired   atomic.Bool
+}
+
+// stallTimeout starts the StallTimeout of one read
+func (policy *RetryPolicy) stallTimeout(ctx context.Context) (context.Context, *stallGuard) {
+	if policy.StallTimeout <= 0 {
+		return ctx, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	g := &stallGuard{timeout: policy.StallTimeout, cancel: cancel}
+	g.timer = time.AfterFunc(g.timeout, func() {
+		g.fired.Store(true)
+		cancel()
+	})
+	return ctx, g
+}
+
+func (g *stallGuard) pause() {
+	if g != nil {
+		g.timer.Stop()
+	}
+}
+
+func (g *stallGuard) resume() {
+	if g != nil {
+		g.timer.Reset(g.timeout)
+	}
+}
+
+// stop ends the read, and tells whether it was cancelled for stalling
+func (g *stallGuard) stop() (stalled bool) {
+	if g == nil {
+		return false
+	}
+	g.timer.Stop()
+	g.cancel()
+	return g.fired.Load()
+}
+
+func (g *stallGuard) error(err error) error {
+	return fmt.Errorf("%w for %v: %v", ErrReadStalled, g.timeout, err)
+}
@@ -0,0 +1,418 @@
+package filer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/util"
+)
+
+func TestNewRetryPolicyForSize(t *testing.T) {
+	assert.Equal(t, util.RetryWaitTime, NewRetryPolicyForSize(1<<40).MaxWait)
+
+	RetryBudgetBytesPerSecond = 1024 * 1024
+	defer func() {
+		RetryBudgetBytesPerSecond = 0
+	}()
+	assert.Equal(t, MinRetryWait, NewRetryPolicyForSize(1024).MaxWait)
+	assert.Equal(t, 30*time.Second, NewRetryPolicyForSize(30*1024*1024).MaxWait)
+	assert.Equal(t, MaxRetryWait, NewRetryPolicyForSize(1<<40).MaxWait)
+
+	// an explicit policy of the flow wins
+	flow := &ReadFlow{retry: &RetryPolicy{InitialWait: time.Second, MaxWait: 3 * time.Second}}
+	assert.Equal(t, 3*time.Second, flow.retryPolicy(context.Background(), 1<<40).MaxWait)
+	assert.Equal(t, MaxRetryWait, (*ReadFlow)(nil).retryPolicy(context.Background(), 1<<40).MaxWait)
+
+	defer func(wait time.Duration) {
+		RetryInitialWait = wait
+	}(RetryInitialWait)
+	RetryInitialWait = 0
+	assert.Equal(t, minRetryInitialWait, DefaultRetryPolicy().InitialWait)
+	RetryInitialWait = time.Hour
+	assert.Less(t, time.Hour, NewRetryPolicyForSize(1024).MaxWait, "at least one round")
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	urls := []string{server.URL + "/1,01"}
+
+	sleeps := func(policy *RetryPolicy) []time.Duration {
+		clock, restoreClock := useFakeClock()
+		defer restoreClock()
+		_, err := retriedFetchChunkData(make([]byte, 4), urls, nil, false, false, 0, &ReadFlow{retry: policy})
+		assert.Error(t, err)
+		return clock.sleeps
+	}
+
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond},
+		sleeps(&RetryPolicy{InitialWait: 100 * time.Millisecond, MaxWait: time.Second, Multiplier: 2}))
+	// the last allowed round does not wait
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+		sleeps(&RetryPolicy{InitialWait: 100 * time.Millisecond, MaxWait: time.Second, Multiplier: 2, MaxAttempts: 3}))
+	// no multiplier grows by half
+	assert.Equal(t, []time.Duration{time.Second, 1500 * time.Millisecond},
+		sleeps(&RetryPolicy{InitialWait: time.Second, MaxWait: 2 * time.Second}))
+
+	for _, wait := range sleeps(&RetryPolicy{InitialWait: 100 * time.Millisecond, MaxWait: time.Minute, Multiplier: 2, Jitter: 0.5, MaxAttempts: 20}) {
+		assert.Greater(t, wait, time.Duration(0))
+	}
+	// degenerate policies still read a round, failing instead of reading nothing, and their waits grow
+	assert.Equal(t, []time.Duration{time.Second}, sleeps(&RetryPolicy{InitialWait: time.Second, MaxWait: time.Second}))
+	assert.Equal(t, []time.Duration{2 * time.Second}, sleeps(&RetryPolicy{InitialWait: 2 * time.Second, MaxWait: time.Second}))
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 150 * time.Millisecond, 225 * time.Millisecond},
+		sleeps(&RetryPolicy{MaxWait: 300 * time.Millisecond}))
+
+	policy := &RetryPolicy{Jitter: 0.25}
+	for i := 0; i < 100; i++ {
+		wait := policy.jittered(time.Second)
+		assert.GreaterOrEqual(t, wait, 750*time.Millisecond)
+		assert.LessOrEqual(t, wait, 1250*time.Millisecond)
+	}
+}
+
+type scriptedRead struct {
+	data        string
+	shouldRetry bool
+	err         error
+	delay       time.Duration // on the fake clock
+}
+
+// useScriptedReads replaces the volume server reads with the responses, in order, and records the urls read
+func useScriptedReads(reads []scriptedRead) (urls *[]string, restore func()) {
+	urls = new([]string)
+	readUrlAsStream = func(ctx context.Context, fileUrl string, header http.Header, cipherKey []byte, isContentGzipped bool, isFullChunk bool, offset int64, size int, fn func(data []byte)) (bool, error) {
+		*urls = append(*urls, fileUrl)
+		if len(*urls) > len(reads) {
+			return false, fmt.Errorf("unexpected read %d of %s", len(*urls), fileUrl)
+		}
+		read := reads[len(*urls)-1]
+		if clock, ok := retryClock.(*fakeClock); ok {
+			clock.advance(read.delay)
+		}
+		if read.data != "" {
+			fn([]byte(read.data))
+		}
+		return read.shouldRetry, read.err
+	}
+	return urls, func() {
+		readUrlAsStream = util.ReadUrlAsStreamWithContext
+	}
+}
+
+func TestRetriedFetchChunkDataScripted(t *testing.T) {
+	unavailable := errors.New("503 Service Unavailable")
+	tests := []struct {
+		name     string
+		replicas int
+		reads    []scriptedRead
+		expected string
+		err      bool
+		urls     []string
+		sleeps   int
+	}{
+		{
+			name:     "first read",
+			replicas: 2,
+			reads:    []scriptedRead{{data: "data", shouldRetry: true}},
+			expected: "data",
+			urls:     []string{"a"},
+		},
+		{
+			name:     "next replica",
+			replicas: 2,
+			reads:    []scriptedRead{{shouldRetry: true, err: unavailable}, {data: "data", shouldRetry: true}},
+			expected: "data",
+			urls:     []string{"a", "b"},
+		},
+		{
+			name:     "next round",
+			replicas: 1,
+			reads:    []scriptedRead{{shouldRetry: true, err: unavailable}, {data: "data", shouldRetry: true}},
+			expected: "data",
+			urls:     []string{"a", "a"},
+			sleeps:   1,
+		},
+		{
+			name:     "permanent error",
+			replicas: 2,
+			reads:    []scriptedRead{{shouldRetry: false, err: errors.New("416 Requested Range Not Satisfiable")}},
+			err:      true,
+			urls:     []string{"a"},
+		},
+		{
+			name:     "partial read",
+			replicas: 2,
+			reads:    []scriptedRead{{data: "da", shouldRetry: true, err: unavailable}, {data: "data", shouldRetry: true}},
+			expected: "data",
+			urls:     []string{"a", "b"},
+		},
+		{
+			name:     "exhausted",
+			replicas: 1,
+			reads:    []scriptedRead{{shouldRetry: true, err: unavailable}, {shouldRetry: true, err: unavailable}, {shouldRetry: true, err: unavailable}},
+			err:      true,
+			urls:     []string{"a", "a", "a"},
+			sleeps:   2,
+		},
+	}
+	for _, test := range tests {
+		replicas := []string{"http://a:8080/1,01", "http://b:8080/1,01"}[:test.replicas]
+		var expectedUrls []string
+		for _, u := range test.urls {
+			expectedUrls = append(expectedUrls, "http://"+u+":8080/1,01")
+		}
+		flow := &ReadFlow{retry: &RetryPolicy{InitialWait: time.Second, MaxWait: time.Minute, MaxAttempts: 3}}
+
+		for _, stream := range []bool{false, true} {
+			clock, restoreClock := useFakeClock()
+			urls, restoreReads := useScriptedReads(test.reads)
+			var data string
+			var err error
+			if stream {
+				var buf bytes.Buffer
+				_, err = retriedStreamFetchChunkData(&buf, replicas, nil, false, true, 0, 4, flow)
+				data = buf.String()
+			} else {
+				buffer := make([]byte, 4)
+				var n int
+				n, err = retriedFetchChunkData(buffer, replicas, nil, false, true, 0, flow)
+				data = string(buffer[:n])
+			}
+			restoreReads()
+			restoreClock()
+
+			if test.err {
+				assert.Error(t, err, "%s stream:%v", test.name, stream)
+			} else {
+				assert.NoError(t, err, "%s stream:%v", test.name, stream)
+				assert.Equal(t, test.expected, data, "%s stream:%v", test.name, stream)
+			}
+			assert.Equal(t, expectedUrls, *urls, "%s stream:%v", test.name, stream)
+			assert.Equal(t, test.sleeps, len(clock.sleeps), "%s stream:%v", test.name, stream)
+		}
+	}
+}
+
+func TestRetriedStreamFetchChunkDataPartialWrite(t *testing.T) {
+	unavailable := errors.New("connection reset")
+	replicas := []string{"http://a:8080/1,01", "http://b:8080/1,01"}
+	flow := &ReadFlow{retry: &RetryPolicy{InitialWait: time.Second, MaxWait: 1200 * time.Millisecond}}
+
+	// each replica drops the connection, the second one after sending more
+	_, restoreClock := useFakeClock()
+	defer restoreClock()
+	urls, restoreReads := useScriptedReads([]scriptedRead{
+		{data: "ab", shouldRetry: true, err: unavailable},
+		{data: "abc", shouldRetry: true, err: unavailable},
+	})
+	var buf bytes.Buffer
+	written, err := retriedStreamFetchChunkData(&buf, replicas, nil, false, true, 0, 6, flow)
+	restoreReads()
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, 2, len(*urls))
+	assert.Equal(t, 3, written)
+	assert.Equal(t, "abc", buf.String())
+
+	// the stream tells where the valid data ends, to resume from there
+	_, restoreReads = useScriptedReads([]scriptedRead{
+		{data: "xxxx"},
+		{data: "abc", err: unavailable},
+	})
+	defer restoreReads()
+	lookup := func(fileId string) ([]string, error) {
+		return []string{"http://a:8080/" + fileId}, nil
+	}
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 4, ModifiedTsNs: 1},
+		{FileId: "1,02", Offset: 4, Size: 6, ModifiedTsNs: 1},
+	}
+	buf.Reset()
+	err = StreamFileContent(lookup, chunks, &buf)
+	var partialErr *PartialReadError
+	if assert.ErrorAs(t, err, &partialErr) {
+		assert.Equal(t, int64(7), partialErr.Offset)
+	}
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, "xxxxabc", buf.String())
+}
+
+func TestRetriedFetchChunkDataFailFast(t *testing.T) {
+	unavailable := errors.New("503 Service Unavailable")
+	replicas := []string{"http://a:8080/1,01", "http://b:8080/1,01"}
+	failing := scriptedRead{shouldRetry: true, err: unavailable}
+	ctx := WithFailFast(context.Background())
+	assert.True(t, IsFailFast(ctx))
+	assert.False(t, IsFailFast(context.Background()))
+
+	clock, restoreClock := useFakeClock()
+	defer restoreClock()
+	urls, restoreReads := useScriptedReads([]scriptedRead{failing, failing})
+	_, err := retriedFetchChunkDataWithContext(ctx, make([]byte, 4), replicas, nil, CompressionNone, true, 0, nil)
+	restoreReads()
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, replicas, *urls)
+	assert.Empty(t, clock.sleeps)
+
+	urls, restoreReads = useScriptedReads([]scriptedRead{failing, failing})
+	_, err = retriedStreamFetchChunkDataWithContext(ctx, io.Discard, replicas, nil, CompressionNone, true, 0, 4, NewReadFlow(ReadSourceStream))
+	restoreReads()
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, replicas, *urls)
+	assert.Empty(t, clock.sleeps)
+
+	// no waiting for the locations either
+	_, err = lookupChunkUrls(ctx, func(fileId string) ([]string, error) {
+		return nil, nil
+	}, "1,01", 4, nil)
+	assert.ErrorContains(t, err, "no locations")
+	assert.Empty(t, clock.sleeps)
+
+	// the default still retries
+	urls, restoreReads = useScriptedReads([]scriptedRead{failing, failing, {data: "abcd"}})
+	defer restoreReads()
+	n, err := retriedFetchChunkDataWithContext(context.Background(), make([]byte, 4), replicas, nil, CompressionNone, true, 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, 3, len(*urls))
+	assert.Equal(t, 1, len(clock.sleeps))
+}
+
+func TestRetriedFetchChunkDataNotFoundYet(t *testing.T) {
+	notFound := scriptedRead{err: &util.HttpStatusError{Url: "http://a:8080/1,01", StatusCode: http.StatusNotFound, Status: "404 Not Found"}}
+	found := scriptedRead{data: "abcd"}
+	replicas := []string{"http://a:8080/1,01", "http://b:8080/1,01"}
+	clock, restoreClock := useFakeClock()
+	defer restoreClock()
+
+	// the replica reached by the replication answers right away
+	urls, restoreReads := useScriptedReads([]scriptedRead{notFound, found})
+	buffer := make([]byte, 4)
+	n, err := retriedFetchChunkData(buffer, replicas, nil, false, true, 0, nil)
+	restoreReads()
+	assert.NoError(t, err)
+	assert.Equal(t, "abcd", string(buffer[:n]))
+	assert.Equal(t, replicas, *urls)
+	assert.Empty(t, clock.sleeps)
+
+	// no replica has the chunk yet, so they are read again shortly after
+	urls, restoreReads = useScriptedReads([]scriptedRead{notFound, notFound, notFound, notFound, found})
+	var buf bytes.Buffer
+	_, err = retriedStreamFetchChunkData(&buf, replicas, nil, false, true, 0, 4, nil)
+	restoreReads()
+	assert.NoError(t, err)
+	assert.Equal(t, "abcd", buf.String())
+	assert.Equal(t, 5, len(*urls))
+	if assert.Equal(t, 2, len(clock.sleeps)) {
+		for _, sleep := range clock.sleeps {
+			assert.InDelta(t, RetryNotFoundWait, sleep, float64(RetryNotFoundWait)*RetryNotFoundJitter)
+		}
+	}
+
+	// a chunk still missing after the replication window is not found
+	clock.sleeps = nil
+	urls, restoreReads = useScriptedReads([]scriptedRead{notFound, notFound, notFound, notFound, notFound, notFound, notFound, notFound})
+	_, err = retriedFetchChunkData(buffer, replicas, nil, false, true, 0, nil)
+	restoreReads()
+	assert.True(t, util.IsNotFound(err), "unexpected error %v", err)
+	assert.Equal(t, 2*(1+RetryNotFoundAttempts), len(*urls))
+	assert.Equal(t, RetryNotFoundAttempts, len(clock.sleeps))
+
+	// policies without not found retries fail on the first 404
+	urls, restoreReads = useScriptedReads([]scriptedRead{notFound})
+	defer restoreReads()
+	_, err = retriedFetchChunkData(buffer, replicas, nil, false, true, 0, &ReadFlow{retry: &RetryPolicy{InitialWait: time.Second, MaxWait: time.Minute}})
+	assert.True(t, util.IsNotFound(err), "unexpected error %v", err)
+	assert.Equal(t, 1, len(*urls))
+}
+
+func TestRetryPolicyTimeout(t *testing.T) {
+	unavailable := errors.New("503 Service Unavailable")
+	replicas := []string{"http://a:8080/1,01", "http://b:8080/1,01", "http://c:8080/1,01"}
+	flow := &ReadFlow{retry: &RetryPolicy{InitialWait: time.Second, MaxWait: time.Hour, Timeout: 5 * time.Second}}
+
+	// slow reads use up the timeout before trying the last replica
+	clock, restoreClock := useFakeClock()
+	slow := scriptedRead{shouldRetry: true, err: unavailable, delay: 3 * time.Second}
+	urls, restoreReads := useScriptedReads([]scriptedRead{slow, slow})
+	_, err := retriedFetchChunkData(make([]byte, 4), replicas, nil, false, true, 0, flow)
+	restoreReads()
+	restoreClock()
+	assert.ErrorIs(t, err, ErrReadDeadlineExceeded)
+	assert.ErrorContains(t, err, "503")
+	assert.Equal(t, replicas[:2], *urls)
+	assert.Empty(t, clock.sleeps)
+
+	// fast failures back off until the next wait would end past the timeout
+	clock, restoreClock = useFakeClock()
+	fast := scriptedRead{shouldRetry: true, err: unavailable}
+	urls, restoreReads = useScriptedReads([]scriptedRead{fast, fast, fast, fast})
+	_, err = retriedStreamFetchChunkData(io.Discard, replicas[:1], nil, false, true, 0, 4, flow)
+	restoreReads()
+	restoreClock()
+	assert.ErrorIs(t, err, ErrReadDeadlineExceeded)
+	assert.Equal(t, 4, len(*urls))
+	assert.Equal(t, []time.Duration{time.Second, 1500 * time.Millisecond, 2250 * time.Millisecond}, clock.sleeps)
+
+	// a hanging read is aborted at the timeout
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	start := time.Now()
+	_, err = retriedFetchChunkData(make([]byte, 4), []string{server.URL + "/1,01"}, nil, false, true, 0, &ReadFlow{retry: &RetryPolicy{InitialWait: time.Second, MaxWait: time.Hour, Timeout: 100 * time.Millisecond}})
+	assert.ErrorIs(t, err, ErrReadDeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestRetriedFetchChunkDataStallTimeout(t *testing.T) {
+	var urls []string
+	readUrlAsStream = func(ctx context.Context, fileUrl string, header http.Header, cipherKey []byte, isContentGzipped bool, isFullChunk bool, offset int64, size int, fn func(data []byte)) (bool, error) {
+		urls = append(urls, fileUrl)
+		if fileUrl == "http://sick:8080/1,01" {
+			// accepts the connection, then sends nothing
+			<-ctx.Done()
+			return false, ctx.Err()
+		}
+		fn([]byte("data"))
+		return false, nil
+	}
+	defer func() {
+		readUrlAsStream = util.ReadUrlAsStreamWithContext
+	}()
+	policy := &RetryPolicy{InitialWait: time.Second, MaxWait: time.Minute, StallTimeout: 50 * time.Millisecond}
+
+	start := time.Now()
+	buffer := make([]byte, 4)
+	n, err := retriedFetchChunkData(buffer, []string{"http://sick:8080/1,01", "http://fast:8080/1,01"}, nil, false, true, 0, &ReadFlow{retry: policy})
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(buffer[:n]))
+	assert.Equal(t, []string{"http://sick:8080/1,01", "http://fast:8080/1,01"}, urls)
+	assert.Less(t, time.Since(start), time.Second)
+
+	urls = nil
+	var written bytes.Buffer
+	_, err = retriedStreamFetchChunkData(&written, []string{"http://sick:8080/1,01", "http://fast:8080/1,01"}, nil, false, true, 0, 4, &ReadFlow{retry: policy})
+	assert.NoError(t, err)
+	assert.Equal(t, "data", written.String())
+	assert.Equal(t, 2, len(urls))
+
+	// with a single replica, the stalled reads are retried, then reported
+	_, restore := useFakeClock()
+	defer restore()
+	policy.MaxAttempts = 2
+	_, err = retriedFetchChunkData(buffer, []string{"http://sick:8080/1,01"}, nil, false, true, 0, &ReadFlow{retry: policy})
+	assert.ErrorIs(t, err, ErrReadStalled)
+}
@@ -1,8 +1,10 @@
 package filer
 
 import (
-	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"math"
 	"sync"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
 )
 
 const SectionSize = 2 * 1024 * 1024 * 32 // 64MiB
@@ -29,23 +31,51 @@ func (section *FileChunkSection) addChunk(chunk *filer_pb.FileChunk) error {
 
 	start, stop := max(int64(section.sectionIndex)*SectionSize, chunk.Offset), min(((int64(section.sectionIndex)+1)*SectionSize), chunk.Offset+int64(chunk.Size))
 
+	isNewest := isNewestChunk(chunk, section.chunks)
 	section.chunks = append(section.chunks, chunk)
 
 	if section.visibleIntervals == nil {
 		section.visibleIntervals = readResolvedChunks(section.chunks, int64(section.sectionIndex)*SectionSize, (int64(section.sectionIndex)+1)*SectionSize)
+	} else if !isNewest {
+		// overlaps are resolved by isOlderChunk, which the modification times of the intervals cannot tell
+		section.resolveOverlaps()
+		return nil
 	} else {
-		MergeIntoVisibles(section.visibleIntervals, start, stop, chunk)
-		garbageFileIds := FindGarbageChunks(section.visibleIntervals, start, stop)
-		removeGarbageChunks(section, garbageFileIds)
+		mergeIntoVisibles(section.visibleIntervals, start, stop, chunk, math.MaxInt64)
+		removeGarbageChunks(section, coveredChunkFileIds(chunk, section.chunks))
 	}
 
 	if section.chunkViews != nil {
-		MergeIntoChunkViews(section.chunkViews, start, stop, chunk)
+		mergeIntoChunkViews(section.chunkViews, start, stop, chunk, math.MaxInt64)
 	}
 
 	return nil
 }
 
+// resolveOverlaps resolves the visible intervals and the chunk views again from all the chunks
+func (section *FileChunkSection) resolveOverlaps() {
+	start, stop := int64(section.sectionIndex)*SectionSize, (int64(section.sectionIndex)+1)*SectionSize
+	section.visibleIntervals = readResolvedChunks(section.chunks, start, stop)
+	section.chunks, _ = SeparateGarbageChunks(section.visibleIntervals, section.chunks)
+	if section.chunkViews != nil {
+		section.chunkViews = ViewFromVisibleIntervals(section.visibleIntervals, start, stop)
+		if section.reader != nil {
+			section.reader.chunkViews = section.chunkViews
+		}
+	}
+}
+
+// coveredChunkFileIds returns the chunks entirely overwritten by the newest chunk, which is kept
+func coveredChunkFileIds(newest *filer_pb.FileChunk, chunks []*filer_pb.FileChunk) (garbageFileIds map[string]struct{}) {
+	garbageFileIds = make(map[string]struct{})
+	for _, chunk := range chunks {
+		if chunk.FileId != newest.FileId && newest.Offset <= chunk.Offset && chunk.Offset+int64(chunk.Size) <= newest.Offset+int64(newest.Size) {
+			garbageFileIds[chunk.FileId] = struct{}{}
+		}
+	}
+	return
+}
+
 func removeGarbageChunks(section *FileChunkSection, garbageFileIds map[string]struct{}) {
 	for i := 0; i < len(section.chunks); {
 		t := section.chunks[i]
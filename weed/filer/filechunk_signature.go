@@ -0,0 +1,113 @@
+package filer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/util"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// SignatureEntry is the content hash of one visible part of a file.
+// Hash is the hash of the whole chunk, and OffsetInChunk and Size tell which part of it is visible.
+type SignatureEntry struct {
+	Offset        int64
+	Size          int64
+	OffsetInChunk int64
+	Hash          string // <algorithm>:<hex digest>
+}
+
+// WriteSignature resolves the chunk manifests and writes one line per visible part of the file, in file order:
+//
+//	<offset> <size> <offset in chunk> <algorithm>:<hex digest>
+//
+// The recorded chunk checksum is used, or else the md5 ETag. Only chunks with neither are fetched.
+// Holes have no entry.
+func WriteSignature(writer io.Writer, lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk) error {
+	dataChunks, _, err := ResolveChunkManifestAll(lookupFileIdFn, chunks)
+	if err != nil {
+		return err
+	}
+	chunksByFileId := make(map[string]*filer_pb.FileChunk, len(dataChunks))
+	for _, chunk := range dataChunks {
+		chunksByFileId[chunk.GetFileIdString()] = chunk
+	}
+
+	w := bufio.NewWriter(writer)
+	hashes := make(map[string]string)
+	visibles := readResolvedChunks(dataChunks, 0, math.MaxInt64)
+	for x := visibles.Front(); x != nil; x = x.Next {
+		visible := x.Value
+		hash, found := hashes[visible.fileId]
+		if !found {
+			if hash, err = chunkContentHash(lookupFileIdFn, chunksByFileId[visible.fileId]); err != nil {
+				return err
+			}
+			hashes[visible.fileId] = hash
+		}
+		if _, err = fmt.Fprintf(w, "%d %d %d %s\n", visible.start, visible.stop-visible.start, visible.offsetInChunk, hash); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func chunkContentHash(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunk *filer_pb.FileChunk) (string, error) {
+	if chunk.ChecksumAlgorithm != "" && len(chunk.Checksum) > 0 {
+		return chunk.ChecksumAlgorithm + ":" + hex.EncodeToString(chunk.Checksum), nil
+	}
+	if md5Digest := util.Base64Md5ToBytes(chunk.ETag); len(md5Digest) == md5.Size {
+		return ChecksumMd5 + ":" + hex.EncodeToString(md5Digest), nil
+	}
+	var buf bytes.Buffer
+	if err := fetchWholeChunk(&buf, lookupFileIdFn, chunk.GetFileIdString(), chunk.CipherKey, chunk.IsCompressed, NewReadFlow(ReadSourceStream)); err != nil {
+		return "", fmt.Errorf("hash chunk %s: %v", chunk.GetFileIdString(), err)
+	}
+	md5Digest := md5.Sum(buf.Bytes())
+	return ChecksumMd5 + ":" + hex.EncodeToString(md5Digest[:]), nil
+}
+
+// ReadSignature parses the output of WriteSignature.
+func ReadSignature(reader io.Reader) (entries []*SignatureEntry, err error) {
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		entry := &SignatureEntry{}
+		if _, err = fmt.Sscanf(text, "%d %d %d %s", &entry.Offset, &entry.Size, &entry.OffsetInChunk, &entry.Hash); err != nil {
+			return nil, fmt.Errorf("signature line %d: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// ChangedRanges compares the signature of a target copy with the signature of the source,
+// and returns the ranges of the source to transfer, i.e. those without an identical entry in the target.
+// Holes of the source are not included.
+func ChangedRanges(source, target []*SignatureEntry) (changed []ReadRange) {
+	unchanged := make(map[SignatureEntry]struct{}, len(target))
+	for _, entry := range target {
+		unchanged[*entry] = struct{}{}
+	}
+	for _, entry := range source {
+		if _, found := unchanged[*entry]; found {
+			continue
+		}
+		if n := len(changed); n > 0 && changed[n-1].Offset+changed[n-1].Size == entry.Offset {
+			changed[n-1].Size += entry.Size
+			continue
+		}
+		changed = append(changed, ReadRange{Offset: entry.Offset, Size: entry.Size})
+	}
+	return
+}
@@ -0,0 +1,47 @@
+package filer
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestSignature(t *testing.T) {
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,03": "0123456789",
+	})
+	defer closeFn()
+
+	etag := md5.Sum([]byte("abcdefghij"))
+	checksumChunk := &filer_pb.FileChunk{FileId: "1,02", Offset: 10, Size: 10, ModifiedTsNs: 2}
+	assert.NoError(t, SetChunkChecksum(checksumChunk, ChecksumSha256, []byte("klmnopqrst")))
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 10, ModifiedTsNs: 1, ETag: base64.StdEncoding.EncodeToString(etag[:])},
+		checksumChunk,
+		// no hash recorded, partly overwritten by the chunk above
+		{FileId: "1,03", Offset: 15, Size: 10, ModifiedTsNs: 1},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSignature(&buf, lookup, chunks))
+	entries, err := ReadSignature(&buf)
+	assert.NoError(t, err)
+	if assert.Equal(t, 3, len(entries)) {
+		assert.Equal(t, SignatureEntry{Offset: 0, Size: 10, Hash: "md5:" + hex.EncodeToString(etag[:])}, *entries[0])
+		assert.Equal(t, int64(10), entries[1].Offset)
+		assert.Contains(t, entries[1].Hash, "sha256:")
+		data := md5.Sum([]byte("0123456789"))
+		assert.Equal(t, SignatureEntry{Offset: 20, Size: 5, OffsetInChunk: 5, Hash: "md5:" + hex.EncodeToString(data[:])}, *entries[2])
+	}
+
+	// the target has an outdated second half
+	target := []*SignatureEntry{entries[0], {Offset: 10, Size: 10, Hash: "md5:00"}}
+	assert.Equal(t, []ReadRange{{Offset: 10, Size: 15}}, ChangedRanges(entries, target))
+	assert.Nil(t, ChangedRanges(entries, entries))
+}
@@ -0,0 +1,35 @@
+package filer
+
+import (
+	"github.com/seaweedfs/seaweedfs/weed/util/chunk_cache"
+)
+
+// WholeChunkCache keeps whole chunk bodies by file id. The content of a file id never changes,
+// so entries never go stale. Set must copy the data it keeps, since the caller reuses it.
+type WholeChunkCache interface {
+	Get(fileId string) ([]byte, bool)
+	Set(fileId string, data []byte)
+}
+
+// FetchedChunkCache, when set, is consulted by fetchWholeChunk before the volume servers, and filled
+// with the chunks it fetches. weed mount sets it to keep the manifests it resolves again and again
+// as readers seek around a file.
+var FetchedChunkCache WholeChunkCache
+
+type memoryWholeChunkCache struct {
+	cache *chunk_cache.ChunkCacheInMemory
+}
+
+// NewMemoryWholeChunkCache keeps up to maxEntries chunks in memory, evicting the least recently used
+func NewMemoryWholeChunkCache(maxEntries int64) WholeChunkCache {
+	return &memoryWholeChunkCache{cache: chunk_cache.NewChunkCacheInMemory(maxEntries)}
+}
+
+func (c *memoryWholeChunkCache) Get(fileId string) ([]byte, bool) {
+	data := c.cache.GetChunk(fileId)
+	return data, data != nil
+}
+
+func (c *memoryWholeChunkCache) Set(fileId string, data []byte) {
+	c.cache.SetChunk(fileId, data)
+}
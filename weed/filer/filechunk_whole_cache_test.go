@@ -0,0 +1,42 @@
+package filer
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestFetchedChunkCache(t *testing.T) {
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{{FileId: "1,02", Offset: 0, Size: 10}},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{"1,01": string(data)})
+	defer closeFn()
+	var lookups int32
+	lookupFn := func(fileId string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		return lookup(fileId)
+	}
+
+	FetchedChunkCache = NewMemoryWholeChunkCache(16)
+	defer func() {
+		FetchedChunkCache = nil
+	}()
+
+	chunks := []*filer_pb.FileChunk{{FileId: "1,01", Offset: 0, Size: 10, IsChunkManifest: true}}
+	for i := 0; i < 3; i++ {
+		dataChunks, _, err := ResolveChunkManifest(lookupFn, chunks, 0, math.MaxInt64)
+		assert.NoError(t, err)
+		if assert.Equal(t, 1, len(dataChunks)) {
+			assert.Equal(t, "1,02", dataChunks[0].GetFileIdString())
+		}
+	}
+	// only the first resolution went to the volume server
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lookups))
+}
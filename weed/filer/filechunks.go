@@ -100,11 +100,11 @@ func FindGarbageChunks(visibles *IntervalList[*VisibleInterval], start int64, st
 
 func MinusChunks(lookupFileIdFn wdclient.LookupFileIdFunctionType, as, bs []*filer_pb.FileChunk) (delta []*filer_pb.FileChunk, err error) {
 
-	aData, aMeta, aErr := ResolveChunkManifest(lookupFileIdFn, as, 0, math.MaxInt64)
+	aData, aMeta, aErr := ResolveChunkManifestAll(lookupFileIdFn, as)
 	if aErr != nil {
 		return nil, aErr
 	}
-	bData, bMeta, bErr := ResolveChunkManifest(lookupFileIdFn, bs, 0, math.MaxInt64)
+	bData, bMeta, bErr := ResolveChunkManifestAll(lookupFileIdFn, bs)
 	if bErr != nil {
 		return nil, bErr
 	}
@@ -148,14 +148,16 @@ func DoMinusChunksBySourceFileId(as, bs []*filer_pb.FileChunk) (delta []*filer_p
 }
 
 type ChunkView struct {
-	FileId        string
-	OffsetInChunk int64 // offset within the chunk
-	ViewSize      uint64
-	ViewOffset    int64 // actual offset in the file, for the data specified via [offset, offset+size) in current chunk
-	ChunkSize     uint64
-	CipherKey     []byte
-	IsGzipped     bool
-	ModifiedTsNs  int64
+	FileId            string
+	OffsetInChunk     int64 // offset within the chunk
+	ViewSize          uint64
+	ViewOffset        int64 // actual offset in the file, for the data specified via [offset, offset+size) in current chunk
+	ChunkSize         uint64
+	CipherKey         []byte
+	IsGzipped         bool
+	ModifiedTsNs      int64
+	ChecksumAlgorithm string
+	Checksum          []byte
 }
 
 func (cv *ChunkView) SetStartStop(start, stop int64) {
@@ -165,14 +167,16 @@ func (cv *ChunkView) SetStartStop(start, stop int64) {
 }
 func (cv *ChunkView) Clone() IntervalValue {
 	return &ChunkView{
-		FileId:        cv.FileId,
-		OffsetInChunk: cv.OffsetInChunk,
-		ViewSize:      cv.ViewSize,
-		ViewOffset:    cv.ViewOffset,
-		ChunkSize:     cv.ChunkSize,
-		CipherKey:     cv.CipherKey,
-		IsGzipped:     cv.IsGzipped,
-		ModifiedTsNs:  cv.ModifiedTsNs,
+		FileId:            cv.FileId,
+		OffsetInChunk:     cv.OffsetInChunk,
+		ViewSize:          cv.ViewSize,
+		ViewOffset:        cv.ViewOffset,
+		ChunkSize:         cv.ChunkSize,
+		CipherKey:         cv.CipherKey,
+		IsGzipped:         cv.IsGzipped,
+		ModifiedTsNs:      cv.ModifiedTsNs,
+		ChecksumAlgorithm: cv.ChecksumAlgorithm,
+		Checksum:          cv.Checksum,
 	}
 }
 
@@ -188,6 +192,16 @@ func ViewFromChunks(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*
 
 }
 
+// ViewFromResolvedChunks is ViewFromChunks for chunks without any chunk manifest,
+// e.g. the output of ExportResolvedManifest.
+func ViewFromResolvedChunks(resolvedChunks []*filer_pb.FileChunk, offset int64, size int64) (chunkViews *IntervalList[*ChunkView]) {
+
+	visibles := readResolvedChunks(resolvedChunks, 0, math.MaxInt64)
+
+	return ViewFromVisibleIntervals(visibles, offset, size)
+
+}
+
 func ViewFromVisibleIntervals(visibles *IntervalList[*VisibleInterval], offset int64, size int64) (chunkViews *IntervalList[*ChunkView]) {
 
 	stop := offset + size
@@ -206,14 +220,16 @@ func ViewFromVisibleIntervals(visibles *IntervalList[*VisibleInterval], offset i
 
 		if chunkStart < chunkStop {
 			chunkView := &ChunkView{
-				FileId:        chunk.fileId,
-				OffsetInChunk: chunkStart - chunk.start + chunk.offsetInChunk,
-				ViewSize:      uint64(chunkStop - chunkStart),
-				ViewOffset:    chunkStart,
-				ChunkSize:     chunk.chunkSize,
-				CipherKey:     chunk.cipherKey,
-				IsGzipped:     chunk.isGzipped,
-				ModifiedTsNs:  chunk.modifiedTsNs,
+				FileId:            chunk.fileId,
+				OffsetInChunk:     chunkStart - chunk.start + chunk.offsetInChunk,
+				ViewSize:          uint64(chunkStop - chunkStart),
+				ViewOffset:        chunkStart,
+				ChunkSize:         chunk.chunkSize,
+				CipherKey:         chunk.cipherKey,
+				IsGzipped:         chunk.isGzipped,
+				ModifiedTsNs:      chunk.modifiedTsNs,
+				ChecksumAlgorithm: chunk.checksumAlgorithm,
+				Checksum:          chunk.checksum,
 			}
 			chunkViews.AppendInterval(&Interval[*ChunkView]{
 				StartOffset: chunkStart,
@@ -231,35 +247,49 @@ func ViewFromVisibleIntervals(visibles *IntervalList[*VisibleInterval], offset i
 }
 
 func MergeIntoVisibles(visibles *IntervalList[*VisibleInterval], start int64, stop int64, chunk *filer_pb.FileChunk) {
+	mergeIntoVisibles(visibles, start, stop, chunk, chunk.ModifiedTsNs)
+}
+
+// mergeIntoVisibles overlays the chunk on the intervals of a lower order
+func mergeIntoVisibles(visibles *IntervalList[*VisibleInterval], start int64, stop int64, chunk *filer_pb.FileChunk, order int64) {
 
 	newV := &VisibleInterval{
-		start:         start,
-		stop:          stop,
-		fileId:        chunk.GetFileIdString(),
-		modifiedTsNs:  chunk.ModifiedTsNs,
-		offsetInChunk: start - chunk.Offset, // the starting position in the chunk
-		chunkSize:     chunk.Size,           // size of the chunk
-		cipherKey:     chunk.CipherKey,
-		isGzipped:     chunk.IsCompressed,
+		start:             start,
+		stop:              stop,
+		fileId:            chunk.GetFileIdString(),
+		modifiedTsNs:      chunk.ModifiedTsNs,
+		offsetInChunk:     start - chunk.Offset, // the starting position in the chunk
+		chunkSize:         chunk.Size,           // size of the chunk
+		cipherKey:         chunk.CipherKey,
+		isGzipped:         chunk.IsCompressed,
+		checksumAlgorithm: chunk.ChecksumAlgorithm,
+		checksum:          chunk.Checksum,
 	}
 
-	visibles.InsertInterval(start, stop, chunk.ModifiedTsNs, newV)
+	visibles.InsertInterval(start, stop, order, newV)
 }
 
 func MergeIntoChunkViews(chunkViews *IntervalList[*ChunkView], start int64, stop int64, chunk *filer_pb.FileChunk) {
+	mergeIntoChunkViews(chunkViews, start, stop, chunk, chunk.ModifiedTsNs)
+}
+
+// mergeIntoChunkViews overlays the chunk on the views of a lower order
+func mergeIntoChunkViews(chunkViews *IntervalList[*ChunkView], start int64, stop int64, chunk *filer_pb.FileChunk, order int64) {
 
 	chunkView := &ChunkView{
-		FileId:        chunk.GetFileIdString(),
-		OffsetInChunk: start - chunk.Offset,
-		ViewSize:      uint64(stop - start),
-		ViewOffset:    start,
-		ChunkSize:     chunk.Size,
-		CipherKey:     chunk.CipherKey,
-		IsGzipped:     chunk.IsCompressed,
-		ModifiedTsNs:  chunk.ModifiedTsNs,
+		FileId:            chunk.GetFileIdString(),
+		OffsetInChunk:     start - chunk.Offset,
+		ViewSize:          uint64(stop - start),
+		ViewOffset:        start,
+		ChunkSize:         chunk.Size,
+		CipherKey:         chunk.CipherKey,
+		IsGzipped:         chunk.IsCompressed,
+		ModifiedTsNs:      chunk.ModifiedTsNs,
+		ChecksumAlgorithm: chunk.ChecksumAlgorithm,
+		Checksum:          chunk.Checksum,
 	}
 
-	chunkViews.InsertInterval(start, stop, chunk.ModifiedTsNs, chunkView)
+	chunkViews.InsertInterval(start, stop, order, chunkView)
 }
 
 // NonOverlappingVisibleIntervals translates the file chunk into VisibleInterval in memory
@@ -280,14 +310,16 @@ func NonOverlappingVisibleIntervals(lookupFileIdFn wdclient.LookupFileIdFunction
 // visible interval map to one file chunk
 
 type VisibleInterval struct {
-	start         int64
-	stop          int64
-	modifiedTsNs  int64
-	fileId        string
-	offsetInChunk int64
-	chunkSize     uint64
-	cipherKey     []byte
-	isGzipped     bool
+	start             int64
+	stop              int64
+	modifiedTsNs      int64
+	fileId            string
+	offsetInChunk     int64
+	chunkSize         uint64
+	cipherKey         []byte
+	isGzipped         bool
+	checksumAlgorithm string
+	checksum          []byte
 }
 
 func (v *VisibleInterval) SetStartStop(start, stop int64) {
@@ -296,14 +328,16 @@ func (v *VisibleInterval) SetStartStop(start, stop int64) {
 }
 func (v *VisibleInterval) Clone() IntervalValue {
 	return &VisibleInterval{
-		start:         v.start,
-		stop:          v.stop,
-		modifiedTsNs:  v.modifiedTsNs,
-		fileId:        v.fileId,
-		offsetInChunk: v.offsetInChunk,
-		chunkSize:     v.chunkSize,
-		cipherKey:     v.cipherKey,
-		isGzipped:     v.isGzipped,
+		start:             v.start,
+		stop:              v.stop,
+		modifiedTsNs:      v.modifiedTsNs,
+		fileId:            v.fileId,
+		offsetInChunk:     v.offsetInChunk,
+		chunkSize:         v.chunkSize,
+		cipherKey:         v.cipherKey,
+		isGzipped:         v.isGzipped,
+		checksumAlgorithm: v.checksumAlgorithm,
+		checksum:          v.checksum,
 	}
 }
 
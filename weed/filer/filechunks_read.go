@@ -9,6 +9,7 @@ import (
 func readResolvedChunks(chunks []*filer_pb.FileChunk, startOffset int64, stopOffset int64) (visibles *IntervalList[*VisibleInterval]) {
 
 	var points []*Point
+	orders := chunkOrders(chunks)
 	for _, chunk := range chunks {
 		if chunk.IsChunkManifest {
 			println("This should not happen! A manifest chunk found:", chunk.GetFileIdString())
@@ -19,13 +20,13 @@ func readResolvedChunks(chunks []*filer_pb.FileChunk, startOffset int64, stopOff
 		}
 		points = append(points, &Point{
 			x:       chunk.Offset,
-			ts:      chunk.ModifiedTsNs,
+			ts:      orders[chunk],
 			chunk:   chunk,
 			isStart: true,
 		})
 		points = append(points, &Point{
 			x:       chunk.Offset + int64(chunk.Size),
-			ts:      chunk.ModifiedTsNs,
+			ts:      orders[chunk],
 			chunk:   chunk,
 			isStart: false,
 		})
@@ -92,14 +93,16 @@ func addToVisibles(visibles *IntervalList[*VisibleInterval], prevX int64, startP
 	if prevX < point.x {
 		chunk := startPoint.chunk
 		visible := &VisibleInterval{
-			start:         prevX,
-			stop:          point.x,
-			fileId:        chunk.GetFileIdString(),
-			modifiedTsNs:  chunk.ModifiedTsNs,
-			offsetInChunk: prevX - chunk.Offset,
-			chunkSize:     chunk.Size,
-			cipherKey:     chunk.CipherKey,
-			isGzipped:     chunk.IsCompressed,
+			start:             prevX,
+			stop:              point.x,
+			fileId:            chunk.GetFileIdString(),
+			modifiedTsNs:      chunk.ModifiedTsNs,
+			offsetInChunk:     prevX - chunk.Offset,
+			chunkSize:         chunk.Size,
+			cipherKey:         chunk.CipherKey,
+			isGzipped:         chunk.IsCompressed,
+			checksumAlgorithm: chunk.ChecksumAlgorithm,
+			checksum:          chunk.Checksum,
 		}
 		appendVisibleInterfal(visibles, visible)
 	}
@@ -169,6 +169,9 @@ func mergePathConf(a, b *filer_pb.FilerConf_PathConf) {
 	a.DataCenter = util.Nvl(b.DataCenter, a.DataCenter)
 	a.Rack = util.Nvl(b.Rack, a.Rack)
 	a.DataNode = util.Nvl(b.DataNode, a.DataNode)
+	if b.ReadQuorum > 0 {
+		a.ReadQuorum = b.ReadQuorum
+	}
 }
 
 func (fc *FilerConf) ToProto() *filer_pb.FilerConf {
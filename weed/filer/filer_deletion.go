@@ -2,7 +2,6 @@ package filer
 
 import (
 	"github.com/seaweedfs/seaweedfs/weed/storage"
-	"math"
 	"strings"
 	"time"
 
@@ -96,6 +95,8 @@ func (f *Filer) doDeleteFileIds(fileIds []string) {
 
 func (f *Filer) DirectDeleteChunks(chunks []*filer_pb.FileChunk) {
 	var fileIdsToDelete []string
+	var gcStats ManifestMaintenanceStats
+	start := time.Now()
 	for _, chunk := range chunks {
 		if !chunk.IsChunkManifest {
 			fileIdsToDelete = append(fileIdsToDelete, chunk.GetFileIdString())
@@ -109,12 +110,19 @@ func (f *Filer) DirectDeleteChunks(chunks []*filer_pb.FileChunk) {
 			fileIdsToDelete = append(fileIdsToDelete, dChunk.GetFileIdString())
 		}
 		fileIdsToDelete = append(fileIdsToDelete, chunk.GetFileIdString())
+		gcStats.ManifestsDeleted++
+		gcStats.ChunksDeleted += len(dataChunks)
 	}
 
 	f.doDeleteFileIds(fileIdsToDelete)
+	if gcStats.ManifestsDeleted > 0 {
+		gcStats.Report(ManifestOpGC, start)
+	}
 }
 
 func (f *Filer) DeleteChunks(chunks []*filer_pb.FileChunk) {
+	var gcStats ManifestMaintenanceStats
+	start := time.Now()
 	for _, chunk := range chunks {
 		if !chunk.IsChunkManifest {
 			f.fileIdDeletionQueue.EnQueue(chunk.GetFileIdString())
@@ -128,6 +136,11 @@ func (f *Filer) DeleteChunks(chunks []*filer_pb.FileChunk) {
 			f.fileIdDeletionQueue.EnQueue(dChunk.GetFileIdString())
 		}
 		f.fileIdDeletionQueue.EnQueue(chunk.GetFileIdString())
+		gcStats.ManifestsDeleted++
+		gcStats.ChunksDeleted += len(dataChunks)
+	}
+	if gcStats.ManifestsDeleted > 0 {
+		gcStats.Report(ManifestOpGC, start)
 	}
 }
 
@@ -147,10 +160,11 @@ func (f *Filer) deleteChunksIfNotNew(oldEntry, newEntry *Entry) {
 		return
 	}
 
+	start := time.Now()
 	var toDelete []*filer_pb.FileChunk
 	newChunkIds := make(map[string]bool)
-	newDataChunks, newManifestChunks, err := ResolveChunkManifest(f.MasterClient.GetLookupFileIdFunction(),
-		newEntry.GetChunks(), 0, math.MaxInt64)
+	newDataChunks, newManifestChunks, err := ResolveChunkManifestAll(f.MasterClient.GetLookupFileIdFunction(),
+		newEntry.GetChunks())
 	if err != nil {
 		glog.Errorf("Failed to resolve new entry chunks when delete old entry chunks. new: %s, old: %s",
 			newEntry.GetChunks(), oldEntry.Chunks)
@@ -163,8 +177,8 @@ func (f *Filer) deleteChunksIfNotNew(oldEntry, newEntry *Entry) {
 		newChunkIds[newChunk.GetFileIdString()] = true
 	}
 
-	oldDataChunks, oldManifestChunks, err := ResolveChunkManifest(f.MasterClient.GetLookupFileIdFunction(),
-		oldEntry.GetChunks(), 0, math.MaxInt64)
+	oldDataChunks, oldManifestChunks, err := ResolveChunkManifestAll(f.MasterClient.GetLookupFileIdFunction(),
+		oldEntry.GetChunks())
 	if err != nil {
 		glog.Errorf("Failed to resolve old entry chunks when delete old entry chunks. new: %s, old: %s",
 			newEntry.GetChunks(), oldEntry.GetChunks())
@@ -175,10 +189,16 @@ func (f *Filer) deleteChunksIfNotNew(oldEntry, newEntry *Entry) {
 			toDelete = append(toDelete, oldChunk)
 		}
 	}
+	var gcStats ManifestMaintenanceStats
 	for _, oldChunk := range oldManifestChunks {
 		if _, found := newChunkIds[oldChunk.GetFileIdString()]; !found {
 			toDelete = append(toDelete, oldChunk)
+			gcStats.ManifestsDeleted++
 		}
 	}
 	f.DeleteChunksNotRecursive(toDelete)
+	if gcStats.ManifestsDeleted > 0 {
+		gcStats.ChunksDeleted = len(toDelete) - gcStats.ManifestsDeleted
+		gcStats.Report(ManifestOpGC, start)
+	}
 }
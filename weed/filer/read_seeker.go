@@ -0,0 +1,95 @@
+package filer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// ManifestReadSeeker reads a file of chunks, including chunk manifests, as an io.ReadSeeker.
+// Seek only moves the position. The manifests are resolved on the first Read, and each Read
+// fetches only the range it returns. Holes between chunks read as zeros.
+type ManifestReadSeeker struct {
+	lookupFileIdFn wdclient.LookupFileIdFunctionType
+	chunks         []*filer_pb.FileChunk
+	fileSize       int64
+	position       int64
+	chunkViews     *IntervalList[*ChunkView]
+	readFlow       *ReadFlow
+}
+
+var _ = io.ReadSeeker(&ManifestReadSeeker{})
+
+func NewManifestReadSeeker(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, fileSize int64) *ManifestReadSeeker {
+	return &ManifestReadSeeker{
+		lookupFileIdFn: lookupFileIdFn,
+		chunks:         chunks,
+		fileSize:       fileSize,
+		readFlow:       NewReadFlow(ReadSourceStream),
+	}
+}
+
+func (r *ManifestReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.position
+	case io.SeekEnd:
+		offset += r.fileSize
+	default:
+		return r.position, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return r.position, errors.New("negative position")
+	}
+	r.position = offset
+	return offset, nil
+}
+
+// Read returns the data of at most one chunk or hole per call.
+func (r *ManifestReadSeeker) Read(p []byte) (n int, err error) {
+	if r.position >= r.fileSize {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if remaining := r.fileSize - r.position; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	if r.chunkViews == nil {
+		visibles, resolveErr := NonOverlappingVisibleIntervals(r.lookupFileIdFn, r.chunks, 0, r.fileSize)
+		if resolveErr != nil {
+			return 0, resolveErr
+		}
+		r.chunkViews = ViewFromVisibleIntervals(visibles, 0, r.fileSize)
+	}
+
+	stop := r.position + int64(len(p))
+	for x := r.chunkViews.Front(); x != nil; x = x.Next {
+		chunkView := x.Value
+		viewStop := chunkView.ViewOffset + int64(chunkView.ViewSize)
+		if viewStop <= r.position {
+			continue
+		}
+		if r.position < chunkView.ViewOffset {
+			// in a hole before the next chunk
+			stop = min(stop, chunkView.ViewOffset)
+			break
+		}
+		stop = min(stop, viewStop)
+		n, err = fetchChunkViewRange(p[:stop-r.position], r.lookupFileIdFn, chunkView, chunkView.OffsetInChunk+r.position-chunkView.ViewOffset, r.readFlow)
+		r.position += int64(n)
+		return n, err
+	}
+
+	n = int(stop - r.position)
+	for i := range p[:n] {
+		p[i] = 0
+	}
+	r.position = stop
+	return n, nil
+}
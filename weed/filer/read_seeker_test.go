@@ -0,0 +1,67 @@
+package filer
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestManifestReadSeeker(t *testing.T) {
+	manifest, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,01", Offset: 0, Size: 4, ModifiedTsNs: 1},
+			{FileId: "1,02", Offset: 4, Size: 4, ModifiedTsNs: 2},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": "aaaa",
+		"1,02": "bbbb",
+		"1,03": "cccc",
+		"1,10": string(manifest),
+	})
+	defer closeFn()
+
+	var lookups int
+	countingLookup := func(fileId string) ([]string, error) {
+		lookups++
+		return lookup(fileId)
+	}
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,10", Offset: 0, Size: 8, ModifiedTsNs: 2, IsChunkManifest: true},
+		{FileId: "1,03", Offset: 10, Size: 4, ModifiedTsNs: 3},
+	}
+	r := NewManifestReadSeeker(countingLookup, chunks, 16)
+
+	// seeking does not fetch anything
+	pos, err := r.Seek(-4, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), pos)
+	pos, err = r.Seek(-9, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), pos)
+	assert.Equal(t, 0, lookups)
+
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "abbbb\x00\x00cccc\x00\x00", string(data))
+
+	_, err = r.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	data, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "aaaabbbb\x00\x00cccc\x00\x00", string(data))
+
+	_, err = r.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+	pos, err = r.Seek(100, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), pos)
+	n, err := r.Read(make([]byte, 4))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+}
@@ -6,6 +6,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/seaweedfs/seaweedfs/weed/stats"
 	"github.com/seaweedfs/seaweedfs/weed/util/chunk_cache"
 	"github.com/seaweedfs/seaweedfs/weed/util/mem"
 	"github.com/seaweedfs/seaweedfs/weed/wdclient"
@@ -17,21 +18,27 @@ type ReaderCache struct {
 	sync.Mutex
 	downloaders map[string]*SingleChunkCacher
 	limit       int
+	readFlow    *ReadFlow
+	// recent ratio of prefetched chunks that were read, which scales the read-ahead window
+	prefetchHitRatio float64
 }
 
 type SingleChunkCacher struct {
 	sync.Mutex
-	parent           *ReaderCache
-	chunkFileId      string
-	data             []byte
-	err              error
-	cipherKey        []byte
-	isGzipped        bool
-	chunkSize        int
-	shouldCache      bool
-	wg               sync.WaitGroup
-	cacheStartedCh   chan struct{}
-	completedTimeNew int64
+	parent            *ReaderCache
+	chunkFileId       string
+	data              []byte
+	err               error
+	cipherKey         []byte
+	isGzipped         bool
+	chunkSize         int
+	checksumAlgorithm string
+	checksum          []byte
+	shouldCache       bool
+	wg                sync.WaitGroup
+	cacheStartedCh    chan struct{}
+	completedTimeNew  int64
+	prefetched        bool // started by MaybeCache and not read yet
 }
 
 func NewReaderCache(limit int, chunkCache chunk_cache.ChunkCache, lookupFileIdFn wdclient.LookupFileIdFunctionType) *ReaderCache {
@@ -40,9 +47,38 @@ func NewReaderCache(limit int, chunkCache chunk_cache.ChunkCache, lookupFileIdFn
 		chunkCache:     chunkCache,
 		lookupFileIdFn: lookupFileIdFn,
 		downloaders:    make(map[string]*SingleChunkCacher),
+		readFlow:       NewReadFlow(ReadSourceCache),
+		// start by reading ahead as far as the limit allows
+		prefetchHitRatio: 1,
 	}
 }
 
+// prefetchWindow is the number of chunks to read ahead. It shrinks towards 1 when prefetched chunks
+// are wasted, e.g. for random reads, and grows back to the limit when they are read.
+func (rc *ReaderCache) prefetchWindow() int {
+	window := int(rc.prefetchHitRatio*float64(rc.limit) + 0.5)
+	if window < 1 {
+		return 1
+	}
+	return window
+}
+
+// recordPrefetch updates the hit ratio with the outcome of one prefetched chunk, must be called with the lock held
+func (rc *ReaderCache) recordPrefetch(cacher *SingleChunkCacher, hit bool) {
+	if !cacher.prefetched {
+		return
+	}
+	cacher.prefetched = false
+	outcome := 0.0
+	if hit {
+		outcome = 1
+		stats.FilerPrefetchCounter.WithLabelValues(stats.PrefetchHit).Inc()
+	} else {
+		stats.FilerPrefetchCounter.WithLabelValues(stats.PrefetchWasted).Inc()
+	}
+	rc.prefetchHitRatio = 0.75*rc.prefetchHitRatio + 0.25*outcome
+}
+
 func (rc *ReaderCache) MaybeCache(chunkViews *Interval[*ChunkView]) {
 	if rc.lookupFileIdFn == nil {
 		return
@@ -55,33 +91,46 @@ func (rc *ReaderCache) MaybeCache(chunkViews *Interval[*ChunkView]) {
 		return
 	}
 
+	window := rc.prefetchWindow()
+	stats.FilerPrefetchWindowHistogram.Observe(float64(window))
+	pending := 0
+	for _, downloader := range rc.downloaders {
+		if downloader.prefetched {
+			pending++
+		}
+	}
+
 	for x := chunkViews; x != nil; x = x.Next {
 		chunkView := x.Value
 		if _, found := rc.downloaders[chunkView.FileId]; found {
 			continue
 		}
 
-		if len(rc.downloaders) >= rc.limit {
+		if len(rc.downloaders) >= rc.limit || pending >= window {
 			// abort when slots are filled
 			return
 		}
 
 		// glog.V(4).Infof("prefetch %s offset %d", chunkView.FileId, chunkView.ViewOffset)
 		// cache this chunk if not yet
-		cacher := newSingleChunkCacher(rc, chunkView.FileId, chunkView.CipherKey, chunkView.IsGzipped, int(chunkView.ChunkSize), false)
+		cacher := newSingleChunkCacher(rc, chunkView, false)
+		cacher.prefetched = true
 		go cacher.startCaching()
 		<-cacher.cacheStartedCh
 		rc.downloaders[chunkView.FileId] = cacher
+		pending++
 
 	}
 
 	return
 }
 
-func (rc *ReaderCache) ReadChunkAt(buffer []byte, fileId string, cipherKey []byte, isGzipped bool, offset int64, chunkSize int, shouldCache bool) (int, error) {
+func (rc *ReaderCache) ReadChunkAt(buffer []byte, chunkView *ChunkView, offset int64, shouldCache bool) (int, error) {
+	fileId := chunkView.FileId
 	rc.Lock()
 
 	if cacher, found := rc.downloaders[fileId]; found {
+		rc.recordPrefetch(cacher, true)
 		if n, err := cacher.readChunkAt(buffer, offset); n != 0 && err == nil {
 			rc.Unlock()
 			return n, err
@@ -107,13 +156,14 @@ func (rc *ReaderCache) ReadChunkAt(buffer []byte, fileId string, cipherKey []byt
 		if oldestFid != "" {
 			oldDownloader := rc.downloaders[oldestFid]
 			delete(rc.downloaders, oldestFid)
+			rc.recordPrefetch(oldDownloader, false)
 			oldDownloader.destroy()
 		}
 	}
 
 	// glog.V(4).Infof("cache1 %s", fileId)
 
-	cacher := newSingleChunkCacher(rc, fileId, cipherKey, isGzipped, chunkSize, shouldCache)
+	cacher := newSingleChunkCacher(rc, chunkView, shouldCache)
 	go cacher.startCaching()
 	<-cacher.cacheStartedCh
 	rc.downloaders[fileId] = cacher
@@ -127,6 +177,7 @@ func (rc *ReaderCache) UnCache(fileId string) {
 	defer rc.Unlock()
 	// glog.V(4).Infof("uncache %s", fileId)
 	if downloader, found := rc.downloaders[fileId]; found {
+		rc.recordPrefetch(downloader, false)
 		downloader.destroy()
 		delete(rc.downloaders, fileId)
 	}
@@ -142,15 +193,17 @@ func (rc *ReaderCache) destroy() {
 
 }
 
-func newSingleChunkCacher(parent *ReaderCache, fileId string, cipherKey []byte, isGzipped bool, chunkSize int, shouldCache bool) *SingleChunkCacher {
+func newSingleChunkCacher(parent *ReaderCache, chunkView *ChunkView, shouldCache bool) *SingleChunkCacher {
 	return &SingleChunkCacher{
-		parent:         parent,
-		chunkFileId:    fileId,
-		cipherKey:      cipherKey,
-		isGzipped:      isGzipped,
-		chunkSize:      chunkSize,
-		shouldCache:    shouldCache,
-		cacheStartedCh: make(chan struct{}),
+		parent:            parent,
+		chunkFileId:       chunkView.FileId,
+		cipherKey:         chunkView.CipherKey,
+		isGzipped:         chunkView.IsGzipped,
+		chunkSize:         int(chunkView.ChunkSize),
+		checksumAlgorithm: chunkView.ChecksumAlgorithm,
+		checksum:          chunkView.Checksum,
+		shouldCache:       shouldCache,
+		cacheStartedCh:    make(chan struct{}),
 	}
 }
 
@@ -162,19 +215,26 @@ func (s *SingleChunkCacher) startCaching() {
 
 	s.cacheStartedCh <- struct{}{} // means this has been started
 
-	urlStrings, err := s.parent.lookupFileIdFn(s.chunkFileId)
-	if err != nil {
-		s.err = fmt.Errorf("operation LookupFileId %s failed, err: %v", s.chunkFileId, err)
-		return
-	}
-
 	s.data = mem.Allocate(s.chunkSize)
+	if n, _ := LocalChunkCache.ReadChunkAt(s.data, s.chunkFileId, 0); n != s.chunkSize {
+		urlStrings, err := s.parent.lookupFileIdFn(s.chunkFileId)
+		if err != nil {
+			s.err = fmt.Errorf("operation LookupFileId %s failed, err: %v", s.chunkFileId, err)
+			mem.Free(s.data)
+			s.data = nil
+			return
+		}
 
-	_, s.err = retriedFetchChunkData(s.data, urlStrings, s.cipherKey, s.isGzipped, true, 0)
-	if s.err != nil {
-		mem.Free(s.data)
-		s.data = nil
-		return
+		_, s.err = retriedFetchChunkData(s.data, urlStrings, s.cipherKey, s.isGzipped, true, 0, s.parent.readFlow)
+		if s.err == nil {
+			s.err = VerifyChunkChecksum(s.chunkFileId, s.checksumAlgorithm, s.checksum, s.data)
+		}
+		if s.err != nil {
+			mem.Free(s.data)
+			s.data = nil
+			return
+		}
+		LocalChunkCache.SetChunk(s.chunkFileId, s.data)
 	}
 
 	if s.shouldCache {
@@ -0,0 +1,35 @@
+package filer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderCachePrefetchWindow(t *testing.T) {
+	rc := NewReaderCache(8, nil, nil)
+	assert.Equal(t, 8, rc.prefetchWindow())
+
+	// wasted prefetches shrink the window, down to 1
+	for i := 0; i < 20; i++ {
+		rc.recordPrefetch(&SingleChunkCacher{prefetched: true}, false)
+	}
+	assert.Equal(t, 1, rc.prefetchWindow())
+
+	// chunks read on demand do not count
+	rc.recordPrefetch(&SingleChunkCacher{}, true)
+	assert.Equal(t, 1, rc.prefetchWindow())
+
+	// a prefetched chunk counts only once
+	cacher := &SingleChunkCacher{prefetched: true}
+	rc.recordPrefetch(cacher, true)
+	ratio := rc.prefetchHitRatio
+	rc.recordPrefetch(cacher, false)
+	assert.Equal(t, ratio, rc.prefetchHitRatio)
+
+	// hits grow the window back to the limit
+	for i := 0; i < 20; i++ {
+		rc.recordPrefetch(&SingleChunkCacher{prefetched: true}, true)
+	}
+	assert.Equal(t, 8, rc.prefetchWindow())
+}
@@ -2,6 +2,7 @@ package filer
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"golang.org/x/exp/slices"
 	"io"
@@ -70,10 +71,79 @@ func StreamContent(masterClient wdclient.HasLookupFileIdFunction, writer io.Writ
 	return StreamContentWithThrottler(masterClient, writer, chunks, offset, size, 0)
 }
 
+// MissingChunkError reports the range of a file whose data chunk is not found on any volume server,
+// e.g. a chunk referenced by a manifest that has been garbage collected.
+type MissingChunkError struct {
+	FileId string
+	Offset int64 // offset in the file
+	Size   uint64
+	Err    error
+}
+
+func (e *MissingChunkError) Error() string {
+	return fmt.Sprintf("chunk %s for [%d,%d) is missing: %v", e.FileId, e.Offset, e.Offset+int64(e.Size), e.Err)
+}
+
+func (e *MissingChunkError) Unwrap() error {
+	return e.Err
+}
+
 func StreamContentWithThrottler(masterClient wdclient.HasLookupFileIdFunction, writer io.Writer, chunks []*filer_pb.FileChunk, offset int64, size int64, downloadMaxBytesPs int64) error {
+	glog.V(4).Infof("start to stream content for chunks: %d", len(chunks))
+	chunkViews := ViewFromChunks(masterClient.GetLookupFileIdFunction(), chunks, offset, size)
+	_, err := doStreamContent(context.Background(), masterClient, writer, chunkViews, offset, size, downloadMaxBytesPs, false, 1, NewReadFlow(ReadSourceStream))
+	return err
+}
 
+// StreamContentWithQuorum streams the content like StreamContentWithThrottler, but only returns data
+// that at least readQuorum replicas of each chunk agree on. The read stops once the context is done.
+func StreamContentWithQuorum(ctx context.Context, masterClient wdclient.HasLookupFileIdFunction, writer io.Writer, chunks []*filer_pb.FileChunk, offset int64, size int64, downloadMaxBytesPs int64, readQuorum int) error {
 	glog.V(4).Infof("start to stream content for chunks: %d", len(chunks))
 	chunkViews := ViewFromChunks(masterClient.GetLookupFileIdFunction(), chunks, offset, size)
+	_, err := doStreamContent(ctx, masterClient, writer, chunkViews, offset, size, downloadMaxBytesPs, false, readQuorum, NewReadFlow(ReadSourceStream))
+	return err
+}
+
+// StreamResolvedContent streams the content of a flat chunk list from ExportResolvedManifest,
+// without fetching any chunk manifest.
+func StreamResolvedContent(masterClient wdclient.HasLookupFileIdFunction, writer io.Writer, resolvedChunks []*filer_pb.FileChunk, offset int64, size int64) error {
+	if HasChunkManifest(resolvedChunks) {
+		return fmt.Errorf("resolved chunks should not contain chunk manifests")
+	}
+	chunkViews := ViewFromResolvedChunks(resolvedChunks, offset, size)
+	_, err := doStreamContent(context.Background(), masterClient, writer, chunkViews, offset, size, 0, false, 1, NewReadFlow(ReadSourceStream))
+	return err
+}
+
+// StreamFileContent streams the whole content of the chunks, from offset 0 to the end of the last chunk.
+// The manifests are resolved, the newest chunk wins where chunks overlap, and the gaps are written as zeros.
+func StreamFileContent(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk, writer io.Writer) error {
+	size := int64(TotalSize(chunks))
+	visibles, err := NonOverlappingVisibleIntervals(lookupFileIdFn, chunks, 0, size)
+	if err != nil {
+		return err
+	}
+	chunkViews := ViewFromVisibleIntervals(visibles, 0, size)
+	_, err = doStreamContent(context.Background(), lookupFileIdFunction(lookupFileIdFn), writer, chunkViews, 0, size, 0, false, 1, NewReadFlow(ReadSourceStream))
+	return err
+}
+
+// lookupFileIdFunction adapts a lookup function for the streaming functions expecting a master client
+type lookupFileIdFunction wdclient.LookupFileIdFunctionType
+
+func (fn lookupFileIdFunction) GetLookupFileIdFunction() wdclient.LookupFileIdFunctionType {
+	return wdclient.LookupFileIdFunctionType(fn)
+}
+
+// StreamContentBestEffort streams the content like StreamContent, but fills the ranges of missing chunks
+// with zeros instead of failing, and reports the missing ranges.
+func StreamContentBestEffort(masterClient wdclient.HasLookupFileIdFunction, writer io.Writer, chunks []*filer_pb.FileChunk, offset int64, size int64) (missing []*MissingChunkError, err error) {
+	glog.V(4).Infof("start to stream content for chunks: %d", len(chunks))
+	chunkViews := ViewFromChunks(masterClient.GetLookupFileIdFunction(), chunks, offset, size)
+	return doStreamContent(context.Background(), masterClient, writer, chunkViews, offset, size, 0, true, 1, NewReadFlow(ReadSourceStream))
+}
+
+func doStreamContent(ctx context.Context, masterClient wdclient.HasLookupFileIdFunction, writer io.Writer, chunkViews *IntervalList[*ChunkView], offset int64, size int64, downloadMaxBytesPs int64, bestEffort bool, readQuorum int, readFlow *ReadFlow) (missing []*MissingChunkError, err error) {
 
 	fileId2Url := make(map[string][]string)
 
@@ -83,59 +153,111 @@ func StreamContentWithThrottler(masterClient wdclient.HasLookupFileIdFunction, w
 		var err error
 		for _, backoff := range getLookupFileIdBackoffSchedule {
 			urlStrings, err = masterClient.GetLookupFileIdFunction()(chunkView.FileId)
-			if err == nil && len(urlStrings) > 0 {
+			if err == nil && len(urlStrings) > 0 || IsFailFast(ctx) {
 				break
 			}
 			glog.V(4).Infof("waiting for chunk: %s", chunkView.FileId)
-			time.Sleep(backoff)
+			if sleepErr := sleepContext(ctx, backoff); sleepErr != nil {
+				return nil, sleepErr
+			}
 		}
 		if err != nil {
 			glog.V(1).Infof("operation LookupFileId %s failed, err: %v", chunkView.FileId, err)
-			return err
+			return nil, err
 		} else if len(urlStrings) == 0 {
 			errUrlNotFound := fmt.Errorf("operation LookupFileId %s failed, err: urls not found", chunkView.FileId)
 			glog.Error(errUrlNotFound)
-			return errUrlNotFound
+			return nil, errUrlNotFound
 		}
 		fileId2Url[chunkView.FileId] = urlStrings
 	}
 
 	downloadThrottler := util.NewWriteThrottler(downloadMaxBytesPs)
+	// the whole read is as patient as its size justifies
+	readFlow.retry = NewRetryPolicyForSize(size)
 	remaining := size
+	chunkIndex, chunkCount := 0, chunkViews.Len()
 	for x := chunkViews.Front(); x != nil; x = x.Next {
 		chunkView := x.Value
+		chunkIndex++
+		if readFlow.expired(0) {
+			return missing, ErrReadDeadlineExceeded
+		}
 		if offset < chunkView.ViewOffset {
 			gap := chunkView.ViewOffset - offset
 			remaining -= gap
 			glog.V(4).Infof("zero [%d,%d)", offset, chunkView.ViewOffset)
 			err := writeZero(writer, gap)
 			if err != nil {
-				return fmt.Errorf("write zero [%d,%d)", offset, chunkView.ViewOffset)
+				return missing, fmt.Errorf("write zero [%d,%d)", offset, chunkView.ViewOffset)
 			}
 			offset = chunkView.ViewOffset
 		}
 		urlStrings := fileId2Url[chunkView.FileId]
 		start := time.Now()
-		err := retriedStreamFetchChunkData(writer, urlStrings, chunkView.CipherKey, chunkView.IsGzipped, chunkView.IsFullChunk(), chunkView.OffsetInChunk, int(chunkView.ViewSize))
-		offset += int64(chunkView.ViewSize)
-		remaining -= int64(chunkView.ViewSize)
+		var written int
+		var err error
+		var verifyErr error
+		if readQuorum > 1 {
+			err = quorumFetchChunkView(ctx, writer, urlStrings, chunkView, readQuorum, readFlow)
+		} else {
+			chunkWriter, verify := newFullChunkWriter(writer, chunkView)
+			written, err = retriedStreamFetchChunkDataWithContext(ctx, chunkWriter, urlStrings, chunkView.CipherKey, gzipCodec(chunkView.IsGzipped), chunkView.IsFullChunk(), chunkView.OffsetInChunk, int(chunkView.ViewSize), readFlow)
+			if err == nil {
+				verifyErr = verify()
+			}
+		}
 		stats.FilerRequestHistogram.WithLabelValues("chunkDownload").Observe(time.Since(start).Seconds())
+		if err != nil && util.IsNotFound(err) {
+			missingErr := &MissingChunkError{
+				FileId: chunkView.FileId,
+				Offset: chunkView.ViewOffset,
+				Size:   chunkView.ViewSize,
+				Err:    err,
+			}
+			stats.FilerRequestCounter.WithLabelValues("chunkDownloadError").Inc()
+			if !bestEffort {
+				return missing, missingErr
+			}
+			glog.Warningf("zero fill %v", missingErr)
+			missing = append(missing, missingErr)
+			// the chunk is missing entirely, so nothing has been written for it
+			err = writeZero(writer, int64(chunkView.ViewSize))
+			if err != nil {
+				return missing, fmt.Errorf("write zero [%d,%d)", chunkView.ViewOffset, chunkView.ViewOffset+int64(chunkView.ViewSize))
+			}
+		}
+		if verifyErr != nil {
+			stats.FilerRequestCounter.WithLabelValues("chunkDownloadError").Inc()
+			// the chunk is written already, and is not worth resuming from
+			return missing, fmt.Errorf("read chunk: %w", verifyErr)
+		}
 		if err != nil {
 			stats.FilerRequestCounter.WithLabelValues("chunkDownloadError").Inc()
-			return fmt.Errorf("read chunk: %v", err)
+			// the data before the failure is valid, so the read can resume from there
+			return missing, &PartialReadError{Offset: offset + int64(written), Err: fmt.Errorf("read chunk: %w", err)}
 		}
+		offset += int64(chunkView.ViewSize)
+		remaining -= int64(chunkView.ViewSize)
 		stats.FilerRequestCounter.WithLabelValues("chunkDownload").Inc()
+		readFlow.emit(&ReadEvent{
+			Type:             ReadEventChunkFetched,
+			FileId:           chunkView.FileId,
+			ChunkIndex:       chunkIndex,
+			ChunkCount:       chunkCount,
+			BytesTransferred: size - remaining,
+		})
 		downloadThrottler.MaybeSlowdown(int64(chunkView.ViewSize))
 	}
 	if remaining > 0 {
 		glog.V(4).Infof("zero [%d,%d)", offset, offset+remaining)
 		err := writeZero(writer, remaining)
 		if err != nil {
-			return fmt.Errorf("write zero [%d,%d)", offset, offset+remaining)
+			return missing, fmt.Errorf("write zero [%d,%d)", offset, offset+remaining)
 		}
 	}
 
-	return nil
+	return missing, nil
 
 }
 
@@ -167,6 +289,7 @@ func ReadAll(buffer []byte, masterClient *wdclient.MasterClient, chunks []*filer
 	chunkViews := ViewFromChunks(lookupFileIdFn, chunks, 0, int64(len(buffer)))
 
 	idx := 0
+	readFlow := NewReadFlow(ReadSourceStream)
 
 	for x := chunkViews.Front(); x != nil; x = x.Next {
 		chunkView := x.Value
@@ -176,10 +299,13 @@ func ReadAll(buffer []byte, masterClient *wdclient.MasterClient, chunks []*filer
 			return err
 		}
 
-		n, err := retriedFetchChunkData(buffer[idx:idx+int(chunkView.ViewSize)], urlStrings, chunkView.CipherKey, chunkView.IsGzipped, chunkView.IsFullChunk(), chunkView.OffsetInChunk)
+		n, err := retriedFetchChunkData(buffer[idx:idx+int(chunkView.ViewSize)], urlStrings, chunkView.CipherKey, chunkView.IsGzipped, chunkView.IsFullChunk(), chunkView.OffsetInChunk, readFlow)
 		if err != nil {
 			return err
 		}
+		if err = chunkView.verifyFullChunk(buffer[idx : idx+n]); err != nil {
+			return err
+		}
 		idx += n
 	}
 	return nil
@@ -196,6 +322,7 @@ type ChunkStreamReader struct {
 	bufferLock   sync.Mutex
 	chunk        string
 	lookupFileId wdclient.LookupFileIdFunctionType
+	readFlow     *ReadFlow
 }
 
 var _ = io.ReadSeeker(&ChunkStreamReader{})
@@ -216,6 +343,7 @@ func doNewChunkStreamReader(lookupFileIdFn wdclient.LookupFileIdFunctionType, ch
 		chunkView:    chunkViews.Front(),
 		lookupFileId: lookupFileIdFn,
 		totalSize:    totalSize,
+		readFlow:     NewReadFlow(ReadSourceStream),
 	}
 }
 
@@ -331,8 +459,9 @@ func (c *ChunkStreamReader) fetchChunkToBuffer(chunkView *ChunkView) error {
 	}
 	var buffer bytes.Buffer
 	var shouldRetry bool
-	for _, urlString := range urlStrings {
-		shouldRetry, err = util.ReadUrlAsStream(urlString+"?readDeleted=true", chunkView.CipherKey, chunkView.IsGzipped, chunkView.IsFullChunk(), chunkView.OffsetInChunk, int(chunkView.ViewSize), func(data []byte) {
+	for _, urlString := range orderReplicas(urlStrings, c.readFlow) {
+		chargeRead(c.readFlow, int64(chunkView.ViewSize))
+		shouldRetry, err = readUrlAsStream(context.Background(), c.readFlow.chunkUrl(urlString), c.readFlow.header(), chunkView.CipherKey, chunkView.IsGzipped, chunkView.IsFullChunk(), chunkView.OffsetInChunk, int(chunkView.ViewSize), func(data []byte) {
 			buffer.Write(data)
 		})
 		if !shouldRetry {
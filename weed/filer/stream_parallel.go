@@ -0,0 +1,186 @@
+package filer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/stats"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+// bounds of the number of chunks StreamContentParallel fetches at the same time
+var (
+	ParallelReadInitialStreams = 2
+	ParallelReadMaxStreams     = 16
+)
+
+// adaptiveParallelism climbs the number of streams while the aggregate throughput keeps increasing.
+// Each window lasts until as many chunks as streams are fetched. A window faster by at least 10%
+// adds a stream, otherwise the last added stream is removed and the parallelism settles.
+type adaptiveParallelism struct {
+	streams        int
+	maxStreams     int
+	settled        bool
+	lastThroughput float64
+	windowBytes    int64
+	windowChunks   int
+	windowStart    time.Time
+}
+
+func newAdaptiveParallelism(initialStreams, maxStreams int, now time.Time) *adaptiveParallelism {
+	if maxStreams < 1 {
+		maxStreams = 1
+	}
+	if initialStreams < 1 {
+		initialStreams = 1
+	}
+	if initialStreams > maxStreams {
+		initialStreams = maxStreams
+	}
+	return &adaptiveParallelism{
+		streams:     initialStreams,
+		maxStreams:  maxStreams,
+		settled:     initialStreams == maxStreams,
+		windowStart: now,
+	}
+}
+
+// observe accounts for one fetched chunk, and returns the number of streams to use from now on
+func (p *adaptiveParallelism) observe(bytes int64, now time.Time) int {
+	if p.settled {
+		return p.streams
+	}
+	p.windowBytes += bytes
+	p.windowChunks++
+	if p.windowChunks < p.streams {
+		return p.streams
+	}
+	elapsed := now.Sub(p.windowStart).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1e-9
+	}
+	throughput := float64(p.windowBytes) / elapsed
+	if p.lastThroughput == 0 || throughput >= p.lastThroughput*1.1 {
+		p.lastThroughput = throughput
+		p.streams++
+		p.settled = p.streams >= p.maxStreams
+	} else {
+		// the last stream did not help
+		if p.streams > 1 {
+			p.streams--
+		}
+		p.settled = true
+	}
+	p.windowBytes, p.windowChunks, p.windowStart = 0, 0, now
+	return p.streams
+}
+
+type parallelChunk struct {
+	chunkView *ChunkView
+	data      []byte
+	err       error
+	done      chan struct{}
+}
+
+// StreamContentParallel streams the content like StreamContent, but fetches several chunks at the same time.
+// The parallelism starts at ParallelReadInitialStreams and grows, up to ParallelReadMaxStreams,
+// while the throughput keeps increasing. At most twice the parallelism of fetched chunks are buffered.
+func StreamContentParallel(masterClient wdclient.HasLookupFileIdFunction, writer io.Writer, chunks []*filer_pb.FileChunk, offset int64, size int64) error {
+	lookupFileIdFn := masterClient.GetLookupFileIdFunction()
+	chunkViews := ViewFromChunks(lookupFileIdFn, chunks, offset, size)
+	readFlow := NewReadFlow(ReadSourceStream)
+
+	var pending []*parallelChunk
+	for x := chunkViews.Front(); x != nil; x = x.Next {
+		pending = append(pending, &parallelChunk{chunkView: x.Value, done: make(chan struct{})})
+	}
+
+	var lock sync.Mutex
+	cond := sync.NewCond(&lock)
+	parallelism := newAdaptiveParallelism(ParallelReadInitialStreams, ParallelReadMaxStreams, time.Now())
+	streams, active, written := parallelism.streams, 0, 0
+	stopped := false
+	defer func() {
+		lock.Lock()
+		stopped = true
+		cond.Broadcast()
+		// let the fetches in flight finish, e.g. after a failed chunk
+		for active > 0 {
+			cond.Wait()
+		}
+		finalStreams := streams
+		lock.Unlock()
+		glog.V(4).Infof("parallel read of %d chunks settled at %d streams", len(pending), finalStreams)
+		stats.FilerParallelReadStreamsHistogram.Observe(float64(finalStreams))
+	}()
+
+	go func() {
+		for i, chunk := range pending {
+			lock.Lock()
+			for !stopped && (active >= streams || i-written >= 2*streams) {
+				cond.Wait()
+			}
+			if stopped {
+				lock.Unlock()
+				return
+			}
+			active++
+			lock.Unlock()
+
+			go func(chunk *parallelChunk) {
+				chunk.data = make([]byte, chunk.chunkView.ViewSize)
+				var n int
+				n, chunk.err = fetchChunkViewRange(chunk.data, lookupFileIdFn, chunk.chunkView, chunk.chunkView.OffsetInChunk, readFlow)
+				if chunk.err == nil && n != len(chunk.data) {
+					chunk.err = fmt.Errorf("read %d of %d bytes", n, len(chunk.data))
+				}
+				lock.Lock()
+				active--
+				streams = parallelism.observe(int64(n), time.Now())
+				cond.Broadcast()
+				lock.Unlock()
+				close(chunk.done)
+			}(chunk)
+		}
+	}()
+
+	remaining := size
+	for _, chunk := range pending {
+		chunkView := chunk.chunkView
+		if offset < chunkView.ViewOffset {
+			gap := chunkView.ViewOffset - offset
+			remaining -= gap
+			if err := writeZero(writer, gap); err != nil {
+				return fmt.Errorf("write zero [%d,%d)", offset, chunkView.ViewOffset)
+			}
+			offset = chunkView.ViewOffset
+		}
+		<-chunk.done
+		if chunk.err != nil {
+			stats.FilerRequestCounter.WithLabelValues("chunkDownloadError").Inc()
+			return fmt.Errorf("read chunk %s: %w", chunkView.FileId, chunk.err)
+		}
+		if _, err := writer.Write(chunk.data); err != nil {
+			return err
+		}
+		stats.FilerRequestCounter.WithLabelValues("chunkDownload").Inc()
+		chunk.data = nil
+		offset += int64(chunkView.ViewSize)
+		remaining -= int64(chunkView.ViewSize)
+
+		lock.Lock()
+		written++
+		cond.Broadcast()
+		lock.Unlock()
+	}
+	if remaining > 0 {
+		if err := writeZero(writer, remaining); err != nil {
+			return fmt.Errorf("write zero [%d,%d)", offset, offset+remaining)
+		}
+	}
+	return nil
+}
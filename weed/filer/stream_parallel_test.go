@@ -0,0 +1,61 @@
+package filer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestAdaptiveParallelism(t *testing.T) {
+	now := time.Unix(0, 0)
+	p := newAdaptiveParallelism(2, 8, now)
+
+	// each window takes one second, with a throughput growing with the streams up to maxStreams
+	window := func(bytesPerStream int, maxStreams int) (streams int) {
+		n := p.streams
+		now = now.Add(time.Second)
+		for i := 0; i < n; i++ {
+			streams = p.observe(int64(bytesPerStream*int(min(int64(n), int64(maxStreams)))/n), now)
+		}
+		return
+	}
+	// throughput grows with the streams up to 4 streams
+	assert.Equal(t, 3, window(100, 4))
+	assert.Equal(t, 4, window(100, 4))
+	assert.Equal(t, 5, window(100, 4))
+	// the fifth stream does not help
+	assert.Equal(t, 4, window(100, 4))
+	assert.True(t, p.settled)
+	assert.Equal(t, 4, window(100, 100))
+
+	assert.Equal(t, 1, newAdaptiveParallelism(0, 0, now).streams)
+}
+
+func TestStreamContentParallel(t *testing.T) {
+	contents := make(map[string]string)
+	var chunks []*filer_pb.FileChunk
+	var expected strings.Builder
+	for i := 0; i < 20; i++ {
+		fileId := fmt.Sprintf("1,%02x", i+1)
+		contents[fileId] = strings.Repeat(string(rune('a'+i)), 10)
+		chunks = append(chunks, &filer_pb.FileChunk{FileId: fileId, Offset: int64(i * 12), Size: 10, ModifiedTsNs: int64(i + 1)})
+		expected.WriteString(contents[fileId] + "\x00\x00")
+	}
+	lookup, closeFn := newTestVolumeServer(t, contents)
+	defer closeFn()
+
+	var buf bytes.Buffer
+	assert.NoError(t, StreamContentParallel(testLookup(lookup), &buf, chunks, 5, 230))
+	assert.Equal(t, expected.String()[5:235], buf.String())
+
+	// a missing chunk fails the read
+	chunks[10].FileId = "1,ff"
+	buf.Reset()
+	assert.Error(t, StreamContentParallel(testLookup(lookup), &buf, chunks, 0, 240))
+}
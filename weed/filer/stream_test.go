@@ -0,0 +1,301 @@
+package filer
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+	"github.com/seaweedfs/seaweedfs/weed/util"
+	"github.com/seaweedfs/seaweedfs/weed/wdclient"
+)
+
+type testLookup wdclient.LookupFileIdFunctionType
+
+func (l testLookup) GetLookupFileIdFunction() wdclient.LookupFileIdFunctionType {
+	return wdclient.LookupFileIdFunctionType(l)
+}
+
+func newTestVolumeServer(t *testing.T, contents map[string]string) (wdclient.LookupFileIdFunctionType, func()) {
+	return newTestVolumeServerWithGzip(t, contents, nil)
+}
+
+// newTestVolumeServerWithGzip serves the gzipped file ids compressed to full chunk reads,
+// and uncompressed to range reads, like a volume server does.
+func newTestVolumeServerWithGzip(t *testing.T, contents map[string]string, gzipped map[string]bool) (wdclient.LookupFileIdFunctionType, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fileId := strings.TrimPrefix(r.URL.Path, "/")
+		content, found := contents[fileId]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var start, stop int
+		if n, _ := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &stop); n == 2 {
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(content[start : stop+1]))
+			return
+		}
+		if gzipped[fileId] && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			compressed, _ := util.GzipData([]byte(content))
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(compressed)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	retryWaitTime := util.RetryWaitTime
+	util.RetryWaitTime = 1500 * time.Millisecond
+	lookup := func(fileId string) ([]string, error) {
+		return []string{server.URL + "/" + fileId}, nil
+	}
+	return lookup, func() {
+		util.RetryWaitTime = retryWaitTime
+		server.Close()
+	}
+}
+
+func TestStreamContentMissingChunk(t *testing.T) {
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": "aaaa",
+		"1,03": "cccc",
+	})
+	defer closeFn()
+
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 4, ModifiedTsNs: 1},
+		{FileId: "1,02", Offset: 4, Size: 4, ModifiedTsNs: 2},
+		{FileId: "1,03", Offset: 8, Size: 4, ModifiedTsNs: 3},
+	}
+
+	var buf bytes.Buffer
+	err := StreamContent(testLookup(lookup), &buf, chunks, 0, 12)
+	missingErr, ok := err.(*MissingChunkError)
+	if assert.True(t, ok, "unexpected error %v", err) {
+		assert.Equal(t, "1,02", missingErr.FileId)
+		assert.Equal(t, int64(4), missingErr.Offset)
+		assert.Equal(t, uint64(4), missingErr.Size)
+	}
+
+	buf.Reset()
+	missing, err := StreamContentBestEffort(testLookup(lookup), &buf, chunks, 0, 12)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(missing))
+	assert.Equal(t, "aaaa\x00\x00\x00\x00cccc", buf.String())
+}
+
+func TestStreamFileContent(t *testing.T) {
+	manifest, err := SerializeChunkManifest([]*filer_pb.FileChunk{
+		{FileId: "1,03", Offset: 8, Size: 4, ModifiedTsNs: 1},
+		{FileId: "1,02", Offset: 0, Size: 4, ModifiedTsNs: 1},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": string(manifest),
+		"1,02": "aaaa",
+		"1,03": "cccc",
+		"1,04": "dddd",
+		"1,05": "ee",
+	})
+	defer closeFn()
+
+	// out of order, with a gap at [4,8) and 1,05 overwriting the middle of 1,04
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,05", Offset: 13, Size: 2, ModifiedTsNs: 3},
+		{FileId: "1,04", Offset: 12, Size: 4, ModifiedTsNs: 2},
+		{FileId: "1,01", Offset: 0, Size: 12, ModifiedTsNs: 1, IsChunkManifest: true},
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, StreamFileContent(lookup, chunks, &buf))
+	assert.Equal(t, "aaaa\x00\x00\x00\x00ccccdeed", buf.String())
+
+	// the older chunk does not win over the newer one
+	chunks[0].ModifiedTsNs = 1
+	buf.Reset()
+	assert.NoError(t, StreamFileContent(lookup, chunks, &buf))
+	assert.Equal(t, "aaaa\x00\x00\x00\x00ccccdddd", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, StreamFileContent(lookup, nil, &buf))
+	assert.Equal(t, 0, buf.Len())
+
+	// the manifest can not be located
+	buf.Reset()
+	err = StreamFileContent(func(fileId string) ([]string, error) {
+		if fileId == "1,01" {
+			return nil, fmt.Errorf("volume 1 not found")
+		}
+		return lookup(fileId)
+	}, chunks, &buf)
+	assert.ErrorContains(t, err, "volume 1 not found")
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestStreamContentAcrossGzippedChunk(t *testing.T) {
+	lookup, closeFn := newTestVolumeServerWithGzip(t, map[string]string{
+		"1,01": "aaaabbbb",
+		"1,02": "ccccdddd",
+		"1,03": "eeeeffff",
+	}, map[string]bool{
+		"1,02": true,
+	})
+	defer closeFn()
+
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 8, ModifiedTsNs: 1},
+		{FileId: "1,02", Offset: 8, Size: 8, ModifiedTsNs: 2, IsCompressed: true},
+		{FileId: "1,03", Offset: 16, Size: 8, ModifiedTsNs: 3},
+	}
+
+	tests := []struct {
+		offset, size int64
+		expected     string
+	}{
+		{0, 24, "aaaabbbbccccddddeeeeffff"},
+		{4, 8, "bbbbcccc"}, // starts in a plain chunk and stops inside the gzipped chunk
+		{10, 4, "ccdd"},    // inside the gzipped chunk
+		{12, 8, "ddddeeee"},
+		{8, 8, "ccccdddd"}, // the whole gzipped chunk
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := StreamContent(testLookup(lookup), &buf, chunks, test.offset, test.size)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, buf.String(), "[%d,%d)", test.offset, test.offset+test.size)
+
+		reader := doNewChunkStreamReader(lookup, chunks)
+		data := make([]byte, test.size)
+		n, err := reader.ReadAt(data, test.offset)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, string(data[:n]), "ReadAt [%d,%d)", test.offset, test.offset+test.size)
+	}
+}
+
+func TestStreamResolvedContent(t *testing.T) {
+	manifest, err := proto.Marshal(&filer_pb.FileChunkManifest{
+		Chunks: []*filer_pb.FileChunk{
+			{FileId: "1,01", Offset: 0, Size: 4, ModifiedTsNs: 1},
+			{FileId: "1,02", Offset: 4, Size: 4, ModifiedTsNs: 2},
+		},
+	})
+	assert.NoError(t, err)
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": "aaaa",
+		"1,02": "bbbb",
+		"1,03": "cccc",
+		"1,10": string(manifest),
+	})
+	defer closeFn()
+
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,10", Offset: 0, Size: 8, ModifiedTsNs: 2, IsChunkManifest: true},
+		{FileId: "1,03", Offset: 8, Size: 4, ModifiedTsNs: 3},
+	}
+	resolved, err := ExportResolvedManifest(lookup, chunks)
+	assert.NoError(t, err)
+	assert.False(t, HasChunkManifest(resolved))
+
+	// persist and load the flat list
+	data, err := proto.Marshal(&filer_pb.FileChunkManifest{Chunks: resolved})
+	assert.NoError(t, err)
+	loaded := &filer_pb.FileChunkManifest{}
+	assert.NoError(t, proto.Unmarshal(data, loaded))
+
+	// the manifest is no longer reachable
+	noManifestLookup := func(fileId string) ([]string, error) {
+		if fileId == "1,10" {
+			return nil, fmt.Errorf("unexpected manifest lookup")
+		}
+		return lookup(fileId)
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, StreamResolvedContent(testLookup(noManifestLookup), &buf, loaded.Chunks, 2, 8))
+	assert.Equal(t, "aabbbbcc", buf.String())
+
+	assert.Error(t, StreamResolvedContent(testLookup(noManifestLookup), &buf, chunks, 0, 12))
+}
+
+func TestStreamContentWithEvents(t *testing.T) {
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": "aaaa",
+		"1,02": "bbbb",
+	})
+	defer closeFn()
+
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 4, ModifiedTsNs: 1},
+		{FileId: "1,02", Offset: 6, Size: 4, ModifiedTsNs: 2},
+	}
+	events := make(chan *ReadEvent, 10)
+	var buf bytes.Buffer
+	assert.NoError(t, StreamContentWithEvents(testLookup(lookup), &buf, chunks, 0, 10, events))
+	assert.Equal(t, "aaaa\x00\x00bbbb", buf.String())
+
+	if assert.Equal(t, 3, len(events)) {
+		event := <-events
+		assert.Equal(t, ReadEventManifestResolved, event.Type)
+		assert.Equal(t, 2, event.ChunkCount)
+		event = <-events
+		assert.Equal(t, ReadEvent{Type: ReadEventChunkFetched, FileId: "1,01", ChunkIndex: 1, ChunkCount: 2, BytesTransferred: 4}, *event)
+		event = <-events
+		assert.Equal(t, ReadEvent{Type: ReadEventChunkFetched, FileId: "1,02", ChunkIndex: 2, ChunkCount: 2, BytesTransferred: 10}, *event)
+	}
+
+	// a full channel does not block the read
+	events = make(chan *ReadEvent)
+	buf.Reset()
+	assert.NoError(t, StreamContentWithEvents(testLookup(lookup), &buf, chunks, 0, 10, events))
+	assert.Equal(t, 10, buf.Len())
+}
+
+func TestStreamContentWithDeadline(t *testing.T) {
+	lookup, closeFn := newTestVolumeServer(t, map[string]string{
+		"1,01": "aaaa",
+		"1,02": "bbbb",
+	})
+	defer closeFn()
+	clock, restoreClock := useFakeClock()
+	defer restoreClock()
+	defer func(wait time.Duration) {
+		util.RetryWaitTime = wait
+	}(util.RetryWaitTime)
+	util.RetryWaitTime = time.Minute
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	lookupWithUnavailable := func(fileId string) ([]string, error) {
+		if fileId == "1,03" {
+			return []string{unavailable.URL + "/" + fileId}, nil
+		}
+		return lookup(fileId)
+	}
+
+	chunks := []*filer_pb.FileChunk{
+		{FileId: "1,01", Offset: 0, Size: 4, ModifiedTsNs: 1},
+		{FileId: "1,03", Offset: 4, Size: 4, ModifiedTsNs: 2},
+		{FileId: "1,02", Offset: 8, Size: 4, ModifiedTsNs: 3},
+	}
+	var buf bytes.Buffer
+	err := StreamContentWithDeadline(testLookup(lookupWithUnavailable), &buf, chunks, 0, 12, clock.Now().Add(2*time.Second))
+	var partialErr *PartialReadError
+	if assert.ErrorAs(t, err, &partialErr) {
+		assert.Equal(t, int64(4), partialErr.Offset)
+	}
+	assert.Equal(t, "aaaa", buf.String())
+	// retried once, but not past the deadline
+	assert.Equal(t, []time.Duration{time.Second}, clock.sleeps)
+
+	// resume after the chunk is back
+	buf.Reset()
+	assert.NoError(t, StreamContentWithDeadline(testLookup(lookup), &buf, chunks[2:], partialErr.Offset+4, 4, clock.Now().Add(time.Minute)))
+	assert.Equal(t, "bbbb", buf.String())
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/seaweedfs/seaweedfs/weed/util"
 	"os"
 	"sync"
+	"sync/atomic"
 )
 
 type FileHandleId uint64
@@ -19,6 +20,8 @@ type FileHandle struct {
 	entry           *LockedEntry
 	entryLock       sync.RWMutex
 	entryChunkGroup *filer.ChunkGroup
+	// of the chunks written through the handle, which the modification times order among themselves
+	chunkGeneration atomic.Uint64
 	inode           uint64
 	wfs             *WFS
 
@@ -76,6 +79,7 @@ func (fh *FileHandle) SetEntry(entry *filer_pb.Entry) {
 		fileSize := filer.FileSize(entry)
 		entry.Attributes.FileSize = fileSize
 		var resolveManifestErr error
+		fh.chunkGeneration.Store(filer.MaxChunkGeneration(entry.Chunks) + 1)
 		fh.entryChunkGroup, resolveManifestErr = filer.NewChunkGroup(fh.wfs.LookupFn(), fh.wfs.chunkCache, entry.Chunks)
 		if resolveManifestErr != nil {
 			glog.Warningf("failed to resolve manifest chunks in %+v", entry)
@@ -98,6 +102,12 @@ func (fh *FileHandle) AddChunks(chunks []*filer_pb.FileChunk) {
 		return
 	}
 
+	generation := fh.chunkGeneration.Load()
+	for _, chunk := range chunks {
+		if chunk.Generation == 0 {
+			chunk.Generation = generation
+		}
+	}
 	fh.entry.AppendChunks(chunks)
 }
 
@@ -113,10 +123,3 @@ func (fh *FileHandle) ReleaseHandle() {
 		fh.mirrorFile.Close()
 	}
 }
-
-func lessThan(a, b *filer_pb.FileChunk) bool {
-	if a.ModifiedTsNs == b.ModifiedTsNs {
-		return a.Fid.FileKey < b.Fid.FileKey
-	}
-	return a.ModifiedTsNs < b.ModifiedTsNs
-}
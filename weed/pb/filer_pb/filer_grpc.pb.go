@@ -45,6 +45,8 @@ type SeaweedFilerClient interface {
 	Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*LockResponse, error)
 	Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*UnlockResponse, error)
 	TransferLocks(ctx context.Context, in *TransferLocksRequest, opts ...grpc.CallOption) (*TransferLocksResponse, error)
+	ResolveChunkManifest(ctx context.Context, in *ResolveChunkManifestRequest, opts ...grpc.CallOption) (*ResolveChunkManifestResponse, error)
+	CacheChunkManifest(ctx context.Context, in *CacheChunkManifestRequest, opts ...grpc.CallOption) (*CacheChunkManifestResponse, error)
 }
 
 type seaweedFilerClient struct {
@@ -354,6 +356,24 @@ func (c *seaweedFilerClient) TransferLocks(ctx context.Context, in *TransferLock
 	return out, nil
 }
 
+func (c *seaweedFilerClient) ResolveChunkManifest(ctx context.Context, in *ResolveChunkManifestRequest, opts ...grpc.CallOption) (*ResolveChunkManifestResponse, error) {
+	out := new(ResolveChunkManifestResponse)
+	err := c.cc.Invoke(ctx, "/filer_pb.SeaweedFiler/ResolveChunkManifest", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *seaweedFilerClient) CacheChunkManifest(ctx context.Context, in *CacheChunkManifestRequest, opts ...grpc.CallOption) (*CacheChunkManifestResponse, error) {
+	out := new(CacheChunkManifestResponse)
+	err := c.cc.Invoke(ctx, "/filer_pb.SeaweedFiler/CacheChunkManifest", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SeaweedFilerServer is the server API for SeaweedFiler service.
 // All implementations must embed UnimplementedSeaweedFilerServer
 // for forward compatibility
@@ -381,6 +401,8 @@ type SeaweedFilerServer interface {
 	Lock(context.Context, *LockRequest) (*LockResponse, error)
 	Unlock(context.Context, *UnlockRequest) (*UnlockResponse, error)
 	TransferLocks(context.Context, *TransferLocksRequest) (*TransferLocksResponse, error)
+	ResolveChunkManifest(context.Context, *ResolveChunkManifestRequest) (*ResolveChunkManifestResponse, error)
+	CacheChunkManifest(context.Context, *CacheChunkManifestRequest) (*CacheChunkManifestResponse, error)
 	mustEmbedUnimplementedSeaweedFilerServer()
 }
 
@@ -457,6 +479,12 @@ func (UnimplementedSeaweedFilerServer) Unlock(context.Context, *UnlockRequest) (
 func (UnimplementedSeaweedFilerServer) TransferLocks(context.Context, *TransferLocksRequest) (*TransferLocksResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method TransferLocks not implemented")
 }
+func (UnimplementedSeaweedFilerServer) ResolveChunkManifest(context.Context, *ResolveChunkManifestRequest) (*ResolveChunkManifestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResolveChunkManifest not implemented")
+}
+func (UnimplementedSeaweedFilerServer) CacheChunkManifest(context.Context, *CacheChunkManifestRequest) (*CacheChunkManifestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheChunkManifest not implemented")
+}
 func (UnimplementedSeaweedFilerServer) mustEmbedUnimplementedSeaweedFilerServer() {}
 
 // UnsafeSeaweedFilerServer may be embedded to opt out of forward compatibility for this service.
@@ -896,6 +924,42 @@ func _SeaweedFiler_TransferLocks_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _SeaweedFiler_ResolveChunkManifest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveChunkManifestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeaweedFilerServer).ResolveChunkManifest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/filer_pb.SeaweedFiler/ResolveChunkManifest",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeaweedFilerServer).ResolveChunkManifest(ctx, req.(*ResolveChunkManifestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SeaweedFiler_CacheChunkManifest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CacheChunkManifestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeaweedFilerServer).CacheChunkManifest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/filer_pb.SeaweedFiler/CacheChunkManifest",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeaweedFilerServer).CacheChunkManifest(ctx, req.(*CacheChunkManifestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // SeaweedFiler_ServiceDesc is the grpc.ServiceDesc for SeaweedFiler service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -979,6 +1043,14 @@ var SeaweedFiler_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "TransferLocks",
 			Handler:    _SeaweedFiler_TransferLocks_Handler,
 		},
+		{
+			MethodName: "ResolveChunkManifest",
+			Handler:    _SeaweedFiler_ResolveChunkManifest_Handler,
+		},
+		{
+			MethodName: "CacheChunkManifest",
+			Handler:    _SeaweedFiler_CacheChunkManifest_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
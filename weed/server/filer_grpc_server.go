@@ -142,6 +142,15 @@ func (fs *FilerServer) CreateEntry(ctx context.Context, req *filer_pb.CreateEntr
 
 	resp = &filer_pb.CreateEntryResponse{}
 
+	// the chunks of an overwritten file are newer than the ones it had
+	if len(req.Entry.GetChunks()) > 0 {
+		if existingEntry, findErr := fs.filer.FindEntry(ctx, util.NewFullPath(req.Directory, req.Entry.Name)); findErr == nil {
+			filer.AssignChunkGenerations(existingEntry.GetChunks(), req.Entry.GetChunks())
+		} else {
+			filer.AssignChunkGenerations(nil, req.Entry.GetChunks())
+		}
+	}
+
 	chunks, garbage, err2 := fs.cleanupChunks(util.Join(req.Directory, req.Entry.Name), nil, req.Entry)
 	if err2 != nil {
 		return &filer_pb.CreateEntryResponse{}, fmt.Errorf("CreateEntry cleanupChunks %s %s: %v", req.Directory, req.Entry.Name, err2)
@@ -209,6 +218,7 @@ func (fs *FilerServer) cleanupChunks(fullpath string, existingEntry *filer.Entry
 		if err != nil {
 			return newEntry.GetChunks(), nil, fmt.Errorf("MinusChunks: %v", err)
 		}
+		filer.AssignChunkGenerations(existingEntry.GetChunks(), newEntry.GetChunks())
 	}
 
 	// files with manifest chunks are usually large and append only, skip calculating covered chunks
@@ -227,7 +237,7 @@ func (fs *FilerServer) cleanupChunks(fullpath string, existingEntry *filer.Entry
 			"",
 			"",
 		) // ignore readonly error for capacity needed to manifestize
-		chunks, err = filer.MaybeManifestize(fs.saveAsChunk(so), chunks)
+		chunks, err = filer.MaybeManifestizeWithPlacement(fs.saveAsChunkWithPlacement(so), chunks)
 		if err != nil {
 			// not good, but should be ok
 			glog.V(0).Infof("MaybeManifestize: %v", err)
@@ -269,6 +279,7 @@ func (fs *FilerServer) AppendToEntry(ctx context.Context, req *filer_pb.AppendTo
 		chunk.Offset = offset
 		offset += int64(chunk.Size)
 	}
+	filer.AssignChunkGenerations(entry.GetChunks(), req.Chunks)
 
 	entry.Chunks = append(entry.GetChunks(), req.Chunks...)
 	so, err := fs.detectStorageOption(string(fullpath), "", "", entry.TtlSec, "", "", "", "")
@@ -276,7 +287,7 @@ func (fs *FilerServer) AppendToEntry(ctx context.Context, req *filer_pb.AppendTo
 		glog.Warningf("detectStorageOption: %v", err)
 		return &filer_pb.AppendToEntryResponse{}, err
 	}
-	entry.Chunks, err = filer.MaybeManifestize(fs.saveAsChunk(so), entry.GetChunks())
+	entry.Chunks, err = filer.MaybeManifestizeWithPlacement(fs.saveAsChunkWithPlacement(so), entry.GetChunks())
 	if err != nil {
 		// not good, but should be ok
 		glog.V(0).Infof("MaybeManifestize: %v", err)
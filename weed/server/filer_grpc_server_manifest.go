@@ -0,0 +1,26 @@
+package weed_server
+
+import (
+	"context"
+
+	"github.com/seaweedfs/seaweedfs/weed/filer"
+	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
+)
+
+// ResolveChunkManifest resolves a chunk manifest for the peer filers, so one filer fetches each manifest
+// the filers of the cluster read at the same time
+func (fs *FilerServer) ResolveChunkManifest(ctx context.Context, req *filer_pb.ResolveChunkManifestRequest) (*filer_pb.ResolveChunkManifestResponse, error) {
+	dataChunks, err := filer.ResolveOneChunkManifestForPeer(fs.filer.MasterClient.GetLookupFileIdFunction(), req.ManifestChunk)
+	if err != nil {
+		return nil, err
+	}
+	return &filer_pb.ResolveChunkManifestResponse{Chunks: dataChunks}, nil
+}
+
+// CacheChunkManifest keeps the chunks of a manifest a peer filer has just written, so the first read is served warm
+func (fs *FilerServer) CacheChunkManifest(ctx context.Context, req *filer_pb.CacheChunkManifestRequest) (*filer_pb.CacheChunkManifestResponse, error) {
+	if err := filer.CacheChunkManifestForPeer(req.ManifestChunk, req.Chunks); err != nil {
+		return nil, err
+	}
+	return &filer_pb.CacheChunkManifestResponse{}, nil
+}
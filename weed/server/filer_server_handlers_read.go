@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"math"
 	"mime"
 	"net/http"
 	"path/filepath"
@@ -135,9 +134,9 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 
 	if query.Get("metadata") == "true" {
 		if query.Get("resolveManifest") == "true" {
-			if entry.Chunks, _, err = filer.ResolveChunkManifest(
+			if entry.Chunks, _, err = filer.ResolveChunkManifestAll(
 				fs.filer.MasterClient.GetLookupFileIdFunction(),
-				entry.GetChunks(), 0, math.MaxInt64); err != nil {
+				entry.GetChunks()); err != nil {
 				err = fmt.Errorf("failed to resolve chunk manifest, err: %s", err.Error())
 				writeJsonError(w, r, http.StatusInternalServerError, err)
 				return
@@ -253,7 +252,8 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 			}
 		}
 
-		err = filer.StreamContentWithThrottler(fs.filer.MasterClient, writer, chunks, offset, size, fs.option.DownloadMaxBytesPs)
+		readQuorum := filer.ReadQuorum(entry, fs.filer.FilerConf.MatchStorageRule(string(entry.FullPath)).ReadQuorum)
+		err = filer.StreamContentWithQuorum(r.Context(), fs.filer.MasterClient, writer, chunks, offset, size, fs.option.DownloadMaxBytesPs, readQuorum)
 		if err != nil {
 			stats.FilerRequestCounter.WithLabelValues(stats.ErrorReadStream).Inc()
 			glog.Errorf("failed to stream content %s: %v", r.URL, err)
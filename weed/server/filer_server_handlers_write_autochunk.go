@@ -190,6 +190,7 @@ func (fs *FilerServer) saveMetaData(ctx context.Context, r *http.Request, fileNa
 			}
 			entry.FileSize += uint64(chunkOffset)
 		}
+		filer.AssignChunkGenerations(entry.GetChunks(), fileChunks)
 		newChunks = append(entry.GetChunks(), fileChunks...)
 
 		// TODO
@@ -200,6 +201,7 @@ func (fs *FilerServer) saveMetaData(ctx context.Context, r *http.Request, fileNa
 
 	} else {
 		glog.V(4).Infoln("saving", path)
+		filer.AssignChunkGenerations(nil, fileChunks)
 		newChunks = fileChunks
 		entry = &filer.Entry{
 			FullPath: util.FullPath(path),
@@ -226,7 +228,7 @@ func (fs *FilerServer) saveMetaData(ctx context.Context, r *http.Request, fileNa
 	}
 
 	// maybe compact entry chunks
-	mergedChunks, replyerr = filer.MaybeManifestize(fs.saveAsChunk(so), mergedChunks)
+	mergedChunks, replyerr = filer.MaybeManifestizeWithPlacement(fs.saveAsChunkWithPlacement(so), mergedChunks)
 	if replyerr != nil {
 		glog.V(0).Infof("manifestize %s: %v", r.RequestURI, replyerr)
 		return
@@ -264,14 +266,40 @@ func (fs *FilerServer) saveMetaData(ctx context.Context, r *http.Request, fileNa
 }
 
 func (fs *FilerServer) saveAsChunk(so *operation.StorageOption) filer.SaveDataAsChunkFunctionType {
-
+	saveFunc := fs.saveAsChunkWithPlacement(so)
 	return func(reader io.Reader, name string, offset int64, tsNs int64) (*filer_pb.FileChunk, error) {
+		return saveFunc(reader, name, offset, tsNs, nil)
+	}
+}
+
+// maxPlacementAssigns bounds the file id assignments tried to avoid a volume, the last one is used anyway
+const maxPlacementAssigns = 3
+
+func (fs *FilerServer) saveAsChunkWithPlacement(so *operation.StorageOption) filer.SaveDataAsChunkWithPlacementFunctionType {
+
+	return func(reader io.Reader, name string, offset int64, tsNs int64, placement *filer.ManifestPlacement) (*filer_pb.FileChunk, error) {
 		var fileId string
 		var uploadResult *operation.UploadResult
 
+		so, avoidVolumeIds := so, map[string]struct{}(nil)
+		if placement != nil {
+			avoidVolumeIds = placement.AvoidVolumeIds
+			if placement.Collection != "" {
+				placedSo := *so
+				placedSo.Collection, placedSo.Replication = placement.Collection, placement.Replication
+				so = &placedSo
+			}
+		}
+
 		err := util.Retry("saveAsChunk", func() error {
 			// assign one file id for one chunk
 			assignedFileId, urlLocation, auth, assignErr := fs.assignNewFileInfo(so)
+			for i := 1; i < maxPlacementAssigns && assignErr == nil; i++ {
+				if _, found := avoidVolumeIds[filer.VolumeId(assignedFileId)]; !found {
+					break
+				}
+				assignedFileId, urlLocation, auth, assignErr = fs.assignNewFileInfo(so)
+			}
 			if assignErr != nil {
 				return assignErr
 			}
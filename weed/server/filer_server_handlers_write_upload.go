@@ -13,6 +13,7 @@ import (
 
 	"golang.org/x/exp/slices"
 
+	"github.com/seaweedfs/seaweedfs/weed/filer"
 	"github.com/seaweedfs/seaweedfs/weed/glog"
 	"github.com/seaweedfs/seaweedfs/weed/operation"
 	"github.com/seaweedfs/seaweedfs/weed/pb/filer_pb"
@@ -208,5 +209,9 @@ func (fs *FilerServer) dataToChunk(fileName, contentType string, data []byte, ch
 	if uploadResult.Size == 0 {
 		return nil, nil
 	}
-	return []*filer_pb.FileChunk{uploadResult.ToPbFileChunk(fileId, chunkOffset, time.Now().UnixNano())}, nil
+	chunk := uploadResult.ToPbFileChunk(fileId, chunkOffset, time.Now().UnixNano())
+	if err := filer.SetChunkChecksum(chunk, filer.ChunkChecksumAlgorithm, data); err != nil {
+		return nil, err
+	}
+	return []*filer_pb.FileChunk{chunk}, nil
 }
@@ -31,6 +31,7 @@ var fileNameEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
 func (vs *VolumeServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request) {
 	n := new(needle.Needle)
 	vid, fid, filename, ext, _ := parseURLPath(r.URL.Path)
+	glog.V(3).Infof("%s %s from %s agent %s request %s", r.Method, r.URL.Path, r.RemoteAddr, r.UserAgent(), r.Header.Get("X-Request-ID"))
 
 	if !vs.maybeCheckJwtAuthorization(r, vid, fid, false) {
 		writeJsonError(w, r, http.StatusUnauthorized, errors.New("wrong jwt"))
@@ -14,7 +14,6 @@ import (
 	"github.com/seaweedfs/seaweedfs/weed/util"
 	"golang.org/x/exp/slices"
 	"io"
-	"math"
 	"strings"
 	"sync"
 	"time"
@@ -146,7 +145,7 @@ func (c *commandFsVerify) verifyTraverseBfs(path string) (fileCount int64, errCo
 					return nil
 				}
 			}
-			dataChunks, manifestChunks, resolveErr := filer.ResolveChunkManifest(filer.LookupFn(c.env), entry.Entry.GetChunks(), 0, math.MaxInt64)
+			dataChunks, manifestChunks, resolveErr := filer.ResolveChunkManifestAll(filer.LookupFn(c.env), entry.Entry.GetChunks())
 			if resolveErr != nil {
 				return fmt.Errorf("failed to ResolveChunkManifest: %+v", resolveErr)
 			}
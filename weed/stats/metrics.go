@@ -103,6 +103,73 @@ var (
 			Help:      "The last send timestamp of the filer subscription.",
 		}, []string{"sourceFiler", "clientName", "path"})
 
+	FilerManifestMaintenanceCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "filer",
+			Name:      "manifest_maintenance_total",
+			Help:      "Counter of manifests and chunks rewritten or deleted by manifest maintenance.",
+		}, []string{"operation", "type"})
+
+	FilerManifestMaintenanceBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "filer",
+			Name:      "manifest_maintenance_bytes_total",
+			Help:      "Counter of bytes moved by manifest maintenance.",
+		}, []string{"operation"})
+
+	FilerManifestMaintenanceHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "filer",
+			Name:      "manifest_maintenance_seconds",
+			Help:      "Bucketed histogram of manifest maintenance processing time.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 24),
+		}, []string{"operation"})
+
+	FilerPrefetchCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "filer",
+			Name:      "prefetch_total",
+			Help:      "Counter of prefetched chunks that were read or wasted.",
+		}, []string{"type"})
+
+	FilerPrefetchWindowHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "filer",
+			Name:      "prefetch_window",
+			Help:      "Bucketed histogram of the number of chunks read ahead by each prefetch.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+		})
+
+	FilerParallelReadStreamsHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "filer",
+			Name:      "parallel_read_streams",
+			Help:      "Bucketed histogram of the number of parallel streams each parallel read settled at.",
+			Buckets:   prometheus.LinearBuckets(1, 1, 16),
+		})
+
+	FilerChunkFetchCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "filer",
+			Name:      "chunk_fetch_total",
+			Help:      "Counter of chunk fetch attempts, retried attempts, and fetches failed after exhausting the retries.",
+		}, []string{"operation", "type"})
+
+	FilerChunkFetchUrlFailureCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "filer",
+			Name:      "chunk_fetch_url_failure_total",
+			Help:      "Counter of failed chunk fetch attempts per volume server.",
+		}, []string{"operation", "volumeServer"})
+
 	FilerStoreCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: Namespace,
@@ -161,6 +228,14 @@ var (
 			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 24),
 		}, []string{"type"})
 
+	VolumeServerEcReconstructCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "volumeServer",
+			Name:      "ec_reconstruct_total",
+			Help:      "Counter of ec shard intervals reconstructed from other shards.",
+		}, []string{"success"})
+
 	VolumeServerRequestHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: Namespace,
@@ -238,6 +313,14 @@ func init() {
 
 	Gather.MustRegister(FilerRequestCounter)
 	Gather.MustRegister(FilerRequestHistogram)
+	Gather.MustRegister(FilerManifestMaintenanceCounter)
+	Gather.MustRegister(FilerManifestMaintenanceBytesCounter)
+	Gather.MustRegister(FilerManifestMaintenanceHistogram)
+	Gather.MustRegister(FilerPrefetchCounter)
+	Gather.MustRegister(FilerPrefetchWindowHistogram)
+	Gather.MustRegister(FilerParallelReadStreamsHistogram)
+	Gather.MustRegister(FilerChunkFetchCounter)
+	Gather.MustRegister(FilerChunkFetchUrlFailureCounter)
 	Gather.MustRegister(FilerStoreCounter)
 	Gather.MustRegister(FilerStoreHistogram)
 	Gather.MustRegister(FilerSyncOffsetGauge)
@@ -250,6 +333,7 @@ func init() {
 	Gather.MustRegister(VolumeServerVacuumingCompactCounter)
 	Gather.MustRegister(VolumeServerVacuumingCommitCounter)
 	Gather.MustRegister(VolumeServerVacuumingHistogram)
+	Gather.MustRegister(VolumeServerEcReconstructCounter)
 	Gather.MustRegister(VolumeServerVolumeCounter)
 	Gather.MustRegister(VolumeServerMaxVolumeCounter)
 	Gather.MustRegister(VolumeServerReadOnlyVolumeGauge)
@@ -40,4 +40,21 @@ const (
 	RepeatErrorUploadContent = "upload.content.repeat.failed"
 	ErrorReadCache           = "read.cache.failed"
 	ErrorReadStream          = "read.stream.failed"
+
+	// manifest maintenance
+	ManifestRewritten = "manifestRewritten"
+	ChunkRewritten    = "chunkRewritten"
+	ManifestDeleted   = "manifestDeleted"
+	ChunkDeleted      = "chunkDeleted"
+
+	// prefetch
+	PrefetchHit    = "hit"
+	PrefetchWasted = "wasted"
+
+	// chunk fetch
+	ChunkFetchFull      = "fullChunk"
+	ChunkFetchRange     = "range"
+	ChunkFetchAttempt   = "attempt"
+	ChunkFetchRetry     = "retry"
+	ChunkFetchExhausted = "exhausted"
 )
@@ -7,7 +7,7 @@ import (
 	"golang.org/x/exp/slices"
 	"io"
 	"os"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/klauspost/reedsolomon"
@@ -278,6 +278,9 @@ func (s *Store) cachedLookupEcShardLocations(ecVolume *erasure_coding.EcVolume)
 	return
 }
 
+// readRemoteEcShardInterval is replaced in tests, to read the shards of the reconstruction without volume servers
+var readRemoteEcShardInterval = (*Store).readRemoteEcShardInterval
+
 func (s *Store) readRemoteEcShardInterval(sourceDataNodes []pb.ServerAddress, needleId types.NeedleId, vid needle.VolumeId, shardId erasure_coding.ShardId, buf []byte, offset int64) (n int, is_deleted bool, err error) {
 
 	if len(sourceDataNodes) == 0 {
@@ -344,9 +347,24 @@ func (s *Store) recoverOneRemoteEcShardInterval(needleId types.NeedleId, ecVolum
 		return 0, false, fmt.Errorf("failed to create encoder: %v", err)
 	}
 
-	bufs := make([][]byte, erasure_coding.TotalShardsCount)
+	start := time.Now()
+	defer func() {
+		if !is_deleted {
+			stats.VolumeServerEcReconstructCounter.WithLabelValues(strconv.FormatBool(err == nil)).Inc()
+		}
+		stats.VolumeServerRequestHistogram.WithLabelValues("ecReconstruct").Observe(time.Since(start).Seconds())
+	}()
+
+	// read all other shards at once, and reconstruct from the first DataShardsCount to arrive,
+	// so the slowest shard servers do not add to the latency
+	type shardRead struct {
+		shardId   erasure_coding.ShardId
+		data      []byte
+		isDeleted bool
+	}
+	reads := make(chan shardRead, erasure_coding.TotalShardsCount)
+	pending := 0
 
-	var wg sync.WaitGroup
 	ecVolume.ShardLocationsLock.RLock()
 	for shardId, locations := range ecVolume.ShardLocations {
 
@@ -360,26 +378,46 @@ func (s *Store) recoverOneRemoteEcShardInterval(needleId types.NeedleId, ecVolum
 		}
 
 		// read from remote locations
-		wg.Add(1)
+		pending++
 		go func(shardId erasure_coding.ShardId, locations []pb.ServerAddress) {
-			defer wg.Done()
 			data := make([]byte, len(buf))
-			nRead, isDeleted, readErr := s.readRemoteEcShardInterval(locations, needleId, ecVolume.VolumeId, shardId, data, offset)
+			nRead, isDeleted, readErr := readRemoteEcShardInterval(s, locations, needleId, ecVolume.VolumeId, shardId, data, offset)
 			if readErr != nil {
 				glog.V(3).Infof("recover: readRemoteEcShardInterval %d.%d %d bytes from %+v: %v", ecVolume.VolumeId, shardId, nRead, locations, readErr)
 				forgetShardId(ecVolume, shardId)
 			}
-			if isDeleted {
-				is_deleted = true
-			}
-			if nRead == len(buf) {
-				bufs[shardId] = data
+			if nRead != len(buf) {
+				data = nil
 			}
+			reads <- shardRead{shardId: shardId, data: data, isDeleted: isDeleted}
 		}(shardId, locations)
 	}
 	ecVolume.ShardLocationsLock.RUnlock()
 
-	wg.Wait()
+	// a deletion reaches all the shard servers, so one of them telling the needle is deleted is final
+	bufs := make([][]byte, erasure_coding.TotalShardsCount)
+	for received := 0; pending > 0 && received < erasure_coding.DataShardsCount; pending-- {
+		read := <-reads
+		if read.isDeleted {
+			return 0, true, nil
+		}
+		if read.data != nil {
+			bufs[read.shardId] = read.data
+			received++
+		}
+	}
+	// nor reconstruct when a reply arrived meanwhile tells so
+drain:
+	for ; pending > 0; pending-- {
+		select {
+		case read := <-reads:
+			if read.isDeleted {
+				return 0, true, nil
+			}
+		default:
+			break drain
+		}
+	}
 
 	if err = enc.ReconstructData(bufs); err != nil {
 		glog.V(3).Infof("recovered ec shard %d.%d failed: %v", ecVolume.VolumeId, shardIdToRecover, err)
@@ -389,7 +427,7 @@ func (s *Store) recoverOneRemoteEcShardInterval(needleId types.NeedleId, ecVolum
 
 	copy(buf, bufs[shardIdToRecover])
 
-	return len(buf), is_deleted, nil
+	return len(buf), false, nil
 }
 
 func (s *Store) EcVolumes() (ecVolumes []*erasure_coding.EcVolume) {
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/reedsolomon"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seaweedfs/seaweedfs/weed/pb"
+	"github.com/seaweedfs/seaweedfs/weed/stats"
+	"github.com/seaweedfs/seaweedfs/weed/storage/erasure_coding"
+	"github.com/seaweedfs/seaweedfs/weed/storage/needle"
+	"github.com/seaweedfs/seaweedfs/weed/storage/types"
+)
+
+func TestRecoverOneRemoteEcShardInterval(t *testing.T) {
+	shards := make([][]byte, erasure_coding.TotalShardsCount)
+	for i := range shards {
+		shards[i] = make([]byte, 64)
+		if i < erasure_coding.DataShardsCount {
+			rand.Read(shards[i])
+		}
+	}
+	enc, err := reedsolomon.New(erasure_coding.DataShardsCount, erasure_coding.ParityShardsCount)
+	assert.NoError(t, err)
+	assert.NoError(t, enc.Encode(shards))
+
+	const failing, slow, none = erasure_coding.ShardId(13), erasure_coding.ShardId(12), erasure_coding.ShardId(erasure_coding.TotalShardsCount)
+	defer func(read func(*Store, []pb.ServerAddress, types.NeedleId, needle.VolumeId, erasure_coding.ShardId, []byte, int64) (int, bool, error)) {
+		readRemoteEcShardInterval = read
+	}(readRemoteEcShardInterval)
+	// reconstruct recovers shard 0, with the other shards read concurrently
+	reconstruct := func(ecVolume *erasure_coding.EcVolume, deleted erasure_coding.ShardId, buf []byte, offset int64) (int, bool, error) {
+		release := make(chan struct{})
+		var reads sync.WaitGroup
+		reads.Add(erasure_coding.TotalShardsCount - 1)
+		readRemoteEcShardInterval = func(s *Store, locations []pb.ServerAddress, needleId types.NeedleId, vid needle.VolumeId, shardId erasure_coding.ShardId, buf []byte, offset int64) (int, bool, error) {
+			defer reads.Done()
+			switch shardId {
+			case failing:
+				return 0, false, fmt.Errorf("shard %d unavailable", shardId)
+			case slow:
+				// does not answer while the other shards are enough
+				<-release
+			case deleted:
+				return 0, true, nil
+			}
+			return copy(buf, shards[shardId][offset:]), false, nil
+		}
+		defer reads.Wait()
+		defer close(release)
+		return (&Store{}).recoverOneRemoteEcShardInterval(1, ecVolume, 0, buf, offset)
+	}
+	newEcVolume := func() *erasure_coding.EcVolume {
+		ecVolume := &erasure_coding.EcVolume{VolumeId: 1, ShardLocations: make(map[erasure_coding.ShardId][]pb.ServerAddress)}
+		for shardId := erasure_coding.ShardId(0); shardId < erasure_coding.TotalShardsCount; shardId++ {
+			ecVolume.ShardLocations[shardId] = []pb.ServerAddress{pb.ServerAddress(fmt.Sprintf("server%d:8080", shardId))}
+		}
+		return ecVolume
+	}
+	reconstructed := func() float64 {
+		return testutil.ToFloat64(stats.VolumeServerEcReconstructCounter.WithLabelValues("true"))
+	}
+
+	// reconstructed from the first shards to arrive, without waiting for the slow one
+	before := reconstructed()
+	ecVolume := newEcVolume()
+	buf := make([]byte, 32)
+	n, isDeleted, err := reconstruct(ecVolume, none, buf, 16)
+	assert.NoError(t, err)
+	assert.False(t, isDeleted)
+	assert.Equal(t, 32, n)
+	assert.True(t, bytes.Equal(shards[0][16:48], buf))
+	assert.Equal(t, before+1, reconstructed())
+	ecVolume.ShardLocationsLock.RLock()
+	_, found := ecVolume.ShardLocations[failing]
+	ecVolume.ShardLocationsLock.RUnlock()
+	assert.False(t, found, "the failing shard location is forgotten")
+
+	// a shard telling the needle is deleted is final
+	n, isDeleted, err = reconstruct(newEcVolume(), 1, buf, 0)
+	assert.NoError(t, err)
+	assert.True(t, isDeleted)
+	assert.Zero(t, n)
+	assert.Equal(t, before+1, reconstructed(), "nothing reconstructed")
+}
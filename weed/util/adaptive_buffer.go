@@ -0,0 +1,68 @@
+package util
+
+import (
+	"github.com/seaweedfs/seaweedfs/weed/util/mem"
+)
+
+// bounds of the buffer used by ReadUrlAsStream
+var (
+	StreamReadBufferMinSize = 16 * 1024
+	StreamReadBufferMaxSize = 1024 * 1024
+)
+
+const streamReadBufferInitialSize = 64 * 1024
+
+// adaptiveBuffer grows for streams that keep filling the whole buffer on each read,
+// i.e. data arrives faster than it is consumed, and shrinks for slow or small streams.
+type adaptiveBuffer struct {
+	buf      []byte
+	min, max int
+}
+
+func newAdaptiveBuffer(min, max int) *adaptiveBuffer {
+	if max < min {
+		max = min
+	}
+	size := streamReadBufferInitialSize
+	if size < min {
+		size = min
+	}
+	if size > max {
+		size = max
+	}
+	return &adaptiveBuffer{
+		buf: mem.Allocate(size),
+		min: min,
+		max: max,
+	}
+}
+
+func (b *adaptiveBuffer) Bytes() []byte {
+	return b.buf
+}
+
+// Adjust resizes the buffer based on the number of bytes the last read returned
+func (b *adaptiveBuffer) Adjust(n int) {
+	size := len(b.buf)
+	switch {
+	case n >= size && size < b.max:
+		size *= 2
+		if size > b.max {
+			size = b.max
+		}
+	case n < size/4 && size > b.min:
+		size /= 2
+		if size < b.min {
+			size = b.min
+		}
+	default:
+		return
+	}
+	mem.Free(b.buf)
+	b.buf = mem.Allocate(size)
+}
+
+func (b *adaptiveBuffer) Free() {
+	mem.Free(b.buf)
+	b.buf = nil
+}
@@ -0,0 +1,29 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveBuffer(t *testing.T) {
+	b := newAdaptiveBuffer(16*1024, 256*1024)
+	defer b.Free()
+	assert.Equal(t, 64*1024, len(b.Bytes()))
+
+	// fast stream fills the buffer every time
+	for i := 0; i < 10; i++ {
+		b.Adjust(len(b.Bytes()))
+	}
+	assert.Equal(t, 256*1024, len(b.Bytes()))
+
+	// half full reads keep the size
+	b.Adjust(len(b.Bytes()) / 2)
+	assert.Equal(t, 256*1024, len(b.Bytes()))
+
+	// slow stream returns small pieces
+	for i := 0; i < 10; i++ {
+		b.Adjust(100)
+	}
+	assert.Equal(t, 16*1024, len(b.Bytes()))
+}
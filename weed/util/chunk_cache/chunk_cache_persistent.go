@@ -0,0 +1,229 @@
+package chunk_cache
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+const persistentChunkSuffix = ".chunk"
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// PersistentChunkCache keeps whole chunks as files in a local directory, so they survive restarts.
+// Each file starts with the crc32c of the chunk data, which is verified on the first read of the file
+// by this process. Corrupted files are removed. The least recently used chunks are evicted
+// once the total size exceeds the capacity.
+type PersistentChunkCache struct {
+	dir      string
+	capacity int64
+	sync.Mutex
+	size    int64
+	lru     *list.List // most recently used at the front
+	entries map[string]*list.Element
+}
+
+type persistentChunkEntry struct {
+	fileId   string
+	size     int64 // file size, including the checksum
+	verified bool
+}
+
+var _ ChunkCache = &PersistentChunkCache{}
+
+// NewPersistentChunkCache loads the chunks already cached in the directory, oldest first in eviction order.
+func NewPersistentChunkCache(dir string, capacity int64) (*PersistentChunkCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &PersistentChunkCache{
+		dir:      dir,
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var infos []os.FileInfo
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if !strings.HasSuffix(name, persistentChunkSuffix) {
+			if strings.HasSuffix(name, ".tmp") {
+				// left over from an interrupted write
+				os.Remove(filepath.Join(dir, name))
+			}
+			continue
+		}
+		if info, infoErr := dirEntry.Info(); infoErr == nil {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		fileId := strings.ReplaceAll(strings.TrimSuffix(info.Name(), persistentChunkSuffix), "_", ",")
+		c.entries[fileId] = c.lru.PushFront(&persistentChunkEntry{fileId: fileId, size: info.Size()})
+		c.size += info.Size()
+	}
+	c.Lock()
+	c.evict()
+	c.Unlock()
+	return c, nil
+}
+
+func (c *PersistentChunkCache) fileName(fileId string) string {
+	return filepath.Join(c.dir, strings.ReplaceAll(fileId, ",", "_")+persistentChunkSuffix)
+}
+
+func (c *PersistentChunkCache) SetChunk(fileId string, data []byte) {
+	if c == nil || int64(len(data))+4 > c.capacity {
+		return
+	}
+	fileName := c.fileName(fileId)
+	// a temporary file of its own, as the same chunk may be cached by concurrent reads
+	tmpName, err := writeChunkFile(c.dir, filepath.Base(fileName)+".*.tmp", data)
+	if err != nil {
+		glog.V(0).Infof("cache chunk %s: %v", fileId, err)
+		if tmpName != "" {
+			os.Remove(tmpName)
+		}
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if err := os.Rename(tmpName, fileName); err != nil {
+		glog.V(0).Infof("cache chunk %s: %v", fileId, err)
+		os.Remove(tmpName)
+		return
+	}
+	if element, found := c.entries[fileId]; found {
+		c.size -= element.Value.(*persistentChunkEntry).size
+		c.lru.Remove(element)
+	}
+	size := int64(len(data)) + 4
+	c.entries[fileId] = c.lru.PushFront(&persistentChunkEntry{fileId: fileId, size: size, verified: true})
+	c.size += size
+	c.evict()
+}
+
+// writeChunkFile writes the data, after its checksum, to a new temporary file in the directory
+func writeChunkFile(dir, pattern string, data []byte) (fileName string, err error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	fileName = f.Name()
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], crc32.Checksum(data, castagnoliTable))
+	if _, err = f.Write(header[:]); err == nil {
+		_, err = f.Write(data)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return fileName, err
+}
+
+// evict removes the least recently used chunks over the capacity, must be called with the lock held
+func (c *PersistentChunkCache) evict() {
+	for c.size > c.capacity && c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back().Value.(*persistentChunkEntry).fileId)
+	}
+}
+
+func (c *PersistentChunkCache) removeLocked(fileId string) {
+	element, found := c.entries[fileId]
+	if !found {
+		return
+	}
+	c.lru.Remove(element)
+	delete(c.entries, fileId)
+	c.size -= element.Value.(*persistentChunkEntry).size
+	os.Remove(c.fileName(fileId))
+}
+
+// lookup marks the chunk as recently used, and tells whether it is cached and already verified
+func (c *PersistentChunkCache) lookup(fileId string) (found, verified bool) {
+	c.Lock()
+	defer c.Unlock()
+	element, found := c.entries[fileId]
+	if !found {
+		return false, false
+	}
+	c.lru.MoveToFront(element)
+	return true, element.Value.(*persistentChunkEntry).verified
+}
+
+// GetChunk returns the whole chunk, or nil if it is not cached or fails verification.
+func (c *PersistentChunkCache) GetChunk(fileId string) []byte {
+	if c == nil {
+		return nil
+	}
+	if found, _ := c.lookup(fileId); !found {
+		return nil
+	}
+	content, err := os.ReadFile(c.fileName(fileId))
+	if err != nil || len(content) < 4 {
+		c.Lock()
+		c.removeLocked(fileId)
+		c.Unlock()
+		return nil
+	}
+	data := content[4:]
+	if binary.BigEndian.Uint32(content[:4]) != crc32.Checksum(data, castagnoliTable) {
+		glog.Warningf("cached chunk %s is corrupted, removing it", fileId)
+		c.Lock()
+		c.removeLocked(fileId)
+		c.Unlock()
+		return nil
+	}
+	c.Lock()
+	if element, found := c.entries[fileId]; found {
+		element.Value.(*persistentChunkEntry).verified = true
+	}
+	c.Unlock()
+	return data
+}
+
+// ReadChunkAt reads the cached chunk from the offset. It returns 0 if the chunk is not cached.
+func (c *PersistentChunkCache) ReadChunkAt(data []byte, fileId string, offset uint64) (n int, err error) {
+	if c == nil {
+		return 0, nil
+	}
+	found, verified := c.lookup(fileId)
+	if !found {
+		return 0, nil
+	}
+	if !verified {
+		chunk := c.GetChunk(fileId)
+		if chunk == nil {
+			return 0, nil
+		}
+		if offset > uint64(len(chunk)) {
+			return 0, ErrorOutOfBounds
+		}
+		return copy(data, chunk[offset:]), nil
+	}
+	f, err := os.Open(c.fileName(fileId))
+	if err != nil {
+		return 0, nil
+	}
+	defer f.Close()
+	n, err = f.ReadAt(data, int64(offset)+4)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
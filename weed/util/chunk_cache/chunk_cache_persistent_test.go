@@ -0,0 +1,73 @@
+package chunk_cache
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistentChunkCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewPersistentChunkCache(dir, 30)
+	assert.NoError(t, err)
+
+	cache.SetChunk("1,01aabbccdd", []byte("0123456789"))
+	cache.SetChunk("1,02aabbccdd", []byte("abcdefghij"))
+	assert.Equal(t, []byte("0123456789"), cache.GetChunk("1,01aabbccdd"))
+
+	buf := make([]byte, 4)
+	n, err := cache.ReadChunkAt(buf, "1,02aabbccdd", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "defg", string(buf[:n]))
+
+	// exceeding the capacity evicts the least recently used chunk
+	cache.SetChunk("1,03aabbccdd", []byte("ABCDEFGHIJ"))
+	assert.Nil(t, cache.GetChunk("1,01aabbccdd"))
+	assert.NotNil(t, cache.GetChunk("1,02aabbccdd"))
+
+	// reloaded after a restart
+	cache, err = NewPersistentChunkCache(dir, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ABCDEFGHIJ"), cache.GetChunk("1,03aabbccdd"))
+
+	// corrupted chunks are detected and removed
+	fileName := cache.fileName("1,02aabbccdd")
+	content, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	content[5] ^= 0xff
+	assert.NoError(t, os.WriteFile(fileName, content, 0644))
+	cache, err = NewPersistentChunkCache(dir, 30)
+	assert.NoError(t, err)
+	n, err = cache.ReadChunkAt(buf, "1,02aabbccdd", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	_, err = os.Stat(fileName)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPersistentChunkCacheConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewPersistentChunkCache(dir, 1024*1024)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cache.SetChunk("1,01aabbccdd", bytes.Repeat([]byte(fmt.Sprintf("%x", i%2)), 4096))
+		}(i)
+	}
+	wg.Wait()
+	data := cache.GetChunk("1,01aabbccdd")
+	assert.Equal(t, 4096, len(data))
+	assert.True(t, bytes.Equal(bytes.Repeat(data[:1], 4096), data), "data of a single write")
+
+	dirEntries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(dirEntries), "no temporary file left")
+}
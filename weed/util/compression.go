@@ -5,8 +5,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/klauspost/compress/zstd"
+
 	"github.com/seaweedfs/seaweedfs/weed/glog"
-	// "github.com/klauspost/compress/zstd"
 )
 
 var (
@@ -60,11 +61,9 @@ func DecompressData(input []byte) ([]byte, error) {
 	if IsGzippedContent(input) {
 		return ungzipData(input)
 	}
-	/*
-		if IsZstdContent(input) {
-			return unzstdData(input)
-		}
-	*/
+	if IsZstdContent(input) {
+		return unzstdData(input)
+	}
 	return input, UnsupportedCompression
 }
 
@@ -75,7 +74,6 @@ func IsGzippedContent(data []byte) bool {
 	return data[0] == 31 && data[1] == 139
 }
 
-/*
 var zstdEncoder, _ = zstd.NewWriter(nil)
 
 func ZstdData(input []byte) ([]byte, error) {
@@ -94,7 +92,6 @@ func IsZstdContent(data []byte) bool {
 	}
 	return data[3] == 0xFD && data[2] == 0x2F && data[1] == 0xB5 && data[0] == 0x28
 }
-*/
 
 /*
 * Default not to compressed since compression can be done on client side.
@@ -1,7 +1,9 @@
 package util
 
 import (
+	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,7 +11,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/seaweedfs/seaweedfs/weed/glog"
 )
@@ -19,6 +23,66 @@ var (
 	Transport *http.Transport
 )
 
+// HttpStatusError is returned when a server answers with an error status code
+type HttpStatusError struct {
+	Url        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Url, e.Status)
+}
+
+// DefaultRetryableHttpStatusCodes are the error status codes worth retrying, e.g. an overloaded volume server.
+// Other error statuses, such as 404 or 416, fail the read right away.
+var DefaultRetryableHttpStatusCodes = []int{
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// retryableHttpStatusCodes is never modified once stored, only replaced
+var retryableHttpStatusCodes atomic.Pointer[map[int]bool]
+
+func init() {
+	SetRetryableHttpStatusCodes(DefaultRetryableHttpStatusCodes)
+}
+
+// SetRetryableHttpStatusCodes replaces the error status codes Get and ReadUrl retry, safe while requests are in flight
+func SetRetryableHttpStatusCodes(statusCodes []int) {
+	codes := make(map[int]bool, len(statusCodes))
+	for _, statusCode := range statusCodes {
+		codes[statusCode] = true
+	}
+	retryableHttpStatusCodes.Store(&codes)
+}
+
+// ParseHttpStatusCodes parses a comma separated list of status codes, as given on the command line
+func ParseHttpStatusCodes(list string) (statusCodes []int, err error) {
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		statusCode, err := strconv.Atoi(s)
+		if err != nil || statusCode < 100 || statusCode > 599 {
+			return nil, fmt.Errorf("invalid http status code %q", s)
+		}
+		statusCodes = append(statusCodes, statusCode)
+	}
+	return statusCodes, nil
+}
+
+func IsRetryableHttpStatus(statusCode int) bool {
+	return (*retryableHttpStatusCodes.Load())[statusCode]
+}
+
+// IsNotFound tells whether the error is caused by a 404 response
+func IsNotFound(err error) bool {
+	var statusErr *HttpStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
 func init() {
 	Transport = &http.Transport{
 		MaxIdleConns:        1024,
@@ -52,12 +116,23 @@ func Post(url string, values url.Values) ([]byte, error) {
 // github.com/seaweedfs/seaweedfs/unmaintained/repeated_vacuum/repeated_vacuum.go
 // may need increasing http.Client.Timeout
 func Get(url string) ([]byte, bool, error) {
+	return getWithHeader(context.Background(), url, nil)
+}
 
-	request, err := http.NewRequest("GET", url, nil)
+func getWithHeader(ctx context.Context, url string, header http.Header) ([]byte, bool, error) {
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	copyHeader(request.Header, header)
 	request.Header.Add("Accept-Encoding", "gzip")
 
 	response, err := client.Do(request)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
 		return nil, true, err
 	}
 	defer CloseResponse(response)
@@ -73,8 +148,8 @@ func Get(url string) ([]byte, bool, error) {
 
 	b, err := io.ReadAll(reader)
 	if response.StatusCode >= 400 {
-		retryable := response.StatusCode >= 500
-		return nil, retryable, fmt.Errorf("%s: %s", url, response.Status)
+		retryable := IsRetryableHttpStatus(response.StatusCode)
+		return nil, retryable, &HttpStatusError{Url: url, StatusCode: response.StatusCode, Status: response.Status}
 	}
 	if err != nil {
 		return nil, false, err
@@ -222,7 +297,7 @@ func ReadUrl(fileUrl string, cipherKey []byte, isContentCompressed bool, isFullC
 
 	if cipherKey != nil {
 		var n int
-		_, err := readEncryptedUrl(fileUrl, cipherKey, isContentCompressed, isFullChunk, offset, size, func(data []byte) {
+		_, err := readEncryptedUrl(context.Background(), fileUrl, nil, cipherKey, isContentCompressed, isFullChunk, offset, size, func(data []byte) {
 			n = copy(buf, data)
 		})
 		return int64(n), err
@@ -288,37 +363,68 @@ func ReadUrl(fileUrl string, cipherKey []byte, isContentCompressed bool, isFullC
 }
 
 func ReadUrlAsStream(fileUrl string, cipherKey []byte, isContentGzipped bool, isFullChunk bool, offset int64, size int, fn func(data []byte)) (retryable bool, err error) {
+	return ReadUrlAsStreamWithHeader(fileUrl, nil, cipherKey, isContentGzipped, isFullChunk, offset, size, fn)
+}
+
+// ReadUrlAsStreamWithHeader is ReadUrlAsStream sending extra request headers,
+// e.g. to identify the reader in volume server access logs.
+func ReadUrlAsStreamWithHeader(fileUrl string, header http.Header, cipherKey []byte, isContentGzipped bool, isFullChunk bool, offset int64, size int, fn func(data []byte)) (retryable bool, err error) {
+	return ReadUrlAsStreamWithContext(context.Background(), fileUrl, header, cipherKey, isContentGzipped, isFullChunk, offset, size, fn)
+}
+
+// ReadUrlAsStreamWithContext is ReadUrlAsStreamWithHeader cancelled with the context.
+// Once the context is done, the request is aborted and the error of the context is returned as not retryable.
+func ReadUrlAsStreamWithContext(ctx context.Context, fileUrl string, header http.Header, cipherKey []byte, isContentGzipped bool, isFullChunk bool, offset int64, size int, fn func(data []byte)) (retryable bool, err error) {
 	if cipherKey != nil {
-		return readEncryptedUrl(fileUrl, cipherKey, isContentGzipped, isFullChunk, offset, size, fn)
+		return readEncryptedUrl(ctx, fileUrl, header, cipherKey, isContentGzipped, isFullChunk, offset, size, fn)
 	}
 
-	req, err := http.NewRequest("GET", fileUrl, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", fileUrl, nil)
 	if err != nil {
 		return false, err
 	}
+	copyHeader(req.Header, header)
 
 	if isFullChunk {
-		req.Header.Add("Accept-Encoding", "gzip")
+		// unless the caller asks for the stored bytes as they are
+		if req.Header.Get("Accept-Encoding") == "" {
+			req.Header.Add("Accept-Encoding", "gzip")
+		}
 	} else {
 		req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+int64(size)-1))
 	}
 
 	r, err := client.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
 		return true, err
 	}
 	defer CloseResponse(r)
 	if r.StatusCode >= 400 {
-		retryable = r.StatusCode == http.StatusNotFound || r.StatusCode >= 500
-		return retryable, fmt.Errorf("%s: %s", fileUrl, r.Status)
+		retryable = IsRetryableHttpStatus(r.StatusCode)
+		return retryable, &HttpStatusError{Url: fileUrl, StatusCode: r.StatusCode, Status: r.Status}
 	}
 
 	var reader io.ReadCloser
 	contentEncoding := r.Header.Get("Content-Encoding")
 	switch contentEncoding {
 	case "gzip":
-		reader, err = gzip.NewReader(r.Body)
-		defer reader.Close()
+		var body io.Reader = r.Body
+		if GzipPipelineDepth > 0 && r.ContentLength > int64(GzipPipelineBufferSize) {
+			// decompress earlier bytes while later bytes are still being fetched
+			pipe := newPipelinedReader(r.Body, GzipPipelineDepth, GzipPipelineBufferSize)
+			defer pipe.Close()
+			body = pipe
+		}
+		gzipReader, gzipErr := gzip.NewReader(body)
+		if gzipErr != nil {
+			// reading again does not fix gzip.ErrHeader, for content wrongly flagged as compressed
+			return !errors.Is(gzipErr, gzip.ErrHeader), fmt.Errorf("gunzip %s: %w", fileUrl, gzipErr)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
 	default:
 		reader = r.Body
 	}
@@ -326,33 +432,41 @@ func ReadUrlAsStream(fileUrl string, cipherKey []byte, isContentGzipped bool, is
 	var (
 		m int
 	)
-	buf := mem.Allocate(64 * 1024)
-	defer mem.Free(buf)
+	buf := newAdaptiveBuffer(StreamReadBufferMinSize, StreamReadBufferMaxSize)
+	defer buf.Free()
 
 	for {
-		m, err = reader.Read(buf)
+		m, err = reader.Read(buf.Bytes())
 		if m > 0 {
-			fn(buf[:m])
+			fn(buf.Bytes()[:m])
 		}
 		if err == io.EOF {
 			return false, nil
 		}
 		if err != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
 			return true, err
 		}
+		buf.Adjust(m)
 	}
 
 }
 
-func readEncryptedUrl(fileUrl string, cipherKey []byte, isContentCompressed bool, isFullChunk bool, offset int64, size int, fn func(data []byte)) (bool, error) {
-	encryptedData, retryable, err := Get(fileUrl)
+func readEncryptedUrl(ctx context.Context, fileUrl string, header http.Header, cipherKey []byte, isContentCompressed bool, isFullChunk bool, offset int64, size int, fn func(data []byte)) (bool, error) {
+	encryptedData, retryable, err := getWithHeader(ctx, fileUrl, header)
 	if err != nil {
-		return retryable, fmt.Errorf("fetch %s: %v", fileUrl, err)
+		return retryable, fmt.Errorf("fetch %s: %w", fileUrl, err)
 	}
 	decryptedData, err := Decrypt(encryptedData, CipherKey(cipherKey))
 	if err != nil {
 		return false, fmt.Errorf("decrypt %s: %v", fileUrl, err)
 	}
+	if isContentCompressed && isFullChunk && IsGzippedContent(decryptedData) {
+		// decompress while streaming, so the decompressed copy is not held in memory in addition to the caller's
+		return false, gunzipAsStream(fileUrl, decryptedData, fn)
+	}
 	if isContentCompressed {
 		decryptedData, err = DecompressData(decryptedData)
 		if err != nil {
@@ -370,6 +484,38 @@ func readEncryptedUrl(fileUrl string, cipherKey []byte, isContentCompressed bool
 	return false, nil
 }
 
+func copyHeader(dst, src http.Header) {
+	for k, vv := range src {
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+}
+
+func gunzipAsStream(fileUrl string, compressedData []byte, fn func(data []byte)) error {
+	reader, err := gzip.NewReader(bytes.NewReader(compressedData))
+	if err != nil {
+		return fmt.Errorf("unzip decrypt %s: %v", fileUrl, err)
+	}
+	defer reader.Close()
+
+	buf := mem.Allocate(64 * 1024)
+	defer mem.Free(buf)
+
+	for {
+		m, err := reader.Read(buf)
+		if m > 0 {
+			fn(buf[:m])
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unzip decrypt %s: %v", fileUrl, err)
+		}
+	}
+}
+
 func ReadUrlAsReaderCloser(fileUrl string, jwt string, rangeHeader string) (*http.Response, io.ReadCloser, error) {
 
 	req, err := http.NewRequest("GET", fileUrl, nil)
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadUrlAsStreamEncryptedCompressed(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	compressed, err := GzipData(data)
+	assert.NoError(t, err)
+	cipherKey := GenCipherKey()
+	encrypted, err := Encrypt(compressed, cipherKey)
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(encrypted)
+	}))
+	defer server.Close()
+
+	var received bytes.Buffer
+	var calls int
+	_, err = ReadUrlAsStream(server.URL, cipherKey, true, true, 0, len(data), func(piece []byte) {
+		calls++
+		received.Write(piece)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, data, received.Bytes())
+	assert.Greater(t, calls, 1, "decompressed data should be streamed in pieces")
+
+	received.Reset()
+	_, err = ReadUrlAsStream(server.URL, cipherKey, true, false, 16, 32, func(piece []byte) {
+		received.Write(piece)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, data[16:48], received.Bytes())
+}
+
+func TestReadUrlAsStreamRetryableStatus(t *testing.T) {
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	for code, expected := range map[int]bool{
+		http.StatusBadRequest:                   false,
+		http.StatusNotFound:                     false,
+		http.StatusRequestedRangeNotSatisfiable: false,
+		http.StatusBadGateway:                   true,
+		http.StatusServiceUnavailable:           true,
+		http.StatusGatewayTimeout:               true,
+	} {
+		status = code
+		retryable, err := ReadUrlAsStream(server.URL, nil, false, false, 0, 4, func(data []byte) {})
+		assert.Error(t, err, "status %d", code)
+		assert.Equal(t, expected, retryable, "status %d", code)
+	}
+
+	defer SetRetryableHttpStatusCodes(DefaultRetryableHttpStatusCodes)
+	SetRetryableHttpStatusCodes(append([]int{http.StatusTooManyRequests}, DefaultRetryableHttpStatusCodes...))
+	status = http.StatusTooManyRequests
+	retryable, _ := ReadUrlAsStream(server.URL, nil, false, false, 0, 4, func(data []byte) {})
+	assert.True(t, retryable)
+}
+
+func TestParseHttpStatusCodes(t *testing.T) {
+	statusCodes, err := ParseHttpStatusCodes("502, 503,504,")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{502, 503, 504}, statusCodes)
+	statusCodes, err = ParseHttpStatusCodes("")
+	assert.NoError(t, err)
+	assert.Empty(t, statusCodes)
+	_, err = ParseHttpStatusCodes("503,abc")
+	assert.Error(t, err)
+	_, err = ParseHttpStatusCodes("5030")
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package util
+
+import (
+	"io"
+
+	"github.com/seaweedfs/seaweedfs/weed/util/mem"
+)
+
+// bounds of the read-ahead between the network and the decompression of gzipped chunks
+// in ReadUrlAsStream. A depth of 0, the default, decompresses directly from the network.
+var (
+	GzipPipelineDepth      = 0
+	GzipPipelineBufferSize = 256 * 1024
+)
+
+// pipelinedReader reads ahead from the underlying reader in a background goroutine,
+// so the consumer, e.g. a gzip reader, works on earlier bytes while later bytes are being fetched.
+// At most depth+1 buffers are held.
+type pipelinedReader struct {
+	filled  chan pipelinedBlock
+	free    chan []byte
+	done    chan struct{}
+	current pipelinedBlock
+	pos     int
+	err     error
+	buffers [][]byte
+}
+
+type pipelinedBlock struct {
+	buf []byte
+	n   int
+	err error
+}
+
+func newPipelinedReader(reader io.Reader, depth int, bufferSize int) *pipelinedReader {
+	p := &pipelinedReader{
+		filled: make(chan pipelinedBlock, depth),
+		free:   make(chan []byte, depth+1),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i <= depth; i++ {
+		buf := mem.Allocate(bufferSize)
+		p.buffers = append(p.buffers, buf)
+		p.free <- buf
+	}
+	go p.readAhead(reader)
+	return p
+}
+
+func (p *pipelinedReader) readAhead(reader io.Reader) {
+	defer p.release()
+	defer close(p.filled)
+	for {
+		var buf []byte
+		select {
+		case buf = <-p.free:
+		case <-p.done:
+			return
+		}
+		n, err := io.ReadFull(reader, buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		select {
+		case p.filled <- pipelinedBlock{buf: buf, n: n, err: err}:
+		case <-p.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *pipelinedReader) Read(b []byte) (int, error) {
+	for p.pos >= p.current.n {
+		if p.err != nil {
+			return 0, p.err
+		}
+		if p.current.buf != nil {
+			p.free <- p.current.buf
+			p.current.buf = nil
+		}
+		block, ok := <-p.filled
+		if !ok {
+			return 0, io.ErrUnexpectedEOF
+		}
+		p.current, p.pos, p.err = block, 0, block.err
+	}
+	n := copy(b, p.current.buf[p.pos:p.current.n])
+	p.pos += n
+	return n, nil
+}
+
+// Close stops reading ahead without waiting for a read in progress. The buffers are released
+// once the background read returns; the underlying reader is not closed.
+func (p *pipelinedReader) Close() {
+	close(p.done)
+}
+
+// release frees the buffers once both the background read and the consumer are done with them
+func (p *pipelinedReader) release() {
+	<-p.done
+	for _, buf := range p.buffers {
+		mem.Free(buf)
+	}
+}
@@ -0,0 +1,88 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipelinedReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	p := newPipelinedReader(bytes.NewReader(data), 2, 1000)
+	read, err := io.ReadAll(p)
+	p.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+
+	// errors are passed through after the data read before them
+	failing := io.MultiReader(bytes.NewReader(data[:1500]), &errorReader{errors.New("broken")})
+	p = newPipelinedReader(failing, 2, 1000)
+	read, err = io.ReadAll(p)
+	p.Close()
+	assert.EqualError(t, err, "broken")
+	assert.Equal(t, data[:1500], read)
+
+	// closing early does not wait for the whole input
+	p = newPipelinedReader(bytes.NewReader(data), 1, 1000)
+	_, err = p.Read(make([]byte, 10))
+	assert.NoError(t, err)
+	p.Close()
+
+	// closing does not wait for a read blocked on the network
+	blocked, unblock := io.Pipe()
+	p = newPipelinedReader(blocked, 1, 1000)
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close should not wait for the read in progress")
+	}
+	unblock.Close()
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestReadUrlAsStreamGzipPipelined(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 256*1024)
+	compressed, err := GzipData(data)
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(len(compressed)))
+		w.Write(compressed)
+	}))
+	defer server.Close()
+
+	defer func(depth, size int) {
+		GzipPipelineDepth, GzipPipelineBufferSize = depth, size
+	}(GzipPipelineDepth, GzipPipelineBufferSize)
+	GzipPipelineBufferSize = 1024
+
+	for _, depth := range []int{0, 4} {
+		GzipPipelineDepth = depth
+		var received bytes.Buffer
+		_, err = ReadUrlAsStream(server.URL, nil, true, true, 0, len(data), func(piece []byte) {
+			received.Write(piece)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, data, received.Bytes(), "depth %d", depth)
+	}
+}
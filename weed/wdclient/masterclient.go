@@ -29,6 +29,7 @@ type MasterClient struct {
 
 	*vidMap
 	vidMapCacheSize  int
+	dataCenters      sync.Map // volume server url -> data center
 	OnPeerUpdate     func(update *master_pb.ClusterNodeUpdate, startFrom time.Time)
 	OnPeerUpdateLock sync.RWMutex
 }
@@ -52,6 +53,14 @@ func (mc *MasterClient) SetOnPeerUpdateFn(onPeerUpdate func(update *master_pb.Cl
 	mc.OnPeerUpdateLock.Unlock()
 }
 
+// GetDataCenter returns the data center of a volume server url, e.g. "10.0.0.1:8080", empty if unknown
+func (mc *MasterClient) GetDataCenter(serverUrl string) string {
+	if dataCenter, found := mc.dataCenters.Load(serverUrl); found {
+		return dataCenter.(string)
+	}
+	return ""
+}
+
 func (mc *MasterClient) GetLookupFileIdFunction() LookupFileIdFunctionType {
 	return mc.LookupFileIdWithFallback
 }
@@ -77,6 +86,7 @@ func (mc *MasterClient) LookupFileIdWithFallback(fileId string) (fullUrls []stri
 					DataCenter: vidLoc.DataCenter,
 				}
 				mc.vidMap.addLocation(uint32(vid), loc)
+				mc.dataCenters.Store(loc.Url, loc.DataCenter)
 				httpUrl := "http://" + loc.Url + "/" + fileId
 				// Prefer same data center
 				if mc.DataCenter != "" && mc.DataCenter == loc.DataCenter {
@@ -274,6 +284,7 @@ func (mc *MasterClient) updateVidMap(resp *master_pb.KeepConnectedResponse) {
 		DataCenter: resp.VolumeLocation.DataCenter,
 		GrpcPort:   int(resp.VolumeLocation.GrpcPort),
 	}
+	mc.dataCenters.Store(loc.Url, loc.DataCenter)
 	for _, newVid := range resp.VolumeLocation.NewVids {
 		glog.V(2).Infof("%s.%s: %s masterClient adds volume %d", mc.FilerGroup, mc.clientType, loc.Url, newVid)
 		mc.addLocation(newVid, loc)
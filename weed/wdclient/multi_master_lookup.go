@@ -0,0 +1,70 @@
+package wdclient
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+// a master that failed is skipped for this long, unless no healthy master is left
+var MultiMasterUnhealthyDuration = 30 * time.Second
+
+type masterLookupHealth struct {
+	lookupFn            LookupFileIdFunctionType
+	consecutiveFailures int
+	lastFailure         time.Time
+}
+
+type multiMasterLookup struct {
+	sync.Mutex
+	masters []*masterLookupHealth
+}
+
+// MultiMasterLookupFunction returns a lookup function that asks the given masters in order
+// and returns the first successful answer. Masters that recently failed are tried last,
+// so a single master outage does not fail manifest resolution or chunk reads.
+func MultiMasterLookupFunction(masters ...LookupFileIdFunctionType) LookupFileIdFunctionType {
+	m := &multiMasterLookup{}
+	for _, lookupFn := range masters {
+		m.masters = append(m.masters, &masterLookupHealth{lookupFn: lookupFn})
+	}
+	return m.LookupFileId
+}
+
+func (m *multiMasterLookup) LookupFileId(fileId string) (targetUrls []string, err error) {
+	if len(m.masters) == 0 {
+		return nil, fmt.Errorf("lookup %s: no masters", fileId)
+	}
+	for _, master := range m.orderedByHealth() {
+		targetUrls, err = master.lookupFn(fileId)
+		m.Lock()
+		if err == nil {
+			master.consecutiveFailures = 0
+		} else {
+			master.consecutiveFailures++
+			master.lastFailure = time.Now()
+		}
+		m.Unlock()
+		if err == nil {
+			return targetUrls, nil
+		}
+		glog.V(1).Infof("lookup %s failed, trying next master: %v", fileId, err)
+	}
+	return nil, err
+}
+
+func (m *multiMasterLookup) orderedByHealth() (ordered []*masterLookupHealth) {
+	m.Lock()
+	defer m.Unlock()
+	var unhealthy []*masterLookupHealth
+	for _, master := range m.masters {
+		if master.consecutiveFailures > 0 && time.Since(master.lastFailure) < MultiMasterUnhealthyDuration {
+			unhealthy = append(unhealthy, master)
+		} else {
+			ordered = append(ordered, master)
+		}
+	}
+	return append(ordered, unhealthy...)
+}
@@ -0,0 +1,48 @@
+package wdclient
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiMasterLookupFunction(t *testing.T) {
+	var calls []string
+	newMaster := func(name string, healthy *bool) LookupFileIdFunctionType {
+		return func(fileId string) ([]string, error) {
+			calls = append(calls, name)
+			if !*healthy {
+				return nil, fmt.Errorf("%s is down", name)
+			}
+			return []string{"http://" + name + "/" + fileId}, nil
+		}
+	}
+	aHealthy, bHealthy := true, true
+	lookupFn := MultiMasterLookupFunction(newMaster("a", &aHealthy), newMaster("b", &bHealthy))
+
+	urls, err := lookupFn("1,2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://a/1,2"}, urls)
+
+	// fail over to b, then keep preferring b while a is unhealthy
+	aHealthy = false
+	calls = nil
+	urls, err = lookupFn("1,2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://b/1,2"}, urls)
+	assert.Equal(t, []string{"a", "b"}, calls)
+
+	calls = nil
+	_, err = lookupFn("1,2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, calls)
+
+	// all masters down
+	bHealthy = false
+	_, err = lookupFn("1,2")
+	assert.Error(t, err)
+
+	_, err = MultiMasterLookupFunction()("1,2")
+	assert.Error(t, err)
+}